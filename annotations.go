@@ -0,0 +1,129 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"net/http"
+	"time"
+)
+
+// Annotation kinds
+const (
+	AnnotationStepStart   = "step_start"
+	AnnotationStepFinish  = "step_finish"
+	AnnotationStage       = "stage"
+	AnnotationValidation  = "validation"
+	AnnotationCheckFailed = "check_failed"
+)
+
+// annotationsQueueSize annotations waiting to be posted, new annotations are dropped if grafana is slow
+const annotationsQueueSize = 256
+
+// Annotation what generator was doing at a moment, recorded in suite report and posted to grafana
+type Annotation struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Step   string    `json:"step,omitempty"`
+	Handle string    `json:"handle,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// grafanaAnnotation body of grafana annotations api
+type grafanaAnnotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+// grafanaAnnotator posts annotations in background, so runners are not blocked by grafana
+type grafanaAnnotator struct {
+	client *GrafanaClient
+	tags   []string
+	queue  chan Annotation
+	done   chan struct{}
+}
+
+func newGrafanaAnnotator(client *GrafanaClient, tags []string) *grafanaAnnotator {
+	a := &grafanaAnnotator{
+		client: client,
+		tags:   tags,
+		queue:  make(chan Annotation, annotationsQueueSize),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(a.done)
+		for an := range a.queue {
+			if err := a.client.do(http.MethodPost, "/api/annotations", a.body(an), nil); err != nil {
+				log.Errorf("failed to post grafana annotation: %s", err)
+			}
+		}
+	}()
+	return a
+}
+
+// body annotation tagged with run tags, kind, step and handle, so dashboards can filter them
+func (a *grafanaAnnotator) body(an Annotation) grafanaAnnotation {
+	tags := append(append([]string{}, a.tags...), an.Kind)
+	if an.Step != "" {
+		tags = append(tags, "step:"+an.Step)
+	}
+	if an.Handle != "" {
+		tags = append(tags, "handle:"+an.Handle)
+	}
+	return grafanaAnnotation{Time: epochNowMillis(an.Time), Tags: tags, Text: an.Text}
+}
+
+func (a *grafanaAnnotator) post(an Annotation) {
+	select {
+	case a.queue <- an:
+	default:
+		log.Warnf("grafana annotations queue is full, dropping: %s", an.Text)
+	}
+}
+
+// Close posts queued annotations
+func (a *grafanaAnnotator) Close() {
+	close(a.queue)
+	<-a.done
+}
+
+// startAnnotations posts annotations to grafana if grafana.annotations is set
+func (m *LoadManager) startAnnotations() {
+	c := m.GeneratorConfig
+	if c.Grafana.URL == "" || !c.Grafana.Annotations {
+		return
+	}
+	m.annotator = newGrafanaAnnotator(NewGrafanaClient(c), []string{"loadgen", "run:" + m.RunID, "suite:" + suiteName(m.SuiteConfigPath)})
+}
+
+// annotate records annotation of the run and posts it to grafana
+func (m *LoadManager) annotate(kind string, step string, handle string, text string) {
+	an := Annotation{Time: timeNow(), Kind: kind, Step: step, Handle: handle, Text: text}
+	m.annotationsMu.Lock()
+	m.annotations = append(m.annotations, an)
+	m.annotationsMu.Unlock()
+	if m.annotator != nil {
+		m.annotator.post(an)
+	}
+}
+
+// Annotations copy of recorded annotations
+func (m *LoadManager) Annotations() []Annotation {
+	m.annotationsMu.Lock()
+	defer m.annotationsMu.Unlock()
+	return append([]Annotation{}, m.annotations...)
+}
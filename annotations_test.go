@@ -0,0 +1,102 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnnotationsPostedToGrafana(t *testing.T) {
+	setupLogger("console", "error")
+	var mu sync.Mutex
+	var posted []grafanaAnnotation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/api/annotations" {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		var a grafanaAnnotation
+		if err := json.NewDecoder(req.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		posted = append(posted, a)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	c := &GeneratorConfig{}
+	c.Grafana.URL = srv.URL
+	c.Grafana.Annotations = true
+	m := &LoadManager{GeneratorConfig: c, RunID: "42", SuiteConfigPath: "suites/checkout.yaml"}
+	m.startAnnotations()
+	if m.annotator == nil {
+		t.Fatal("annotator is not started")
+	}
+	m.annotate(AnnotationStepStart, "load", "", "step load started")
+	m.annotate(AnnotationCheckFailed, "load", "checkout", "checkout: stop check failed")
+	m.annotator.Close()
+
+	if len(posted) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(posted))
+	}
+	want := []string{"loadgen", "run:42", "suite:checkout", AnnotationCheckFailed, "step:load", "handle:checkout"}
+	if !reflect.DeepEqual(posted[1].Tags, want) {
+		t.Fatalf("unexpected tags %v", posted[1].Tags)
+	}
+	if posted[1].Text != "checkout: stop check failed" || posted[1].Time == 0 {
+		t.Fatalf("unexpected annotation %+v", posted[1])
+	}
+	if got := m.Annotations(); len(got) != 2 || got[0].Kind != AnnotationStepStart {
+		t.Fatalf("unexpected recorded annotations %+v", got)
+	}
+}
+
+func TestAnnotationsWithoutGrafana(t *testing.T) {
+	c := &GeneratorConfig{}
+	c.Grafana.URL = "http://grafana"
+	m := &LoadManager{GeneratorConfig: c}
+	m.startAnnotations()
+	if m.annotator != nil {
+		t.Fatal("annotator must be started only if annotations are enabled")
+	}
+	m.annotate(AnnotationStage, "load", "checkout", "checkout: rampup to 100 rps in 10s")
+	if got := m.Annotations(); len(got) != 1 || got[0].Handle != "checkout" {
+		t.Fatalf("unexpected recorded annotations %+v", got)
+	}
+}
+
+func TestReportTimeline(t *testing.T) {
+	r := &SuiteReport{
+		Annotations: []Annotation{
+			{Time: time.Unix(0, 0), Kind: AnnotationValidation, Step: "load", Handle: "checkout", Text: "checkout: validation of max rps 90 for 30s"},
+		},
+	}
+	var b strings.Builder
+	if err := WriteHTMLReport(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "Timeline") || !strings.Contains(b.String(), "validation of max rps 90 for 30s") {
+		t.Fatal("report has no timeline")
+	}
+}
@@ -73,13 +73,13 @@ type WithData struct {
 
 var errAttackDoTimedOut = e.New("Attack Do(ctx) timedout")
 
-// attack calls attacker.Do upon each received next token, forever
+// attack calls attacker.Do upon each received next token, forever, token is the time request was scheduled at
 // attack aborts the loop on a quit receive
 // attack sends a result on the results channel after each call.
-func attack(attacker Attack, next, quit <-chan bool, results chan<- result, timeout time.Duration) {
+func attack(attacker Attack, next <-chan time.Time, quit <-chan bool, results chan<- result, timeout time.Duration) {
 	for {
 		select {
-		case <-next:
+		case scheduled := <-next:
 			begin := time.Now()
 			done := make(chan DoResult)
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -94,12 +94,16 @@ func attack(attacker Attack, next, quit <-chan bool, results chan<- result, time
 				dor = DoResult{Error: errAttackDoTimedOut}
 			case dor = <-done:
 			}
+			if r := attacker.GetRunner(); r != nil {
+				dor = r.checkResult(dor)
+			}
 			end := time.Now()
 			results <- result{
-				doResult: dor,
-				begin:    begin,
-				end:      end,
-				elapsed:  end.Sub(begin),
+				doResult:  dor,
+				scheduled: scheduled,
+				begin:     begin,
+				end:       end,
+				elapsed:   end.Sub(begin),
 			}
 		case <-quit:
 			return
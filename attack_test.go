@@ -25,13 +25,13 @@ func TestAttack1(t *testing.T) {
 	attacker := new(attackMock)
 	dur := 10 * time.Millisecond
 	attacker.sleep = dur
-	next := make(chan bool)
+	next := make(chan time.Time)
 	quit := make(chan bool)
 	results := make(chan result)
 
 	go attack(attacker, next, quit, results, 1*time.Second)
 
-	next <- true
+	next <- time.Now()
 	r := <-results
 	quit <- true
 	if got, want := r.doResult.Error, error(nil); got != want {
@@ -46,16 +46,28 @@ func TestAttackTimeout(t *testing.T) {
 	attacker := new(attackMock)
 	dur := 2 * time.Second
 	attacker.sleep = dur
-	next := make(chan bool)
+	next := make(chan time.Time)
 	quit := make(chan bool)
 	results := make(chan result)
 
 	go attack(attacker, next, quit, results, 1*time.Second)
 
-	next <- true
+	next <- time.Now()
 	r := <-results
 	quit <- true
 	if got, want := r.doResult.Error, errAttackDoTimedOut; got != want {
 		t.Fatalf("got %v want %v", got, want)
 	}
 }
+
+func TestRunnerErrors(t *testing.T) {
+	m, _, closeSrv := testControlManager("first")
+	defer closeSrv()
+	r := m.Steps[0].Runners[0]
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", StatusCode: 200}})
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", Error: errAttackDoTimedOut}})
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", StatusCode: 503}})
+	if cnt, ok := r.Errors["get"]; !ok || cnt.Count() != 2 {
+		t.Fatalf("unexpected error counters: %v", r.Errors)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// JUnitReportFile junit xml report file name
+	JUnitReportFile = "junit.xml"
+	// MarkdownSummaryFile markdown summary file name
+	MarkdownSummaryFile = "summary.md"
+	// githubStepSummaryEnv file of github actions job summary, summary is appended to it when set
+	githubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Error      *junitMessage   `xml:"error,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// reportName handle name of the report, validation runs are marked
+func reportName(r *RunReport) string {
+	if r.Configuration.IsValidationRun {
+		return r.Configuration.HandleName + " (validation)"
+	}
+	return r.Configuration.HandleName
+}
+
+// reportFailures reasons why handle results are not acceptable
+func (r *SuiteReport) reportFailures(rep *RunReport) []string {
+	failures := make([]string, 0)
+	if rep.GeneratorBound {
+		for _, e := range rep.Saturation {
+			failures = append(failures, fmt.Sprintf("generator-bound: %s", e.Text))
+		}
+	}
+	if rep.Failed {
+		if rep.Configuration.IsValidationRun {
+			failures = append(failures, "max rps validation failed")
+		} else {
+			failures = append(failures, "stop check fired")
+		}
+	}
+	if rep.Degraded {
+		for _, reg := range r.Regressions {
+			if reg.Regressed && reg.Report == rep.key() {
+				failures = append(failures, fmt.Sprintf("%s of %s regressed: %s", reg.Metric, reg.Label, reg.Change()))
+			}
+		}
+		if len(failures) == 0 {
+			failures = append(failures, "degraded compared to baseline")
+		}
+	}
+	failures = append(failures, sloViolations(rep)...)
+	labels := sortedLabels(rep)
+	for _, label := range labels {
+		for _, e := range rep.Metrics[label].Errors {
+			failures = append(failures, fmt.Sprintf("error in %s: %s", label, e))
+		}
+	}
+	return failures
+}
+
+func sortedLabels(rep *RunReport) []string {
+	labels := make([]string, 0, len(rep.Metrics))
+	for label := range rep.Metrics {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// reportProperties handle config and label metrics as junit properties
+func reportProperties(rep *RunReport) []junitProperty {
+	props := []junitProperty{
+		{Name: "rps", Value: fmt.Sprint(rep.Configuration.RPS)},
+		{Name: "max_attackers", Value: fmt.Sprint(rep.Configuration.MaxAttackers)},
+		{Name: "attack_time_sec", Value: fmt.Sprint(rep.Configuration.AttackTimeSec)},
+	}
+	for _, label := range sortedLabels(rep) {
+		m := rep.Metrics[label]
+		props = append(props,
+			junitProperty{Name: label + ".requests", Value: fmt.Sprint(m.Requests)},
+			junitProperty{Name: label + ".rate", Value: fmt.Sprintf("%.2f", m.Rate)},
+			junitProperty{Name: label + ".success", Value: fmt.Sprintf("%.4f", m.Success)},
+			junitProperty{Name: label + ".p50_ms", Value: fmt.Sprintf("%.2f", latencyMs(m.Latencies.P50))},
+			junitProperty{Name: label + ".p95_ms", Value: fmt.Sprintf("%.2f", latencyMs(m.Latencies.P95))},
+			junitProperty{Name: label + ".p99_ms", Value: fmt.Sprintf("%.2f", latencyMs(m.Latencies.P99))},
+			junitProperty{Name: label + ".max_ms", Value: fmt.Sprintf("%.2f", latencyMs(m.Latencies.Max))},
+			junitProperty{Name: label + ".errors", Value: fmt.Sprint(len(m.Errors))},
+		)
+		if s := m.SLO; s != nil {
+			props = append(props,
+				junitProperty{Name: label + ".apdex", Value: fmt.Sprintf("%.3f", s.Apdex)},
+				junitProperty{Name: label + ".slo_attainment", Value: fmt.Sprintf("%.2f", s.Attainment)},
+			)
+			if s.Objective != 0 {
+				props = append(props, junitProperty{Name: label + ".error_budget_remaining", Value: fmt.Sprintf("%.1f", s.ErrorBudgetRemaining)})
+			}
+		}
+	}
+	return props
+}
+
+// WriteJUnitReport writes suite results as junit xml: every step is a testsuite, every handle run is a testcase,
+// run errors are junit errors, stop checks, degradation, validation and handle errors are failures,
+// interrupted runs are skipped
+func WriteJUnitReport(out io.Writer, rep *SuiteReport) error {
+	suites := junitTestSuites{
+		Name: rep.Suite,
+		Time: seconds(rep.FinishedAt.Sub(rep.StartedAt)),
+	}
+	for _, step := range rep.Steps {
+		ts := junitTestSuite{Name: step.Name}
+		var stepTime time.Duration
+		for _, r := range step.Reports {
+			if ts.Timestamp == "" && !r.StartedAt.IsZero() {
+				ts.Timestamp = r.StartedAt.Format("2006-01-02T15:04:05")
+			}
+			stepTime += r.FinishedAt.Sub(r.StartedAt)
+			tc := junitTestCase{
+				Name:       reportName(r),
+				Classname:  step.Name,
+				Time:       seconds(r.FinishedAt.Sub(r.StartedAt)),
+				Properties: reportProperties(r),
+			}
+			failures := rep.reportFailures(r)
+			switch {
+			case r.RunError != "":
+				tc.Error = &junitMessage{Message: r.RunError, Type: "run_error", Text: r.RunError}
+				ts.Errors++
+			case r.Interrupted:
+				tc.Skipped = &junitMessage{Message: "run was interrupted, results are partial"}
+				ts.Skipped++
+			case len(failures) != 0:
+				tc.Failure = &junitMessage{Message: failures[0], Type: "performance", Text: strings.Join(failures, "\n")}
+				ts.Failures++
+			}
+			ts.Cases = append(ts.Cases, tc)
+		}
+		ts.Tests = len(ts.Cases)
+		ts.Time = seconds(stepTime)
+		suites.Tests += ts.Tests
+		suites.Failures += ts.Failures
+		suites.Errors += ts.Errors
+		suites.Skipped += ts.Skipped
+		suites.Suites = append(suites.Suites, ts)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// WriteMarkdownSummary writes short suite summary in markdown for ci job summaries
+func WriteMarkdownSummary(out io.Writer, rep *SuiteReport) {
+	fmt.Fprintf(out, "## Load test: %s\n\n", rep.Suite)
+	fmt.Fprintf(out, "**Status:** %s, duration %s", rep.Status(), rep.FinishedAt.Sub(rep.StartedAt).Round(time.Second))
+	if rep.GrafanaURL != "" {
+		fmt.Fprintf(out, ", [Grafana](%s)", rep.GrafanaURL)
+	}
+	fmt.Fprint(out, "\n\n")
+	fmt.Fprintln(out, "| Step | Handle | Label | Requests | Rate | Success | p50 ms | p95 ms | p99 ms | Errors | Status |")
+	fmt.Fprintln(out, "|---|---|---|---:|---:|---:|---:|---:|---:|---:|---|")
+	failures := make([]string, 0)
+	for _, step := range rep.Steps {
+		for _, r := range step.Reports {
+			status := runStatus(r)
+			if r.RunError != "" {
+				status = "run error"
+				failures = append(failures, fmt.Sprintf("%s / %s: %s", step.Name, reportName(r), r.RunError))
+			}
+			mark := ":white_check_mark:"
+			if status != "passed" {
+				mark = ":x:"
+			}
+			if r.Interrupted {
+				mark = ":warning:"
+			}
+			for _, f := range rep.reportFailures(r) {
+				failures = append(failures, fmt.Sprintf("%s / %s: %s", step.Name, reportName(r), f))
+			}
+			if len(r.Metrics) == 0 {
+				fmt.Fprintf(out, "| %s | %s | | | | | | | | | %s %s |\n", step.Name, reportName(r), mark, status)
+				continue
+			}
+			for _, label := range sortedLabels(r) {
+				m := r.Metrics[label]
+				fmt.Fprintf(out, "| %s | %s | %s | %d | %.2f | %.2f%% | %.2f | %.2f | %.2f | %d | %s %s |\n",
+					step.Name, reportName(r), label, m.Requests, m.Rate, m.Success*100,
+					latencyMs(m.Latencies.P50), latencyMs(m.Latencies.P95), latencyMs(m.Latencies.P99),
+					len(m.Errors), mark, status)
+			}
+		}
+	}
+	if len(failures) != 0 {
+		fmt.Fprint(out, "\n### Failures\n\n")
+		for _, f := range failures {
+			fmt.Fprintf(out, "- %s\n", f)
+		}
+	}
+}
+
+// StoreCIReports writes junit xml report and markdown summary to run dir, copies of the latest run are kept
+// in report dir root for ci, summary is also appended to github actions job summary if available
+func (m *LoadManager) StoreCIReports() {
+	rep := m.SuiteReport()
+	createDirIfNotExists(m.RunDir())
+	var junit bytes.Buffer
+	if err := WriteJUnitReport(&junit, rep); err != nil {
+		log.Errorf("failed to render junit report: %s", err)
+	} else {
+		m.storeCIFile(JUnitReportFile, junit.Bytes())
+	}
+	var summary bytes.Buffer
+	WriteMarkdownSummary(&summary, rep)
+	m.storeCIFile(MarkdownSummaryFile, summary.Bytes())
+	if stepSummary := os.Getenv(githubStepSummaryEnv); stepSummary != "" {
+		f, err := os.OpenFile(stepSummary, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Errorf("failed to open job summary: %s", err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.Write(summary.Bytes()); err != nil {
+			log.Errorf("failed to write job summary: %s", err)
+		}
+	}
+}
+
+func (m *LoadManager) storeCIFile(name string, data []byte) {
+	for _, p := range []string{filepath.Join(m.RunDir(), name), filepath.Join(m.ReportDir, name)} {
+		if err := writeFileAtomic(p, data); err != nil {
+			log.Errorf("failed to write %s: %s", p, err)
+			return
+		}
+	}
+	log.Infof("%s is written to %s", name, m.RunDir())
+}
+
+// ExitCode suite exit code: interrupted, infra error when any handle failed to run or was generator-bound
+// and saturation.fail_run is set, performance failure when stop checks fired, max rps validation failed,
+// results degraded or handles have errors
+func (m *LoadManager) ExitCode() int {
+	if m.Interrupted {
+		return ExitInterrupted
+	}
+	for _, r := range m.runReports {
+		if r.RunError != "" {
+			return ExitInfraError
+		}
+	}
+	// results of generator-bound run are not trusted, so it is not a performance verdict
+	if m.GeneratorConfig != nil && m.GeneratorConfig.Saturation.FailRun {
+		for _, r := range m.runReports {
+			if r.GeneratorBound {
+				return ExitInfraError
+			}
+		}
+	}
+	performance := m.Failed || m.ValidationFailed || m.Degradation
+	for _, r := range m.runReports {
+		// interrupted handle errors are requests canceled by the stop
+		if r.Interrupted {
+			continue
+		}
+		if hasErrors(r) {
+			performance = true
+		}
+	}
+	if performance {
+		return ExitPerformanceFailure
+	}
+	return ExitOK
+}
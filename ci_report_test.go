@@ -0,0 +1,173 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCIManager() *LoadManager {
+	m := testRegressionManager("")
+	m.Steps = []RunStep{{Name: "steady", ExecutionMode: "sequence"}}
+	ok := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	ok.Step = "steady"
+	ok.Configuration.HandleName = "first"
+	failed := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 0.5, 100)
+	failed.Step = "steady"
+	failed.Configuration.HandleName = "second"
+	failed.Metrics["first"].Errors = []string{"timeout"}
+	interrupted := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	interrupted.Step = "steady"
+	interrupted.Configuration.HandleName = "third"
+	interrupted.Interrupted = true
+	m.runReports = []*RunReport{ok, failed, interrupted}
+	return m
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	m := testCIManager()
+	m.runReports = append(m.runReports, &RunReport{
+		Step:          "steady",
+		Configuration: RunnerConfig{HandleName: "fourth"},
+		RunError:      "connection refused",
+	})
+	var out bytes.Buffer
+	if err := WriteJUnitReport(&out, m.SuiteReport()); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 4 || suites.Failures != 1 || suites.Errors != 1 || suites.Skipped != 1 {
+		t.Fatalf("unexpected totals: %+v", suites)
+	}
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure != nil || cases[1].Failure == nil || cases[1].Failure.Message != "error in first: timeout" {
+		t.Fatalf("unexpected failures: %+v", cases)
+	}
+	if cases[2].Skipped == nil || cases[3].Error == nil {
+		t.Fatalf("unexpected skipped or errors: %+v", cases)
+	}
+	found := false
+	for _, p := range cases[0].Properties {
+		if p.Name == "first.p50_ms" && p.Value == "100.00" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no p50 property: %+v", cases[0].Properties)
+	}
+}
+
+func TestWriteMarkdownSummary(t *testing.T) {
+	var out bytes.Buffer
+	WriteMarkdownSummary(&out, testCIManager().SuiteReport())
+	for _, expected := range []string{
+		"| steady | first | first | 0 | 100.00 | 100.00% | 100.00 | 100.00 | 200.00 | 0 | :white_check_mark: passed |",
+		":x: errors",
+		":warning: interrupted",
+		"- steady / second: error in first: timeout",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("summary has no %q:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	m := testCIManager()
+	if code := m.ExitCode(); code != ExitPerformanceFailure {
+		t.Fatalf("expected performance failure, got %d", code)
+	}
+	m.runReports[1].Metrics["first"].Errors = nil
+	m.runReports[2].Metrics["first"].Errors = []string{"context canceled"}
+	if code := m.ExitCode(); code != ExitOK {
+		t.Fatalf("expected ok, got %d", code)
+	}
+	m.Degradation = true
+	if code := m.ExitCode(); code != ExitPerformanceFailure {
+		t.Fatalf("expected performance failure, got %d", code)
+	}
+	m.runReports[0].RunError = "failed to run"
+	if code := m.ExitCode(); code != ExitInfraError {
+		t.Fatalf("expected infra error, got %d", code)
+	}
+	m.Interrupted = true
+	if code := m.ExitCode(); code != ExitInterrupted {
+		t.Fatalf("expected interrupted, got %d", code)
+	}
+}
+
+// beforeRunFailMock attack which can't be prepared for a run
+type beforeRunFailMock struct {
+	attackMock
+}
+
+func (m *beforeRunFailMock) BeforeRun(c RunnerConfig) error {
+	return errors.New("no connection to target")
+}
+
+func TestBeforeRunFailure(t *testing.T) {
+	setupLogger("console", "error")
+	m := &LoadManager{
+		GeneratorConfig: &GeneratorConfig{},
+		CsvMu:           &sync.Mutex{},
+		Reports:         make(map[string]*RunReport),
+		controlMu:       &sync.RWMutex{},
+		stopping:        &AtomicBool{},
+		skipStep:        &AtomicBool{},
+	}
+	r := NewRunner("first", m, &beforeRunFailMock{}, nil, RunnerConfig{
+		HandleName:     "first",
+		RPS:            10,
+		AttackTimeSec:  30,
+		RampUpTimeSec:  1,
+		RampUpStrategy: linearRampupStrategy,
+		MaxAttackers:   1,
+		DoTimeoutSec:   1,
+	})
+	r.step = "steady"
+	m.Steps = []RunStep{{Name: "steady", ExecutionMode: SequenceMode, Runners: []*Runner{r}}}
+	m.setCurrentStep(0)
+	r.Run(nil, m)
+
+	rep := m.Reports[reportKey("steady", "first", false)]
+	if rep == nil || !rep.Failed || !strings.Contains(rep.RunError, "no connection to target") {
+		t.Fatalf("report must have run error: %+v", rep)
+	}
+	if code := m.ExitCode(); code != ExitInfraError {
+		t.Fatalf("expected infra error, got %d", code)
+	}
+	var out bytes.Buffer
+	if err := WriteJUnitReport(&out, m.SuiteReport()); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Errors != 1 || suites.Suites[0].Cases[0].Error == nil || suites.Suites[0].Cases[0].Error.Type != "run_error" {
+		t.Fatalf("run error is not reported: %+v", suites)
+	}
+}
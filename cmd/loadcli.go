@@ -18,8 +18,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -125,21 +127,191 @@ func main() {
 				Name:    "run",
 				Aliases: []string{"r"},
 				Usage:   "run load test suite",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "run only steps not finished in previous run",
+					},
+					&cli.BoolFlag{
+						Name:  "only-failed",
+						Usage: "run only steps not completed in previous run: failed, interrupted or not started",
+					},
+					&cli.StringFlag{
+						Name:  "ui",
+						Usage: "serve live web ui on address, ex.: :8089",
+					},
+					&cli.DurationFlag{
+						Name:  "ui-wait",
+						Value: time.Minute,
+						Usage: "keep web ui running after the suite until html report is fetched, at most for duration",
+					},
+					&cli.BoolFlag{
+						Name:  "tui",
+						Usage: "show live terminal dashboard of the current step",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					suiteCfg := c.Args().Get(0)
 					if suiteCfg == "" {
 						log.Fatal("path to load suite config must be specified")
 					}
-					loadgen.RunSuiteCommand(suiteCfg)
+					args := make([]string, 0)
+					if c.Bool("resume") {
+						args = append(args, "-resume")
+					}
+					if c.Bool("only-failed") {
+						args = append(args, "-only-failed")
+					}
+					if addr := c.String("ui"); addr != "" {
+						args = append(args, "-ui", addr, "-ui_wait", c.Duration("ui-wait").String())
+					}
+					if c.Bool("tui") {
+						args = append(args, "-tui")
+					}
+					loadgen.RunSuiteCommand(suiteCfg, args...)
+					return nil
+				},
+			},
+			{
+				Name:    "validate",
+				Aliases: []string{"v"},
+				Usage:   "validate generator config and suite config, ex.: loadcli validate suite.yaml",
+				Action: func(c *cli.Context) error {
+					// generator config is already validated on startup
+					suiteCfg := c.Args().Get(0)
+					if suiteCfg == "" {
+						log.Printf("generator config is valid")
+						return nil
+					}
+					errs := loadgen.ValidateSuiteConfigFile(suiteCfg)
+					for _, e := range errs {
+						fmt.Println(e)
+					}
+					if len(errs) != 0 {
+						log.Fatalf("suite config is invalid, found %d problems", len(errs))
+					}
+					log.Printf("suite config is valid")
+					return nil
+				},
+			},
+			{
+				Name:    "plan",
+				Aliases: []string{"p"},
+				Usage:   "print expected load profile of a suite without attacking, ex.: loadcli plan suite.yaml --chart plan.png",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "chart",
+						Usage: "render expected rps over time chart, .png or .svg",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					suiteCfg := c.Args().Get(0)
+					if suiteCfg == "" {
+						log.Fatal("path to load suite config must be specified")
+					}
+					loadgen.PlanSuiteCommand(suiteCfg, c.String("chart"))
+					return nil
+				},
+			},
+			{
+				Name:  "ctl",
+				Usage: "control running suite, ex.: loadcli ctl list | pause h | resume h | rps h 100 | attackers h 50 | stop [h] | next",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "generator control api address, default is control.listen from generator config",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					addr := c.String("addr")
+					if addr == "" {
+						addr = cfg.Control.Listen
+					}
+					if addr == "" {
+						log.Fatal("provide control api address with --addr or control.listen in generator config")
+					}
+					loadgen.ControlCommand(addr, c.Args().Slice())
+					return nil
+				},
+			},
+			{
+				Name:  "compare",
+				Usage: "compare run reports side by side, the first one is a baseline, ex.: loadcli compare a.json b.json",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: loadgen.CompareFormatText,
+						Usage: "output format: text, markdown or json",
+					},
+					&cli.BoolFlag{
+						Name:  "no-color",
+						Usage: "do not color regressions in text output",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					loadgen.CompareCommand(c.Args().Slice(), c.String("format"), !c.Bool("no-color"), cfg)
+					return nil
+				},
+			},
+			{
+				Name:  "report",
+				Usage: "recompute metrics from results log, ex.: loadcli report --from 1m --label get reports/runs/<id>/results.jsonl",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "skip results before, offset from the first result of every handle run (1m) or RFC3339 time",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "skip results after, offset from the first result of every handle run (5m) or RFC3339 time",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "only results of label, may be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "handle",
+						Usage: "only results of handle, may be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "step",
+						Usage: "only results of step, may be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "output format: text or json",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						log.Fatal("provide path to results log, ex.: loadcli report results.jsonl")
+					}
+					filter := loadgen.ResultLogFilter{
+						Labels:  c.StringSlice("label"),
+						Handles: c.StringSlice("handle"),
+						Steps:   c.StringSlice("step"),
+					}
+					loadgen.ReportCommand(c.Args().First(), c.String("from"), c.String("to"), filter, c.String("format"), cfg)
 					return nil
 				},
 			},
 			{
 				Name:    "dashboard",
 				Aliases: []string{"d"},
-				Usage:   "regenerate & upload grafana dashboard",
+				Usage:   "regenerate & upload grafana dashboards of suite steps, or write them with provisioning files, ex.: loadcli dashboard --out grafana/ suite.yaml",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "dir to write dashboards and grafana provisioning files to, dashboards are not uploaded unless --upload is set",
+					},
+					&cli.BoolFlag{
+						Name:  "upload",
+						Usage: "upload dashboards to grafana when --out is set",
+					},
+				},
 				Action: func(c *cli.Context) error {
-					loadgen.UploadGrafanaDashboard()
+					loadgen.DashboardCommand(c.Args().First(), c.String("out"), c.Bool("upload"))
 					return nil
 				},
 			},
@@ -29,6 +29,10 @@ import (
 	"strings"
 )
 
+const (
+	labelsPath = "%s/labels.go"
+)
+
 var (
 	attackerLabelRe        = regexp.MustCompile("(.*) = (.*)")
 	runConfigsDir          = "run_configs"
@@ -42,9 +42,14 @@ func BuildSuiteCommand(testDir string, platform string) {
 	}
 }
 
-func RunSuiteCommand(cfgPath string) {
-	cmd := exec.Command(suiteBinaryName, "-config", cfgPath)
+func RunSuiteCommand(cfgPath string, args ...string) {
+	cmd := exec.Command(suiteBinaryName, append([]string{"-config", cfgPath}, args...)...)
 	res, err := cmd.CombinedOutput()
+	// suite exit code tells infra errors from performance failures, so it is passed through
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		log.Errorf("suite failed: out:%s err: %s\n", res, err)
+		os.Exit(exitErr.ExitCode())
+	}
 	if err != nil {
 		log.Fatalf("failed to run suite: out:%s err: %s\n", res, err)
 	}
@@ -0,0 +1,377 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Compare output formats
+const (
+	CompareFormatText     = "text"
+	CompareFormatMarkdown = "markdown"
+	CompareFormatJSON     = "json"
+)
+
+// Comparison verdicts of a value compared to the first report
+const (
+	verdictSame      = "same"
+	verdictBetter    = "better"
+	verdictWorse     = "worse"
+	verdictRegressed = "regressed"
+)
+
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// compareMetric metric row of comparison table
+type compareMetric struct {
+	name string
+	// regression metric used to check thresholds, empty if there is no threshold for it
+	regression string
+	// higherIsWorse direction of the metric
+	higherIsWorse bool
+	// points delta is shown in percentage points instead of percents
+	points bool
+	value  func(m *Metrics) float64
+	format string
+}
+
+func latencyMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+var compareMetrics = []compareMetric{
+	{name: "requests", value: func(m *Metrics) float64 { return float64(m.Requests) }, format: "%.0f"},
+	{name: "rate", regression: MetricThroughput, value: func(m *Metrics) float64 { return m.Rate }, format: "%.2f"},
+	{name: "success %", regression: MetricErrorRate, points: true, value: func(m *Metrics) float64 { return m.Success * 100 }, format: "%.2f"},
+	{name: "mean ms", higherIsWorse: true, value: func(m *Metrics) float64 { return latencyMs(m.Latencies.Mean) }, format: "%.2f"},
+	{name: "p50 ms", regression: MetricP50, higherIsWorse: true, value: func(m *Metrics) float64 { return latencyMs(m.Latencies.P50) }, format: "%.2f"},
+	{name: "p95 ms", regression: MetricP95, higherIsWorse: true, value: func(m *Metrics) float64 { return latencyMs(m.Latencies.P95) }, format: "%.2f"},
+	{name: "p99 ms", regression: MetricP99, higherIsWorse: true, value: func(m *Metrics) float64 { return latencyMs(m.Latencies.P99) }, format: "%.2f"},
+	{name: "max ms", higherIsWorse: true, value: func(m *Metrics) float64 { return latencyMs(m.Latencies.Max) }, format: "%.2f"},
+	{name: "errors", higherIsWorse: true, value: func(m *Metrics) float64 { return float64(len(m.Errors)) }, format: "%.0f"},
+}
+
+// ComparisonRow one metric of a label in every report
+type ComparisonRow struct {
+	Metric string `json:"metric"`
+	// Values are nil for reports without the label
+	Values []*float64 `json:"values"`
+	// Deltas change compared to the first report, percents or percentage points for success
+	Deltas []*float64 `json:"deltas"`
+	// Verdicts same | better | worse | regressed compared to the first report
+	Verdicts []string `json:"verdicts"`
+	format   string
+	points   bool
+}
+
+// LabelComparison comparison table of a label
+type LabelComparison struct {
+	Handle string          `json:"handle"`
+	Label  string          `json:"label"`
+	Rows   []ComparisonRow `json:"rows"`
+	// Errors unique errors of every report
+	Errors [][]string `json:"errors"`
+}
+
+func (lc LabelComparison) title() string {
+	if lc.Handle == "" || lc.Handle == lc.Label {
+		return lc.Label
+	}
+	return fmt.Sprintf("%s (handle %s)", lc.Label, lc.Handle)
+}
+
+// ReportComparison side by side comparison of run reports, the first one is a baseline
+type ReportComparison struct {
+	Reports []string          `json:"reports"`
+	Labels  []LabelComparison `json:"labels"`
+	// Regressed is set when any value regressed over configured thresholds compared to the first report
+	Regressed bool `json:"regressed"`
+}
+
+// NewReportComparison compares reports to the first one, thresholds from generator config are used to mark regressions
+func NewReportComparison(names []string, reports []*RunReport, cfg *GeneratorConfig) *ReportComparison {
+	lm := &LoadManager{GeneratorConfig: cfg}
+	c := &ReportComparison{Reports: names}
+	labels := make([]string, 0)
+	seen := make(map[string]string)
+	for _, rep := range reports {
+		for label := range rep.Metrics {
+			if _, ok := seen[label]; !ok {
+				seen[label] = rep.Configuration.HandleName
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		lc := LabelComparison{Handle: seen[label], Label: label}
+		t := lm.thresholdFor(lc.Handle, label)
+		for _, cm := range compareMetrics {
+			row := ComparisonRow{Metric: cm.name, format: cm.format, points: cm.points}
+			for i, rep := range reports {
+				m, ok := rep.Metrics[label]
+				if !ok {
+					row.Values = append(row.Values, nil)
+					row.Deltas = append(row.Deltas, nil)
+					row.Verdicts = append(row.Verdicts, "")
+					continue
+				}
+				v := cm.value(m)
+				row.Values = append(row.Values, &v)
+				base := row.Values[0]
+				if i == 0 || base == nil {
+					row.Deltas = append(row.Deltas, nil)
+					row.Verdicts = append(row.Verdicts, "")
+					continue
+				}
+				var delta float64
+				if cm.points {
+					delta = v - *base
+				} else if *base != 0 {
+					delta = (v/(*base) - 1) * 100
+				}
+				row.Deltas = append(row.Deltas, &delta)
+				verdict := compareVerdict(cm, delta)
+				if cm.regression != "" && verdict == verdictWorse {
+					baseValue := metricValue(reports[0].Metrics[label], cm.regression)
+					if threshold := thresholdValue(t, cm.regression); threshold != 0 && regressed(cm.regression, baseValue, metricValue(m, cm.regression), threshold) {
+						verdict = verdictRegressed
+						c.Regressed = true
+					}
+				}
+				row.Verdicts = append(row.Verdicts, verdict)
+			}
+			lc.Rows = append(lc.Rows, row)
+		}
+		for _, rep := range reports {
+			if m, ok := rep.Metrics[label]; ok {
+				lc.Errors = append(lc.Errors, m.Errors)
+			} else {
+				lc.Errors = append(lc.Errors, nil)
+			}
+		}
+		lc.Rows = append(lc.Rows, statusCodeRows(label, reports)...)
+		c.Labels = append(c.Labels, lc)
+	}
+	return c
+}
+
+func compareVerdict(cm compareMetric, delta float64) string {
+	if delta == 0 || (!cm.higherIsWorse && cm.regression == "") {
+		return verdictSame
+	}
+	worse := delta > 0
+	if !cm.higherIsWorse {
+		worse = delta < 0
+	}
+	if worse {
+		return verdictWorse
+	}
+	return verdictBetter
+}
+
+// statusCodeRows count of every status code seen in any report
+func statusCodeRows(label string, reports []*RunReport) []ComparisonRow {
+	codes := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, rep := range reports {
+		if m, ok := rep.Metrics[label]; ok {
+			for code := range m.StatusCodes {
+				if !seen[code] {
+					seen[code] = true
+					codes = append(codes, code)
+				}
+			}
+		}
+	}
+	sort.Strings(codes)
+	rows := make([]ComparisonRow, 0, len(codes))
+	for _, code := range codes {
+		row := ComparisonRow{Metric: "status " + code, format: "%.0f"}
+		for i, rep := range reports {
+			m, ok := rep.Metrics[label]
+			if !ok {
+				row.Values = append(row.Values, nil)
+				row.Deltas = append(row.Deltas, nil)
+				row.Verdicts = append(row.Verdicts, "")
+				continue
+			}
+			v := float64(m.StatusCodes[code])
+			row.Values = append(row.Values, &v)
+			if i == 0 || row.Values[0] == nil || *row.Values[0] == 0 {
+				row.Deltas = append(row.Deltas, nil)
+				row.Verdicts = append(row.Verdicts, "")
+				continue
+			}
+			delta := (v/(*row.Values[0]) - 1) * 100
+			row.Deltas = append(row.Deltas, &delta)
+			row.Verdicts = append(row.Verdicts, verdictSame)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// cell formatted value with delta
+func (r ComparisonRow) cell(i int) string {
+	if r.Values[i] == nil {
+		return "-"
+	}
+	v := fmt.Sprintf(r.format, *r.Values[i])
+	if r.Deltas[i] == nil {
+		return v
+	}
+	if r.points {
+		return fmt.Sprintf("%s (%+.2fpp)", v, *r.Deltas[i])
+	}
+	return fmt.Sprintf("%s (%+.1f%%)", v, *r.Deltas[i])
+}
+
+func colorize(s string, verdict string) string {
+	switch verdict {
+	case verdictRegressed:
+		return ansiRed + s + ansiReset
+	case verdictWorse:
+		return ansiYellow + s + ansiReset
+	case verdictBetter:
+		return ansiGreen + s + ansiReset
+	}
+	return s
+}
+
+// WriteText writes comparison tables, regressions are red, other worse values are yellow, better are green
+func (c *ReportComparison) WriteText(out io.Writer, color bool) {
+	for _, lc := range c.Labels {
+		fmt.Fprintf(out, "\nlabel: %s\n", lc.title())
+		// columns are padded by hand, color escape codes would break tabwriter alignment
+		table := [][]string{append([]string{"METRIC"}, c.Reports...)}
+		for _, r := range lc.Rows {
+			line := []string{r.Metric}
+			for i := range c.Reports {
+				line = append(line, r.cell(i))
+			}
+			table = append(table, line)
+		}
+		widths := make([]int, len(c.Reports)+1)
+		for _, line := range table {
+			for i, cell := range line {
+				if len(cell) > widths[i] {
+					widths[i] = len(cell)
+				}
+			}
+		}
+		for n, line := range table {
+			cells := make([]string, 0, len(line))
+			for i, cell := range line {
+				cell = fmt.Sprintf("%-*s", widths[i], cell)
+				if color && n > 0 && i > 0 {
+					cell = colorize(cell, lc.Rows[n-1].Verdicts[i-1])
+				}
+				cells = append(cells, cell)
+			}
+			fmt.Fprintln(out, strings.TrimRight(strings.Join(cells, "  "), " "))
+		}
+		for i, errs := range lc.Errors {
+			for _, e := range errs {
+				fmt.Fprintf(out, "  error in %s: %s\n", c.Reports[i], e)
+			}
+		}
+	}
+	if c.Regressed {
+		fmt.Fprintln(out, "\nregressions found compared to", c.Reports[0])
+	}
+}
+
+// WriteMarkdown writes comparison tables in markdown, regressions are marked bold with a cross
+func (c *ReportComparison) WriteMarkdown(out io.Writer) {
+	for _, lc := range c.Labels {
+		fmt.Fprintf(out, "\n#### %s\n\n", lc.title())
+		fmt.Fprintf(out, "| metric | %s |\n", strings.Join(c.Reports, " | "))
+		fmt.Fprintf(out, "|---|%s\n", strings.Repeat("---|", len(c.Reports)))
+		for _, r := range lc.Rows {
+			cells := make([]string, 0, len(c.Reports))
+			for i := range c.Reports {
+				cell := r.cell(i)
+				if r.Verdicts[i] == verdictRegressed {
+					cell = fmt.Sprintf("**%s** :x:", cell)
+				}
+				cells = append(cells, cell)
+			}
+			fmt.Fprintf(out, "| %s | %s |\n", r.Metric, strings.Join(cells, " | "))
+		}
+		for i, errs := range lc.Errors {
+			for _, e := range errs {
+				fmt.Fprintf(out, "\n- error in `%s`: `%s`", c.Reports[i], e)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	if c.Regressed {
+		fmt.Fprintf(out, "\n**regressions found compared to %s**\n", c.Reports[0])
+	}
+}
+
+// WriteJSON writes comparison as json
+func (c *ReportComparison) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(c)
+}
+
+// CompareCommand prints side by side comparison of reports, the first one is a baseline
+func CompareCommand(paths []string, format string, color bool, cfg *GeneratorConfig) *ReportComparison {
+	if len(paths) < 2 {
+		log.Fatal("provide at least two reports to compare")
+	}
+	reports := make([]*RunReport, 0, len(paths))
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rep, err := readRunReport(p)
+		if err != nil {
+			log.Fatalf("failed to read report %s: %s", p, err)
+		}
+		reports = append(reports, rep)
+		names = append(names, filepath.Base(p))
+	}
+	c := NewReportComparison(names, reports, cfg)
+	switch format {
+	case CompareFormatMarkdown:
+		c.WriteMarkdown(os.Stdout)
+	case CompareFormatJSON:
+		if err := c.WriteJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case CompareFormatText, "":
+		c.WriteText(os.Stdout, color)
+	default:
+		log.Fatalf("unknown output format: %s, use text, markdown or json", format)
+	}
+	return c
+}
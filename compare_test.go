@@ -0,0 +1,64 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportComparison(t *testing.T) {
+	m := testRegressionManager("")
+	base := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	base.Metrics["first"].StatusCodes = map[string]int{"200": 10}
+	slower := testRegressionReport(130*time.Millisecond, 200*time.Millisecond, 1, 100)
+	slower.Metrics["first"].StatusCodes = map[string]int{"200": 9, "500": 1}
+	slower.Metrics["first"].Errors = []string{"internal error"}
+	c := NewReportComparison([]string{"a.json", "b.json"}, []*RunReport{base, slower}, m.GeneratorConfig)
+	if !c.Regressed {
+		t.Fatal("expected p50 regression")
+	}
+
+	var text bytes.Buffer
+	c.WriteText(&text, false)
+	for _, expected := range []string{"p50 ms", "130.00 (+30.0%)", "status 500", "error in b.json: internal error"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("text output has no %q:\n%s", expected, text.String())
+		}
+	}
+
+	var md bytes.Buffer
+	c.WriteMarkdown(&md)
+	if !strings.Contains(md.String(), "| p50 ms | 100.00 | **130.00 (+30.0%)** :x: |") {
+		t.Errorf("markdown output has no p50 regression:\n%s", md.String())
+	}
+
+	var js bytes.Buffer
+	if err := c.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ReportComparison
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Regressed || len(decoded.Labels) != 1 {
+		t.Errorf("unexpected json output:\n%s", js.String())
+	}
+}
@@ -19,6 +19,7 @@ package loadgen
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
@@ -49,7 +50,24 @@ var (
 	oDoTimeout      = flag.Int(fDoTimeout, 5, "timeout in seconds for each attack call")
 )
 
-var fullAttackStartedAt time.Time
+// MetricsSinkConfig live metrics backend
+type MetricsSinkConfig struct {
+	// Type sink type: graphite | statsd | influxdb | otlp
+	Type string `mapstructure:"type"`
+	// URL backend address: host:port for graphite and statsd, udp://host:port or http(s)://host:port for influxdb,
+	// http(s)://host:port for otlp collector
+	URL string `mapstructure:"url"`
+	// Prefix metrics name prefix
+	Prefix string `mapstructure:"prefix"`
+	// FlushIntervalSec metrics are sent every interval, default is 1
+	FlushIntervalSec int `mapstructure:"flush_interval_sec"`
+	// Database influxdb database, required for http
+	Database string `mapstructure:"database"`
+	// Token influxdb token
+	Token string `mapstructure:"token"`
+	// Headers otlp request headers, ex.: authorization
+	Headers map[string]string `mapstructure:"headers"`
+}
 
 // Prometheus prometheus config
 type Prometheus struct {
@@ -79,7 +97,7 @@ type GeneratorConfig struct {
 		RemoteRootDir string `mapstructure:"remote_root_dir"`
 		// KeyPath path to ssh pub key
 		KeyPath string `mapstructure:"key_path"`
-	}
+	} `mapstructure:"remotes"`
 	// Generator generator specific config
 	Generator struct {
 		// Target base url to attack
@@ -101,6 +119,18 @@ type GeneratorConfig struct {
 		Login string `mapstructure:"login"`
 		// Password password
 		Password string `mapstructure:"password"`
+		// Token api token, used instead of login and password if set
+		Token string `mapstructure:"token"`
+		// Folder dashboards folder, created if missing, default is General
+		Folder string `mapstructure:"folder"`
+		// Annotations post annotations when steps start and finish, stages change, validation begins and stop checks fire
+		Annotations bool `mapstructure:"annotations"`
+		// Datasource type of generated dashboards datasource: graphite | prometheus | influxdb, default is graphite
+		Datasource string `mapstructure:"datasource"`
+		// DatasourceName name of the datasource in grafana, default is Local <type>, ex.: Local Graphite
+		DatasourceName string `mapstructure:"datasource_name"`
+		// DatasourceURL datasource url in provisioning files, ex.: http://prometheus:9090
+		DatasourceURL string `mapstructure:"datasource_url"`
 	} `mapstructure:"grafana"`
 	// Graphite related config
 	Graphite struct {
@@ -112,6 +142,69 @@ type GeneratorConfig struct {
 		LoadGeneratorPrefix string `mapstructure:"loadGeneratorPrefix"`
 	} `mapstructure:"graphite"`
 	Prometheus *Prometheus `mapstructure:"prometheus"`
+	// Sinks live metrics backends, graphite config above is used as graphite sink too
+	Sinks []MetricsSinkConfig `mapstructure:"sinks"`
+	// ResultsPush export of final run results for long term trends
+	ResultsPush struct {
+		// Pushgateway base url of prometheus pushgateway, ex.: http://pushgateway:9091
+		Pushgateway string `mapstructure:"pushgateway"`
+		// RemoteWrite prometheus remote write url, ex.: http://prometheus:9090/api/v1/write
+		RemoteWrite string `mapstructure:"remote_write"`
+		// Job pushgateway job and job label, default is loadgen
+		Job string `mapstructure:"job"`
+		// Labels added to every result, ex.: env: staging
+		Labels map[string]string `mapstructure:"labels"`
+		// Headers request headers, ex.: authorization
+		Headers map[string]string `mapstructure:"headers"`
+	} `mapstructure:"results_push"`
+	// Control runtime control api config
+	Control struct {
+		// Listen address of local http control api, ex.: 127.0.0.1:9101, api is disabled if empty
+		Listen string `mapstructure:"listen"`
+	} `mapstructure:"control"`
+	// PrometheusExporter generator metrics endpoint for prometheus
+	PrometheusExporter struct {
+		// Listen address of GET /metrics endpoint, ex.: 0.0.0.0:9102, endpoint is disabled if empty
+		Listen string `mapstructure:"listen"`
+		// Buckets latency histogram buckets in seconds, default is DefaultLatencyBuckets
+		Buckets []float64 `mapstructure:"buckets"`
+	} `mapstructure:"prometheus_exporter"`
+	// Reports run reports storage config
+	Reports struct {
+		// Dir reports dir, every run is stored in runs/<run id> subdir, default is example_loadtest/reports
+		Dir string `mapstructure:"dir"`
+		// ResultsLog writes every request result to results.jsonl in run dir, see loadcli report
+		ResultsLog bool `mapstructure:"results_log"`
+		// LabelManifest records labels seen in runs to <suite>.labels.json in reports dir, dashboards get panels of these labels
+		LabelManifest bool `mapstructure:"label_manifest"`
+	} `mapstructure:"reports"`
+	// Errors request errors reporting config
+	Errors struct {
+		// Normalize rules to mask variable parts of error messages, applied before default rules
+		Normalize []ErrorNormalizationRule `mapstructure:"normalize"`
+	} `mapstructure:"errors"`
+	// Saturation generator self-saturation detection
+	Saturation SaturationConfig `mapstructure:"saturation"`
+	// Checks CI checks config
+	Checks struct {
+		// Skip disables errors and degradation checks after suite run, reports are stored anyway
+		Skip bool `mapstructure:"skip"`
+		// HandleThresholdPercent p50 ratio to last successful run to fail the handle, ex.: 1.2
+		HandleThresholdPercent float64 `mapstructure:"handle_threshold_percent"`
+		// Baseline selects reports current run is compared to
+		Baseline BaselineConfig `mapstructure:"baseline"`
+		// Thresholds per handle and per label regression thresholds, the most specific match wins
+		Thresholds []RegressionThreshold `mapstructure:"thresholds"`
+		// Significance latency regression is reported only if it is statistically significant
+		Significance struct {
+			// Method significance test, ex.: mann_whitney | bootstrap, empty disables the test
+			Method string `mapstructure:"method"`
+			// Alpha significance level, default is 0.05
+			Alpha float64 `mapstructure:"alpha"`
+		} `mapstructure:"significance"`
+	} `mapstructure:"checks"`
+	// RootPackageName root package name used in generated load test imports
+	RootPackageName string `mapstructure:"root_package_name"`
 	// LoadScriptsDir relative from cwd load dir path, ex.: load
 	LoadScriptsDir string `mapstructure:"load_scripts_dir"`
 	// Timezone timezone used for grafana url, ex.: Europe/Moscow
@@ -128,24 +221,33 @@ type GeneratorConfig struct {
 func LoadDefaultGeneratorConfig(cfgPath string) *GeneratorConfig {
 	viper.SetConfigType("yaml")
 	viper.SetConfigFile(cfgPath)
+	// logger is configured from this file, so problems are printed directly
 	err := viper.MergeInConfig()
 	if err != nil {
-		log.Fatalf("Failed to readIn viper: %s\n", err)
+		fmt.Printf("Failed to readIn viper: %s\n", err)
+		os.Exit(ExitConfigError)
+	}
+	if errs := ValidateGeneratorConfigFile(cfgPath); len(errs) != 0 {
+		for _, e := range errs {
+			fmt.Println("a configuration error was found", e)
+		}
+		os.Exit(ExitConfigError)
 	}
 	var defaultGeneratorCfg *GeneratorConfig
 	if err := viper.Unmarshal(&defaultGeneratorCfg); err != nil {
-		log.Fatalf("failed to unmarshal default generator config: %s\n", err)
-	}
-	errs := defaultGeneratorCfg.Validate()
-	if len(errs) != 0 {
-		log.Fatalf("Errors in default suite config validation: %s", errs)
+		fmt.Printf("failed to unmarshal default generator config: %s\n", err)
+		os.Exit(ExitConfigError)
 	}
 	log = NewLogger()
 	return defaultGeneratorCfg
 }
 
+// Validate checks generator settings and returns a list of strings with problems.
 func (c *GeneratorConfig) Validate() (list []string) {
-	return nil
+	for _, p := range c.problems() {
+		list = append(list, p.String())
+	}
+	return
 }
 
 // SuiteConfig suite config
@@ -172,13 +274,64 @@ type Step struct {
 	Handles []RunnerConfig `mapstructure:"handles" yaml:"handles"`
 }
 
+// BaselineConfig baseline for regression checks
+type BaselineConfig struct {
+	// Mode baseline mode, ex.: last_success | median | pinned
+	Mode string `mapstructure:"mode"`
+	// LastN number of last successful runs to compute median baseline from
+	LastN int `mapstructure:"last_n"`
+	// Pinned baseline report path, %s is replaced with report key <step>-<handle>[-validation], ex.: baseline/%s.json
+	Pinned string `mapstructure:"pinned"`
+}
+
+// SaturationConfig thresholds of generator being the bottleneck, a handle is saturated when any of them is exceeded for window_sec,
+// zero values are replaced with defaults
+type SaturationConfig struct {
+	// CPUPercent host cpu used, requires host.collect_metrics, default is 90
+	CPUPercent int64 `mapstructure:"cpu_percent"`
+	// LimiterLagMs average time requests wait for a free attacker after rate limiter released them, default is 100
+	LimiterLagMs int `mapstructure:"limiter_lag_ms"`
+	// GCPauseMs gc pauses per second, default is 100
+	GCPauseMs int `mapstructure:"gc_pause_ms"`
+	// SchedLatencyMs how late a short timer fires when goroutines wait for a free cpu, default is 50
+	SchedLatencyMs int `mapstructure:"sched_latency_ms"`
+	// WindowSec seconds thresholds must be exceeded in a row, default is 5
+	WindowSec int `mapstructure:"window_sec"`
+	// MarkReport marks reports of saturated handles generator-bound, such runs are never baseline or max rps
+	MarkReport bool `mapstructure:"mark_report"`
+	// FailRun exits with infra error when any report is generator-bound, requires mark_report
+	FailRun bool `mapstructure:"fail_run"`
+}
+
+// RegressionThreshold regression thresholds for a handle and label, empty handle or label matches any
+type RegressionThreshold struct {
+	Handle string `mapstructure:"handle"`
+	Label  string `mapstructure:"label"`
+	// P50 p50 ratio to baseline to fail, ex.: 1.2
+	P50 float64 `mapstructure:"p50"`
+	// P95 p95 ratio to baseline to fail, ex.: 1.3
+	P95 float64 `mapstructure:"p95"`
+	// P99 p99 ratio to baseline to fail, ex.: 1.5
+	P99 float64 `mapstructure:"p99"`
+	// ErrorRate allowed error rate growth in percentage points, ex.: 0.5
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// Throughput rate ratio to baseline to fail, ex.: 0.9
+	Throughput float64 `mapstructure:"throughput"`
+}
+
+// ErrorNormalizationRule replaces every match of regex pattern in error messages, ex.: pattern: "order \\d+", replace: "order <id>"
+type ErrorNormalizationRule struct {
+	Pattern string `mapstructure:"pattern"`
+	Replace string `mapstructure:"replace"`
+}
+
 // Checks stop criteria checks
 type Checks struct {
 	// Type error check mode, ex.: error | prometheus
 	Type string
 	// Query prometheus bool query
 	Query string
-	// Threshold fail threshold, from 0 to 1, float
+	// Threshold fail threshold, percent of errors for error check, ex.: 5.5
 	Threshold float64
 	// Interval check interval in seconds
 	Interval int
@@ -192,11 +345,27 @@ type Validation struct {
 	Threshold float64 `mapstructure:"threshold" yaml:"threshold"`
 }
 
+// SLOConfig latency and success targets of handle labels
+type SLOConfig struct {
+	// SatisfiedMs apdex T, successful requests not slower are satisfied, ex.: 100
+	SatisfiedMs int `mapstructure:"satisfied_ms" yaml:"satisfied_ms"`
+	// ToleratingMs successful requests not slower are tolerating, slower are frustrated, default is 4 * satisfied_ms
+	ToleratingMs int `mapstructure:"tolerating_ms,omitempty" yaml:"tolerating_ms,omitempty"`
+	// LatencyMs successful requests not slower are within SLO, default is satisfied_ms
+	LatencyMs int `mapstructure:"latency_ms,omitempty" yaml:"latency_ms,omitempty"`
+	// Objective percent of requests within SLO, error budget is the rest, ex.: 99.5
+	Objective float64 `mapstructure:"objective,omitempty" yaml:"objective,omitempty"`
+	// MinApdex run fails if apdex of any label is lower, ex.: 0.9
+	MinApdex float64 `mapstructure:"min_apdex,omitempty" yaml:"min_apdex,omitempty"`
+	// StatusCodes successful status codes, default is any request passed handle success criteria
+	StatusCodes []int `mapstructure:"status_codes,omitempty" yaml:"status_codes,omitempty"`
+}
+
 // RunnerConfig runner config
 type RunnerConfig struct {
 	// WaitBeforeSec debug sleep before starting runner when checking condition is impossible
 	WaitBeforeSec int `mapstructure:"wait_before_sec" yaml:"wait_before_sec"`
-	// HandleName name of a handle, must be the same as test label in labels.go
+	// HandleName name of a handle, results are reported with handle name label, dashboards have panels of it
 	HandleName string `mapstructure:"name" yaml:"name"`
 	// RPS max requests per second limit, load profile depends on AttackTimeSec and RampUpTimeSec
 	RPS int `mapstructure:"rps" yaml:"rps"`
@@ -232,27 +401,19 @@ type RunnerConfig struct {
 	StopIf []Checks `mapstructure:"stop_if" yaml:"stop_if"`
 	// Validation validation config
 	Validation Validation `mapstructure:"validation" yaml:"validation"`
+	// Success success criteria of requests, default is any response without error with status 200-399
+	Success *SuccessConfig `mapstructure:"success,omitempty" yaml:"success,omitempty"`
+	// SLO latency and success targets of every handle label, apdex and slo attainment are not computed if empty
+	SLO *SLOConfig `mapstructure:"slo,omitempty" yaml:"slo,omitempty"`
 
 	// DebugSleep used as a crutch to not affect response time when one need to run test < 1 rps
-	DebugSleep int `mapstructure:"debug_sleep"`
+	DebugSleep int `mapstructure:"debug_sleep" yaml:"debug_sleep,omitempty"`
 }
 
 // Validate checks all settings and returns a list of strings with problems.
 func (c RunnerConfig) Validate() (list []string) {
-	if c.RPS <= 0 {
-		list = append(list, "please set the RPS to a positive number of seconds")
-	}
-	if c.AttackTimeSec < 2 {
-		list = append(list, "please set the attack time to a positive number of seconds > 1")
-	}
-	if c.RampUpTimeSec < 1 {
-		list = append(list, "please set the attack time to a positive number of seconds > 0")
-	}
-	if c.MaxAttackers <= 0 {
-		list = append(list, "please set a positive maximum number of attackers")
-	}
-	if c.DoTimeoutSec <= 0 {
-		list = append(list, "please set the Do() timeout to a positive maximum number of seconds")
+	for _, p := range c.problems() {
+		list = append(list, p.msg)
 	}
 	return
 }
@@ -329,11 +490,20 @@ func LoadSuiteConfig(cfgPath string) *SuiteConfig {
 	viper.SetConfigFile(cfgPath)
 	err := viper.MergeInConfig()
 	if err != nil {
-		log.Fatalf("Failed to readIn viper: %s\n", err)
+		log.Errorf("Failed to readIn viper: %s\n", err)
+		os.Exit(ExitConfigError)
+	}
+	if errs := ValidateSuiteConfigFile(cfgPath); len(errs) != 0 {
+		for _, e := range errs {
+			log.Error(e)
+		}
+		log.Errorf("suite config %s is invalid, found %d problems", cfgPath, len(errs))
+		os.Exit(ExitConfigError)
 	}
 	var suiteCfg *SuiteConfig
 	if err := viper.Unmarshal(&suiteCfg); err != nil {
-		log.Fatalf("failed to unmarshal suite Config: %s\n", err)
+		log.Errorf("failed to unmarshal suite Config: %s\n", err)
+		os.Exit(ExitConfigError)
 	}
 	return suiteCfg
 }
@@ -0,0 +1,677 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	executionModes    = []string{ParallelMode, SequenceMode, SequenceValidateMode}
+	rampupStrategies  = []string{linearRampupStrategy, exp2RampupStrategy}
+	checkTypes        = []string{errorRatioCheckType, prometheusCheckType}
+	logLevels         = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+	logEncodings      = []string{"console", "json"}
+	baselineModes     = []string{lastSuccessBaseline, medianBaseline, pinnedBaseline}
+	significanceTests = []string{mannWhitneySignificance, bootstrapSignificance}
+
+	yamlErrLineRe = regexp.MustCompile(`line (\d+)`)
+)
+
+// ConfigError config problem with its location in a config file
+type ConfigError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// ConfigErrors all problems found in a config file
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, ce := range e {
+		msgs = append(msgs, ce.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// configProblem semantic config problem bound to a dotted key path, ex.: steps.0.handles.1.rps
+type configProblem struct {
+	path string
+	msg  string
+	// ref path of related key, ex.: first definition of a duplicate
+	ref string
+}
+
+func (p configProblem) String() string {
+	msg := p.msg
+	if p.ref != "" {
+		msg = fmt.Sprintf("%s (see %s)", msg, p.ref)
+	}
+	if p.path == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", p.path, msg)
+}
+
+type validatable interface {
+	problems() []configProblem
+}
+
+// ValidateGeneratorConfigFile validates generator config file: unknown keys, value types, enums and settings consistency
+func ValidateGeneratorConfigFile(cfgPath string) ConfigErrors {
+	return validateConfigFile(cfgPath, &GeneratorConfig{})
+}
+
+// ValidateSuiteConfigFile validates suite config file: unknown keys, value types, enums, timings, handle names and csv files
+func ValidateSuiteConfigFile(cfgPath string) ConfigErrors {
+	return validateConfigFile(cfgPath, &SuiteConfig{})
+}
+
+func validateConfigFile(cfgPath string, cfg validatable) ConfigErrors {
+	data, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		return ConfigErrors{{File: cfgPath, Message: err.Error()}}
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return ConfigErrors{{File: cfgPath, Line: yamlErrorLine(err), Message: err.Error()}}
+	}
+	l := &configLocator{file: cfgPath, nodes: map[string]*yaml.Node{"": &root}}
+	errs := l.walk("", &root, reflect.TypeOf(cfg))
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return append(errs, ConfigError{File: cfgPath, Message: err.Error()})
+	}
+	if err := v.Unmarshal(cfg); err != nil {
+		return append(errs, ConfigError{File: cfgPath, Message: err.Error()})
+	}
+	for _, p := range cfg.problems() {
+		errs = append(errs, l.problemError(p))
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
+
+func yamlErrorLine(err error) int {
+	m := yamlErrLineRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// configLocator walks yaml tree against config struct schema and remembers nodes by dotted key path
+type configLocator struct {
+	file  string
+	nodes map[string]*yaml.Node
+}
+
+func (l *configLocator) errorAt(n *yaml.Node, format string, args ...interface{}) ConfigError {
+	return ConfigError{
+		File:    l.file,
+		Line:    n.Line,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// lookup finds node by path, falls back to the closest parent if key is not present in file
+func (l *configLocator) lookup(path string) *yaml.Node {
+	path = strings.ToLower(path)
+	for {
+		if n, ok := l.nodes[path]; ok {
+			return n
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return l.nodes[""]
+		}
+		path = path[:i]
+	}
+}
+
+func (l *configLocator) problemError(p configProblem) ConfigError {
+	msg := p.msg
+	if p.ref != "" {
+		msg = fmt.Sprintf("%s (see line %d)", msg, l.lookup(p.ref).Line)
+	}
+	if p.path != "" {
+		msg = fmt.Sprintf("%s: %s", p.path, msg)
+	}
+	return l.errorAt(l.lookup(p.path), "%s", msg)
+}
+
+func (l *configLocator) walk(path string, n *yaml.Node, t reflect.Type) (errs ConfigErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch n.Kind {
+	case 0:
+		// empty document
+		return nil
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			errs = append(errs, l.walk(path, c, t)...)
+		}
+		return errs
+	case yaml.AliasNode:
+		return l.walk(path, n.Alias, t)
+	}
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return append(errs, l.errorAt(n, "%s: expected a mapping", displayPath(path)))
+		}
+		fields := configFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			name := strings.ToLower(k.Value)
+			p := joinConfigPath(path, name)
+			l.nodes[p] = k
+			f, ok := fields[name]
+			if !ok {
+				errs = append(errs, l.errorAt(k, "unknown key %q%s", joinConfigPath(path, k.Value), didYouMean(k.Value, fields)))
+				continue
+			}
+			errs = append(errs, l.walk(p, v, f.Type)...)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return append(errs, l.errorAt(n, "%s: expected a mapping", displayPath(path)))
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			p := joinConfigPath(path, strings.ToLower(k.Value))
+			l.nodes[p] = k
+			errs = append(errs, l.walk(p, v, t.Elem())...)
+		}
+	case reflect.Slice, reflect.Array:
+		if n.Kind != yaml.SequenceNode {
+			return append(errs, l.errorAt(n, "%s: expected a list", displayPath(path)))
+		}
+		for i, item := range n.Content {
+			p := joinConfigPath(path, strconv.Itoa(i))
+			l.nodes[p] = item
+			errs = append(errs, l.walk(p, item, t.Elem())...)
+		}
+	case reflect.Interface:
+		return nil
+	default:
+		if n.Kind != yaml.ScalarNode {
+			return append(errs, l.errorAt(n, "%s: expected a single value", displayPath(path)))
+		}
+		if msg := checkScalar(n, t); msg != "" {
+			errs = append(errs, l.errorAt(n, "%s: %s", displayPath(path), msg))
+		}
+	}
+	return errs
+}
+
+// checkScalar checks scalar may be decoded into a kind, weak typing is allowed as viper decodes it that way
+func checkScalar(n *yaml.Node, t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseInt(n.Value, 0, 64); err != nil {
+			return fmt.Sprintf("expected an integer, got %q", n.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(n.Value, 64); err != nil {
+			return fmt.Sprintf("expected a number, got %q", n.Value)
+		}
+	case reflect.Bool:
+		if n.ShortTag() == "!!bool" {
+			return ""
+		}
+		if _, err := strconv.ParseBool(n.Value); err != nil {
+			return fmt.Sprintf("expected true or false, got %q", n.Value)
+		}
+	}
+	return ""
+}
+
+// configFields returns struct fields by lowercased mapstructure key, the way viper matches them
+func configFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f
+	}
+	return fields
+}
+
+func didYouMean(key string, fields map[string]reflect.StructField) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	for name := range fields {
+		if norm(name) == norm(key) {
+			return fmt.Sprintf(", did you mean %q?", name)
+		}
+	}
+	return ""
+}
+
+func joinConfigPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
+
+func oneOf(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *GeneratorConfig) problems() (list []configProblem) {
+	if c.Generator.RampUpStrategy != "" && !oneOf(c.Generator.RampUpStrategy, rampupStrategies) {
+		list = append(list, configProblem{
+			path: "generator.ramp_up_strategy",
+			msg:  fmt.Sprintf("unknown ramp up strategy %q, must be one of: %s", c.Generator.RampUpStrategy, strings.Join(rampupStrategies, ", ")),
+		})
+	}
+	if c.ExecutionMode != "" && !oneOf(c.ExecutionMode, executionModes) {
+		list = append(list, configProblem{
+			path: "execution_mode",
+			msg:  fmt.Sprintf("unknown execution mode %q, must be one of: %s", c.ExecutionMode, strings.Join(executionModes, ", ")),
+		})
+	}
+	if c.Logging.Level != "" && !oneOf(c.Logging.Level, logLevels) {
+		list = append(list, configProblem{
+			path: "logging.level",
+			msg:  fmt.Sprintf("unknown log level %q, must be one of: %s", c.Logging.Level, strings.Join(logLevels, ", ")),
+		})
+	}
+	if !oneOf(c.Logging.Encoding, logEncodings) {
+		list = append(list, configProblem{
+			path: "logging.encoding",
+			msg:  fmt.Sprintf("log encoding must be one of: %s, got %q", strings.Join(logEncodings, ", "), c.Logging.Encoding),
+		})
+	}
+	if c.Grafana.Datasource != "" && !oneOf(c.Grafana.Datasource, dashboardDatasources) {
+		list = append(list, configProblem{
+			path: "grafana.datasource",
+			msg:  fmt.Sprintf("dashboard datasource must be one of: %s, got %q", strings.Join(dashboardDatasources, ", "), c.Grafana.Datasource),
+		})
+	}
+	for i, s := range c.Sinks {
+		sp := fmt.Sprintf("sinks.%d", i)
+		if !oneOf(s.Type, sinkTypes) {
+			list = append(list, configProblem{
+				path: sp + ".type",
+				msg:  fmt.Sprintf("unknown metrics sink type %q, must be one of: %s", s.Type, strings.Join(sinkTypes, ", ")),
+			})
+		}
+		if s.URL == "" {
+			list = append(list, configProblem{path: sp + ".url", msg: "please set metrics sink url"})
+		}
+		if s.Type == InfluxDBSinkType && (strings.HasPrefix(s.URL, "http://") || strings.HasPrefix(s.URL, "https://")) && s.Database == "" {
+			list = append(list, configProblem{path: sp + ".database", msg: "database is required for influxdb http api"})
+		}
+		if s.FlushIntervalSec < 0 {
+			list = append(list, configProblem{path: sp + ".flush_interval_sec", msg: "please set flush interval to a positive number of seconds"})
+		}
+	}
+	for _, u := range []struct{ path, url string }{
+		{"results_push.pushgateway", c.ResultsPush.Pushgateway},
+		{"results_push.remote_write", c.ResultsPush.RemoteWrite},
+	} {
+		if u.url != "" && !strings.HasPrefix(u.url, "http://") && !strings.HasPrefix(u.url, "https://") {
+			list = append(list, configProblem{path: u.path, msg: fmt.Sprintf("url must start with http:// or https://, got %q", u.url)})
+		}
+	}
+	for i, b := range c.PrometheusExporter.Buckets {
+		if b <= 0 {
+			list = append(list, configProblem{
+				path: fmt.Sprintf("prometheus_exporter.buckets.%d", i),
+				msg:  fmt.Sprintf("latency bucket must be a positive number of seconds, got %v", b),
+			})
+		}
+	}
+	for _, t := range []struct {
+		path  string
+		value int64
+	}{
+		{"saturation.cpu_percent", c.Saturation.CPUPercent},
+		{"saturation.limiter_lag_ms", int64(c.Saturation.LimiterLagMs)},
+		{"saturation.gc_pause_ms", int64(c.Saturation.GCPauseMs)},
+		{"saturation.sched_latency_ms", int64(c.Saturation.SchedLatencyMs)},
+		{"saturation.window_sec", int64(c.Saturation.WindowSec)},
+	} {
+		if t.value < 0 {
+			list = append(list, configProblem{path: t.path, msg: fmt.Sprintf("threshold must not be negative, got %d", t.value)})
+		}
+	}
+	if c.Saturation.CPUPercent > 100 {
+		list = append(list, configProblem{path: "saturation.cpu_percent", msg: fmt.Sprintf("cpu threshold must not exceed 100%%, got %d", c.Saturation.CPUPercent)})
+	}
+	if c.Saturation.FailRun && !c.Saturation.MarkReport {
+		list = append(list, configProblem{path: "saturation.fail_run", msg: "reports must be marked to fail the run, set saturation.mark_report"})
+	}
+	if c.Host.CollectMetrics && c.Host.NetworkIface == "" {
+		list = append(list, configProblem{
+			path: "host.network_iface",
+			msg:  "network interface must be set to collect host metrics",
+		})
+	}
+	if c.Graphite.URL != "" && c.Graphite.FlushIntervalSec <= 0 {
+		list = append(list, configProblem{
+			path: "graphite.flushDurationSec",
+			msg:  "please set graphite flush duration to a positive number of seconds",
+		})
+	}
+	if c.Prometheus != nil && c.Prometheus.URL == "" {
+		list = append(list, configProblem{
+			path: "prometheus.url",
+			msg:  "prometheus url must be set when prometheus section is present",
+		})
+	}
+	if c.Checks.HandleThresholdPercent < 0 || (c.Checks.HandleThresholdPercent > 0 && c.Checks.HandleThresholdPercent < 1) {
+		list = append(list, configProblem{
+			path: "checks.handle_threshold_percent",
+			msg:  fmt.Sprintf("threshold is a ratio to the last successful run and must be >= 1, ex.: 1.2, got %v", c.Checks.HandleThresholdPercent),
+		})
+	}
+	if c.Checks.Baseline.Mode != "" && !oneOf(c.Checks.Baseline.Mode, baselineModes) {
+		list = append(list, configProblem{
+			path: "checks.baseline.mode",
+			msg:  fmt.Sprintf("unknown baseline mode %q, must be one of: %s", c.Checks.Baseline.Mode, strings.Join(baselineModes, ", ")),
+		})
+	}
+	if c.Checks.Baseline.Mode == medianBaseline && c.Checks.Baseline.LastN <= 0 {
+		list = append(list, configProblem{
+			path: "checks.baseline.last_n",
+			msg:  "number of runs must be positive for median baseline",
+		})
+	}
+	if c.Checks.Baseline.Mode == pinnedBaseline && c.Checks.Baseline.Pinned == "" {
+		list = append(list, configProblem{
+			path: "checks.baseline.pinned",
+			msg:  "baseline report path must be set for pinned baseline",
+		})
+	}
+	if sig := c.Checks.Significance; sig.Method != "" && !oneOf(sig.Method, significanceTests) {
+		list = append(list, configProblem{
+			path: "checks.significance.method",
+			msg:  fmt.Sprintf("unknown significance test %q, must be one of: %s", sig.Method, strings.Join(significanceTests, ", ")),
+		})
+	}
+	if a := c.Checks.Significance.Alpha; a < 0 || a >= 1 {
+		list = append(list, configProblem{
+			path: "checks.significance.alpha",
+			msg:  fmt.Sprintf("significance level must be in (0, 1), ex.: 0.05, got %v", a),
+		})
+	}
+	for i, t := range c.Checks.Thresholds {
+		tp := fmt.Sprintf("checks.thresholds.%d", i)
+		for key, v := range map[string]float64{"p50": t.P50, "p95": t.P95, "p99": t.P99} {
+			if v != 0 && v < 1 {
+				list = append(list, configProblem{
+					path: tp + "." + key,
+					msg:  fmt.Sprintf("latency threshold is a ratio to baseline and must be >= 1, ex.: 1.2, got %v", v),
+				})
+			}
+		}
+		if t.Throughput < 0 || t.Throughput > 1 {
+			list = append(list, configProblem{
+				path: tp + ".throughput",
+				msg:  fmt.Sprintf("throughput threshold is a ratio to baseline and must be in (0, 1], ex.: 0.9, got %v", t.Throughput),
+			})
+		}
+		if t.ErrorRate < 0 || t.ErrorRate > 100 {
+			list = append(list, configProblem{
+				path: tp + ".error_rate",
+				msg:  fmt.Sprintf("error rate threshold is percentage points and must be in [0, 100], got %v", t.ErrorRate),
+			})
+		}
+	}
+	for i, rule := range c.Errors.Normalize {
+		if _, err := regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+			list = append(list, configProblem{
+				path: fmt.Sprintf("errors.normalize.%d.pattern", i),
+				msg:  fmt.Sprintf("invalid regex %q", rule.Pattern),
+			})
+		}
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		list = append(list, configProblem{
+			path: "timezone",
+			msg:  fmt.Sprintf("unknown timezone %q", c.Timezone),
+		})
+	}
+	return
+}
+
+func (c *SuiteConfig) problems() (list []configProblem) {
+	if len(c.Steps) == 0 {
+		list = append(list, configProblem{path: "steps", msg: "no steps defined"})
+	}
+	// csv files written by previous steps do not need to exist before the run
+	written := make(map[string]bool)
+	for i, step := range c.Steps {
+		sp := fmt.Sprintf("steps.%d", i)
+		if step.Name == "" {
+			list = append(list, configProblem{path: sp + ".name", msg: "step name must not be empty"})
+		}
+		if !oneOf(step.ExecutionMode, executionModes) {
+			list = append(list, configProblem{
+				path: sp + ".execution_mode",
+				msg:  fmt.Sprintf("unknown execution mode %q, must be one of: %s", step.ExecutionMode, strings.Join(executionModes, ", ")),
+			})
+		}
+		if len(step.Handles) == 0 {
+			list = append(list, configProblem{path: sp + ".handles", msg: "no handles defined"})
+		}
+		seen := make(map[string]string)
+		stepWrites := make([]string, 0)
+		for j, h := range step.Handles {
+			hp := fmt.Sprintf("%s.handles.%d", sp, j)
+			if h.HandleName == "" {
+				list = append(list, configProblem{path: hp + ".name", msg: "handle name must not be empty"})
+			} else if first, ok := seen[h.HandleName]; ok {
+				list = append(list, configProblem{
+					path: hp + ".name",
+					msg:  fmt.Sprintf("duplicate handle name %q in step %q", h.HandleName, step.Name),
+					ref:  first,
+				})
+			} else {
+				seen[h.HandleName] = hp + ".name"
+			}
+			for _, p := range h.problems() {
+				list = append(list, configProblem{path: joinConfigPath(hp, p.path), msg: p.msg})
+			}
+			if step.ExecutionMode == SequenceValidateMode {
+				if h.Validation.AttackTimeSec < 2 {
+					list = append(list, configProblem{
+						path: hp + ".validation.attack_time_sec",
+						msg:  "please set validation attack time to a positive number of seconds > 1 for sequence_validate mode",
+					})
+				}
+				if h.Validation.Threshold <= 0 || h.Validation.Threshold > 1 {
+					list = append(list, configProblem{
+						path: hp + ".validation.threshold",
+						msg:  fmt.Sprintf("validation threshold is a part of max rps and must be in (0, 1], got %v", h.Validation.Threshold),
+					})
+				}
+			}
+			if h.ReadFromCsvName != "" && !written[h.ReadFromCsvName] {
+				if _, err := os.Stat(h.ReadFromCsvName); err != nil {
+					list = append(list, configProblem{
+						path: hp + ".csv_read",
+						msg:  fmt.Sprintf("csv file %s not found and not written by any previous handle", h.ReadFromCsvName),
+					})
+				}
+			}
+			if h.WriteToCsvName != "" {
+				if step.ExecutionMode == ParallelMode {
+					stepWrites = append(stepWrites, h.WriteToCsvName)
+				} else {
+					written[h.WriteToCsvName] = true
+				}
+			}
+		}
+		for _, w := range stepWrites {
+			written[w] = true
+		}
+	}
+	return
+}
+
+func (c RunnerConfig) problems() (list []configProblem) {
+	if c.RPS <= 0 {
+		list = append(list, configProblem{path: "rps", msg: "please set the RPS to a positive number of seconds"})
+	}
+	if c.AttackTimeSec < 2 {
+		list = append(list, configProblem{path: "attack_time_sec", msg: "please set the attack time to a positive number of seconds > 1"})
+	}
+	if c.RampUpTimeSec < 1 {
+		list = append(list, configProblem{path: "ramp_up_sec", msg: "please set the ramp up time to a positive number of seconds > 0"})
+	}
+	if c.MaxAttackers <= 0 {
+		list = append(list, configProblem{path: "max_attackers", msg: "please set a positive maximum number of attackers"})
+	}
+	if c.DoTimeoutSec <= 0 {
+		list = append(list, configProblem{path: "do_timeout_sec", msg: "please set the Do() timeout to a positive maximum number of seconds"})
+	}
+	if c.RampUpTimeSec > c.AttackTimeSec && c.AttackTimeSec >= 2 {
+		list = append(list, configProblem{
+			path: "ramp_up_sec",
+			msg:  fmt.Sprintf("ramp up time (%ds) is longer than attack time (%ds)", c.RampUpTimeSec, c.AttackTimeSec),
+		})
+	}
+	if c.RampUpStrategy != "" && !oneOf(c.RampUpStrategy, rampupStrategies) {
+		list = append(list, configProblem{
+			path: "ramp_up_strategy",
+			msg:  fmt.Sprintf("unknown ramp up strategy %q, must be one of: %s", c.RampUpStrategy, strings.Join(rampupStrategies, ", ")),
+		})
+	}
+	for i, check := range c.StopIf {
+		cp := fmt.Sprintf("stop_if.%d", i)
+		if !oneOf(check.Type, checkTypes) {
+			list = append(list, configProblem{
+				path: cp + ".type",
+				msg:  fmt.Sprintf("unknown check type %q, must be one of: %s", check.Type, strings.Join(checkTypes, ", ")),
+			})
+		}
+		if check.Interval <= 0 {
+			list = append(list, configProblem{path: cp + ".interval", msg: "please set check interval to a positive number of seconds"})
+		}
+		if check.Type == prometheusCheckType && !strings.Contains(check.Query, "bool") {
+			list = append(list, configProblem{path: cp + ".query", msg: "only bool queries are allowed for prometheus check"})
+		}
+		if check.Type == errorRatioCheckType && (check.Threshold < 0 || check.Threshold > 100) {
+			list = append(list, configProblem{
+				path: cp + ".threshold",
+				msg:  fmt.Sprintf("error check threshold is a percent of errors and must be in [0, 100], got %v", check.Threshold),
+			})
+		}
+	}
+	if c.Success != nil {
+		for i, v := range c.Success.StatusCodes {
+			if _, err := parseStatusRange(v); err != nil {
+				list = append(list, configProblem{path: fmt.Sprintf("success.status_codes.%d", i), msg: err.Error()})
+			}
+		}
+	}
+	if c.SLO != nil {
+		list = append(list, c.SLO.problems()...)
+	}
+	return
+}
+
+func (c *SLOConfig) problems() (list []configProblem) {
+	if c.SatisfiedMs <= 0 {
+		list = append(list, configProblem{path: "slo.satisfied_ms", msg: "please set apdex satisfied threshold to a positive number of milliseconds"})
+	}
+	if c.ToleratingMs != 0 && c.ToleratingMs < c.SatisfiedMs {
+		list = append(list, configProblem{
+			path: "slo.tolerating_ms",
+			msg:  fmt.Sprintf("tolerating threshold (%dms) is lower than satisfied threshold (%dms)", c.ToleratingMs, c.SatisfiedMs),
+		})
+	}
+	if c.LatencyMs < 0 {
+		list = append(list, configProblem{path: "slo.latency_ms", msg: "slo latency must be a positive number of milliseconds"})
+	}
+	if c.Objective < 0 || c.Objective > 100 {
+		list = append(list, configProblem{
+			path: "slo.objective",
+			msg:  fmt.Sprintf("slo objective is a percent of requests within slo and must be in [0, 100], ex.: 99.5, got %v", c.Objective),
+		})
+	}
+	if c.MinApdex < 0 || c.MinApdex > 1 {
+		list = append(list, configProblem{
+			path: "slo.min_apdex",
+			msg:  fmt.Sprintf("min apdex must be in [0, 1], ex.: 0.9, got %v", c.MinApdex),
+		})
+	}
+	for i, code := range c.StatusCodes {
+		if code < 100 || code > 599 {
+			list = append(list, configProblem{
+				path: fmt.Sprintf("slo.status_codes.%d", i),
+				msg:  fmt.Sprintf("unknown http status code %d", code),
+			})
+		}
+	}
+	return
+}
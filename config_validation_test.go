@@ -0,0 +1,157 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "loadgen-config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+const validSuite = `dumptransport: true
+steps:
+- name: load
+  execution_mode: parallel
+  handles:
+  - name: first
+    rps: 10
+    attack_time_sec: 30
+    ramp_up_sec: 5
+    ramp_up_strategy: linear
+    max_attackers: 2
+    do_timeout_sec: 10
+    csv_write: first.csv
+- name: read
+  execution_mode: sequence
+  handles:
+  - name: second
+    rps: 10
+    attack_time_sec: 30
+    ramp_up_sec: 5
+    max_attackers: 2
+    do_timeout_sec: 10
+    csv_read: first.csv
+    stop_if:
+    - type: error
+      threshold: 10
+      interval: 1
+`
+
+func TestValidateSuiteConfigFileValid(t *testing.T) {
+	f := writeTestConfig(t, validSuite)
+	defer os.Remove(f)
+	if errs := ValidateSuiteConfigFile(f); len(errs) != 0 {
+		t.Fatalf("expected no errors, got:\n%s", errs)
+	}
+}
+
+func TestValidateSuiteConfigFileProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string
+		line    int
+		msg     string
+	}{
+		{"unknown key", [2]string{"    ramp_up_strategy: linear", "    rampUpStrategy: linear"}, 10, `did you mean "ramp_up_strategy"`},
+		{"bad mode", [2]string{"execution_mode: parallel", "execution_mode: paralel"}, 4, "unknown execution mode"},
+		{"bad strategy", [2]string{"ramp_up_strategy: linear", "ramp_up_strategy: exp3"}, 10, "unknown ramp up strategy"},
+		{"bad check", [2]string{"type: error", "type: errors"}, 25, "unknown check type"},
+		{"ramp longer than attack", [2]string{"    ramp_up_sec: 5\n    ramp_up_strategy", "    ramp_up_sec: 50\n    ramp_up_strategy"}, 9, "longer than attack time"},
+		{"duplicate handle", [2]string{"  - name: second", "  - name: second\n    rps: 1\n  - name: second"}, 19, "duplicate handle name"},
+		{"bad success status", [2]string{"    csv_write: first.csv", "    csv_write: first.csv\n    success:\n      status_codes: [200-299, 6xx]"}, 15, "is not a status code"},
+		{"missing csv", [2]string{"csv_read: first.csv", "csv_read: missing.csv"}, 23, "missing.csv not found"},
+		{"bad type", [2]string{"rps: 10\n    attack_time_sec: 30\n    ramp_up_sec: 5\n    ramp_up_strategy", "rps: ten\n    attack_time_sec: 30\n    ramp_up_sec: 5\n    ramp_up_strategy"}, 7, "expected an integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := writeTestConfig(t, strings.Replace(validSuite, tt.replace[0], tt.replace[1], 1))
+			defer os.Remove(f)
+			errs := ValidateSuiteConfigFile(f)
+			for _, e := range errs {
+				if e.Line == tt.line && strings.Contains(e.Message, tt.msg) {
+					return
+				}
+			}
+			t.Fatalf("expected error %q at line %d, got:\n%s", tt.msg, tt.line, errs)
+		})
+	}
+}
+
+func TestValidateGeneratorConfigFile(t *testing.T) {
+	f := writeTestConfig(t, `host:
+  name: local
+generator:
+  rampUpStrategy: linear
+logging:
+  level: info
+  encoding: console
+checks:
+  handle_threshold_percent: 1.2
+`)
+	defer os.Remove(f)
+	errs := ValidateGeneratorConfigFile(f)
+	if len(errs) != 1 || errs[0].Line != 4 {
+		t.Fatalf("expected one unknown key error at line 4, got:\n%s", errs)
+	}
+}
+
+func TestValidateGeneratorConfigFailRunUnmarked(t *testing.T) {
+	f := writeTestConfig(t, `host:
+  name: local
+logging:
+  level: info
+  encoding: console
+saturation:
+  fail_run: true
+`)
+	defer os.Remove(f)
+	errs := ValidateGeneratorConfigFile(f)
+	if len(errs) != 1 || errs[0].Line != 7 || !strings.Contains(errs[0].Error(), "saturation.mark_report") {
+		t.Fatalf("expected fail_run error at line 7, got:\n%s", errs)
+	}
+}
+
+func TestValidateGeneratorConfigMedianLastN(t *testing.T) {
+	f := writeTestConfig(t, `host:
+  name: local
+logging:
+  level: info
+  encoding: console
+checks:
+  baseline:
+    mode: median
+    last_n: 0
+`)
+	defer os.Remove(f)
+	errs := ValidateGeneratorConfigFile(f)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "checks.baseline.last_n") {
+		t.Fatalf("expected last_n error, got:\n%s", errs)
+	}
+}
@@ -0,0 +1,580 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	controlActionPause     = "pause"
+	controlActionResume    = "resume"
+	controlActionStop      = "stop"
+	controlActionRPS       = "rps"
+	controlActionAttackers = "attackers"
+)
+
+// HandleStatus live state of a handle runner
+type HandleStatus struct {
+	Name         string `json:"name"`
+	Step         string `json:"step"`
+	Stage        string `json:"stage"`
+	Running      bool   `json:"running"`
+	Paused       bool   `json:"paused"`
+	TargetRPS    int    `json:"target_rps"`
+	MaxAttackers int    `json:"max_attackers"`
+	Attackers    int    `json:"attackers"`
+	// RampUp metrics of the last rampup second
+	RampUp *Metrics `json:"rampup,omitempty"`
+	// Metrics full attack metrics by label
+	Metrics map[string]*Metrics `json:"metrics"`
+	// RampUpErrors failed requests of the last rampup second
+	RampUpErrors int64 `json:"rampup_errors,omitempty"`
+	// Errors failed requests by label
+	Errors map[string]int64 `json:"errors"`
+}
+
+// errorsTotal failed requests of all error categories
+func (m *Metrics) errorsTotal() int64 {
+	var total int64
+	for _, c := range m.ErrorCategories {
+		total += c.Count
+	}
+	return total
+}
+
+// snapshot copies exported metrics, so they can be read while attack is running
+func (m *Metrics) snapshot() *Metrics {
+	m.updateLatencies()
+	cp := *m
+	cp.StatusCodes = make(map[string]int, len(m.StatusCodes))
+	for k, v := range m.StatusCodes {
+		cp.StatusCodes[k] = v
+	}
+	cp.Errors = append([]string{}, m.Errors...)
+	cp.ErrorCounts = make(map[string]int64, len(m.ErrorCounts))
+	for k, v := range m.ErrorCounts {
+		cp.ErrorCounts[k] = v
+	}
+	cp.ErrorCategories = make(map[string]*ErrorCategory, len(m.ErrorCategories))
+	for k, v := range m.ErrorCategories {
+		c := *v
+		c.Samples = append([]string{}, v.Samples...)
+		cp.ErrorCategories[k] = &c
+	}
+	cp.LatencySamples = nil
+	if m.SLO != nil {
+		s := *m.SLO
+		cp.SLO = &s
+	}
+	return &cp
+}
+
+// Status returns live state of the runner
+func (r *Runner) Status() HandleStatus {
+	r.attackersMu.Lock()
+	attackers := len(r.attackers)
+	r.attackersMu.Unlock()
+	st := HandleStatus{
+		Name:         r.name,
+		Step:         r.step,
+		Stage:        testStageNames[r.stage()],
+		Running:      r.running.Get(),
+		Paused:       r.paused.Get(),
+		TargetRPS:    r.targetRPS(),
+		MaxAttackers: r.maxAttackers(),
+		Attackers:    attackers,
+		Metrics:      make(map[string]*Metrics),
+		Errors:       make(map[string]int64),
+	}
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	if m, ok := r.RampUpMetrics[r.name]; ok && m.Requests > 0 {
+		st.RampUp = m.snapshot()
+		st.RampUpErrors = st.RampUp.errorsTotal()
+	}
+	for label, m := range r.Metrics {
+		st.Metrics[label] = m.snapshot()
+		st.Errors[label] = st.Metrics[label].errorsTotal()
+	}
+	return st
+}
+
+// Pause stops sending requests until resumed, paused time is not counted as attack time
+func (r *Runner) Pause() {
+	r.L.Infof("pausing runner")
+	r.paused.Set(true)
+}
+
+// Resume resumes paused runner
+func (r *Runner) Resume() {
+	r.L.Infof("resuming runner")
+	r.paused.Set(false)
+}
+
+// SetRPS changes target rps on the fly, during rampup it changes the rps runner is ramping up to
+func (r *Runner) SetRPS(rps int) error {
+	if rps <= 0 {
+		return fmt.Errorf("rps must be positive, got %d", rps)
+	}
+	r.controlMu.Lock()
+	r.L.Infof("setting target rps: %d -> %d", r.Config.RPS, rps)
+	r.Config.RPS = rps
+	r.controlMu.Unlock()
+	return nil
+}
+
+// SetMaxAttackers changes attackers ceiling on the fly, extra attackers are stopped,
+// during full attack new attackers are spawned up to the ceiling
+func (r *Runner) SetMaxAttackers(max int) error {
+	if max <= 0 {
+		return fmt.Errorf("max attackers must be positive, got %d", max)
+	}
+	r.controlMu.Lock()
+	r.L.Infof("setting max attackers: %d -> %d", r.Config.MaxAttackers, max)
+	r.Config.MaxAttackers = max
+	r.controlMu.Unlock()
+	if !r.running.Get() || r.stopped.Get() {
+		return nil
+	}
+	r.trimAttackers(max)
+	if r.stage() == constantLoad {
+		spawnAttackersToSize(r, max)
+	}
+	return nil
+}
+
+// Stop stops runner before attack time ends, report is still created
+func (r *Runner) Stop() {
+	if !r.running.Get() {
+		return
+	}
+	r.L.Infof("stopping runner")
+	r.interrupted.Set(true)
+	r.paused.Set(false)
+	r.Shutdown()
+}
+
+func (m *LoadManager) setCurrentStep(i int) {
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+	m.currentStep = i
+	m.skipStep.Set(false)
+}
+
+// stepRunnable checks if handles of current step may be started
+func (m *LoadManager) stepRunnable() bool {
+	return !m.stopping.Get() && !m.skipStep.Get()
+}
+
+// CurrentStep returns step that is running now
+func (m *LoadManager) CurrentStep() *RunStep {
+	m.controlMu.RLock()
+	defer m.controlMu.RUnlock()
+	if m.currentStep >= len(m.Steps) {
+		return nil
+	}
+	return &m.Steps[m.currentStep]
+}
+
+// Runner finds runner of current step by handle name
+func (m *LoadManager) Runner(name string) (*Runner, error) {
+	step := m.CurrentStep()
+	if step == nil {
+		return nil, errors.New("no step is running")
+	}
+	for _, r := range step.Runners {
+		if r.name == name {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no handle %s found in step %s", name, step.Name)
+}
+
+// Statuses returns live state of all runners in current step
+func (m *LoadManager) Statuses() []HandleStatus {
+	statuses := make([]HandleStatus, 0)
+	step := m.CurrentStep()
+	if step == nil {
+		return statuses
+	}
+	for _, r := range step.Runners {
+		statuses = append(statuses, r.Status())
+	}
+	return statuses
+}
+
+// NextStep stops all runners of current step, suite proceeds to the next step
+func (m *LoadManager) NextStep() {
+	step := m.CurrentStep()
+	if step == nil {
+		return
+	}
+	log.Infof("skipping the rest of step: %s", step.Name)
+	m.skipStep.Set(true)
+	for _, r := range step.Runners {
+		r.Stop()
+	}
+}
+
+// Stop gracefully stops the suite, remaining steps are skipped, reports are written
+func (m *LoadManager) Stop() {
+	log.Infof("stopping suite")
+	m.stopping.Set(true)
+	if step := m.CurrentStep(); step != nil {
+		for _, r := range step.Runners {
+			r.Stop()
+		}
+	}
+}
+
+// StartControlServer starts local http api to control running suite:
+//
+// GET  /handles                       list handles of current step with live metrics
+// GET  /handles/{name}                handle live metrics
+// POST /handles/{name}/pause          pause handle
+// POST /handles/{name}/resume         resume handle
+// POST /handles/{name}/rps?value=N    change handle target rps
+// POST /handles/{name}/attackers?value=N change handle attackers ceiling
+// POST /handles/{name}/stop           stop handle
+// POST /step/next                     stop current step and proceed to the next one
+// POST /stop                          stop suite gracefully, reports are written
+func (m *LoadManager) StartControlServer(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to start control api on %s: %s", addr, err)
+	}
+	log.Infof("control api is listening on %s", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, m.controlHandler()); err != nil {
+			log.Errorf("control api stopped: %s", err)
+		}
+	}()
+}
+
+// controlHandler routes of control api, see StartControlServer
+func (m *LoadManager) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/handles", m.handleStatuses)
+	mux.HandleFunc("/handles/", m.handleRunnerAction)
+	mux.HandleFunc("/step/next", controlPost(func() error {
+		m.NextStep()
+		return nil
+	}))
+	mux.HandleFunc("/stop", controlPost(func() error {
+		// suite stop waits for runners shutdown, do not block the response
+		go m.Stop()
+		return nil
+	}))
+	return mux
+}
+
+func (m *LoadManager) handleStatuses(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, errors.New("only GET is allowed"))
+		return
+	}
+	writeControlJSON(w, http.StatusOK, m.Statuses())
+}
+
+func (m *LoadManager) handleRunnerAction(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/handles/"), "/"), "/")
+	r, err := m.Runner(parts[0])
+	if err != nil {
+		writeControlError(w, http.StatusNotFound, err)
+		return
+	}
+	if len(parts) == 1 {
+		if req.Method != http.MethodGet {
+			writeControlError(w, http.StatusMethodNotAllowed, errors.New("only GET is allowed"))
+			return
+		}
+		writeControlJSON(w, http.StatusOK, r.Status())
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeControlError(w, http.StatusMethodNotAllowed, errors.New("only POST is allowed"))
+		return
+	}
+	switch parts[1] {
+	case controlActionPause:
+		r.Pause()
+	case controlActionResume:
+		r.Resume()
+	case controlActionStop:
+		go r.Stop()
+	case controlActionRPS, controlActionAttackers:
+		value, err := strconv.Atoi(req.URL.Query().Get("value"))
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, fmt.Errorf("bad value: %s", err))
+			return
+		}
+		if parts[1] == controlActionRPS {
+			err = r.SetRPS(value)
+		} else {
+			err = r.SetMaxAttackers(value)
+		}
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("unknown action: %s", parts[1]))
+		return
+	}
+	writeControlJSON(w, http.StatusOK, r.Status())
+}
+
+func controlPost(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeControlError(w, http.StatusMethodNotAllowed, errors.New("only POST is allowed"))
+			return
+		}
+		if err := action(); err != nil {
+			writeControlError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeControlJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func writeControlJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("failed to write control api response: %s", err)
+	}
+}
+
+func writeControlError(w http.ResponseWriter, code int, err error) {
+	writeControlJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// ControlClient client for generator control api
+type ControlClient struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewControlClient creates control api client, addr is host:port of generator control api
+func NewControlClient(addr string) *ControlClient {
+	return &ControlClient{
+		BaseURL: "http://" + addr,
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Handles lists handles of current step with live metrics
+func (c *ControlClient) Handles() ([]HandleStatus, error) {
+	var st []HandleStatus
+	err := c.do(http.MethodGet, "/handles", nil, &st)
+	return st, err
+}
+
+// Handle returns handle live metrics
+func (c *ControlClient) Handle(name string) (HandleStatus, error) {
+	var st HandleStatus
+	err := c.do(http.MethodGet, "/handles/"+url.PathEscape(name), nil, &st)
+	return st, err
+}
+
+// Pause pauses handle
+func (c *ControlClient) Pause(name string) (HandleStatus, error) {
+	return c.handleAction(name, controlActionPause, nil)
+}
+
+// Resume resumes paused handle
+func (c *ControlClient) Resume(name string) (HandleStatus, error) {
+	return c.handleAction(name, controlActionResume, nil)
+}
+
+// StopHandle stops handle, step proceeds with other handles
+func (c *ControlClient) StopHandle(name string) (HandleStatus, error) {
+	return c.handleAction(name, controlActionStop, nil)
+}
+
+// SetRPS changes handle target rps
+func (c *ControlClient) SetRPS(name string, rps int) (HandleStatus, error) {
+	return c.handleAction(name, controlActionRPS, url.Values{"value": {strconv.Itoa(rps)}})
+}
+
+// SetMaxAttackers changes handle attackers ceiling
+func (c *ControlClient) SetMaxAttackers(name string, max int) (HandleStatus, error) {
+	return c.handleAction(name, controlActionAttackers, url.Values{"value": {strconv.Itoa(max)}})
+}
+
+// NextStep stops current step, suite proceeds to the next step
+func (c *ControlClient) NextStep() error {
+	return c.do(http.MethodPost, "/step/next", nil, nil)
+}
+
+// Stop gracefully stops the suite
+func (c *ControlClient) Stop() error {
+	return c.do(http.MethodPost, "/stop", nil, nil)
+}
+
+func (c *ControlClient) handleAction(name string, action string, query url.Values) (HandleStatus, error) {
+	var st HandleStatus
+	err := c.do(http.MethodPost, fmt.Sprintf("/handles/%s/%s", url.PathEscape(name), action), query, &st)
+	return st, err
+}
+
+func (c *ControlClient) do(method string, path string, query url.Values, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]string
+		if err := json.Unmarshal(body, &apiErr); err == nil && apiErr["error"] != "" {
+			return fmt.Errorf("control api error: %s", apiErr["error"])
+		}
+		return fmt.Errorf("control api error: %s: %s", resp.Status, body)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// PrintHandleStatuses writes handles live state as a table
+func PrintHandleStatuses(out io.Writer, statuses []HandleStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tHANDLE\tSTAGE\tSTATE\tTARGET RPS\tATTACKERS\tLABEL\tREQUESTS\tRATE\tSUCCESS\tP50\tP95\tP99\tERRORS")
+	for _, st := range statuses {
+		state := "stopped"
+		if st.Running {
+			state = "running"
+		}
+		if st.Paused {
+			state = "paused"
+		}
+		head := fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d/%d", st.Step, st.Name, st.Stage, state, st.TargetRPS, st.Attackers, st.MaxAttackers)
+		metrics, errs := st.Metrics, st.Errors
+		if len(metrics) == 0 && st.RampUp != nil {
+			label := st.Name + " (rampup)"
+			metrics = map[string]*Metrics{label: st.RampUp}
+			errs = map[string]int64{label: st.RampUpErrors}
+		}
+		if len(metrics) == 0 {
+			fmt.Fprintf(w, "%s\t-\t0\t0.00\t0.00%%\t-\t-\t-\t0\n", head)
+			continue
+		}
+		for label, m := range metrics {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%.2f%%\t%s\t%s\t%s\t%d\n",
+				head,
+				label,
+				m.Requests,
+				m.Rate,
+				m.Success*100,
+				m.Latencies.P50.Round(time.Microsecond),
+				m.Latencies.P95.Round(time.Microsecond),
+				m.Latencies.P99.Round(time.Microsecond),
+				errs[label],
+			)
+		}
+	}
+	w.Flush()
+}
+
+// ControlCommand executes control api command, ex.: list, pause h, resume h, rps h 100, attackers h 50, stop [h], next
+func ControlCommand(addr string, args []string) {
+	c := NewControlClient(addr)
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	handleArg := func() string {
+		if len(args) < 2 {
+			log.Fatalf("usage: loadcli ctl %s <handle>", args[0])
+		}
+		return args[1]
+	}
+	valueArg := func() int {
+		if len(args) < 3 {
+			log.Fatalf("usage: loadcli ctl %s <handle> <value>", args[0])
+		}
+		v, err := strconv.Atoi(args[2])
+		if err != nil {
+			log.Fatalf("bad value: %s", err)
+		}
+		return v
+	}
+	var (
+		statuses []HandleStatus
+		st       HandleStatus
+		err      error
+	)
+	switch args[0] {
+	case "list":
+		statuses, err = c.Handles()
+	case controlActionPause:
+		st, err = c.Pause(handleArg())
+	case controlActionResume:
+		st, err = c.Resume(handleArg())
+	case controlActionRPS:
+		st, err = c.SetRPS(handleArg(), valueArg())
+	case controlActionAttackers:
+		st, err = c.SetMaxAttackers(handleArg(), valueArg())
+	case controlActionStop:
+		if len(args) < 2 {
+			err = c.Stop()
+			break
+		}
+		st, err = c.StopHandle(args[1])
+	case "next":
+		err = c.NextStep()
+	default:
+		log.Fatalf("unknown control command: %s", args[0])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if st.Name != "" {
+		statuses = append(statuses, st)
+	}
+	if statuses != nil {
+		PrintHandleStatuses(os.Stdout, statuses)
+		return
+	}
+	log.Infof("%s: ok", args[0])
+}
@@ -0,0 +1,194 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testControlManager(handles ...string) (*LoadManager, *ControlClient, func()) {
+	setupLogger("console", "error")
+	m := &LoadManager{
+		GeneratorConfig: &GeneratorConfig{},
+		CsvMu:           &sync.Mutex{},
+		Reports:         make(map[string]*RunReport),
+		controlMu:       &sync.RWMutex{},
+		stopping:        &AtomicBool{},
+		skipStep:        &AtomicBool{},
+	}
+	step := RunStep{Name: "load", ExecutionMode: ParallelMode}
+	for _, h := range handles {
+		r := NewRunner(h, m, &attackMock{sleep: time.Millisecond}, nil, RunnerConfig{
+			HandleName:     h,
+			RPS:            50,
+			AttackTimeSec:  30,
+			RampUpTimeSec:  1,
+			RampUpStrategy: linearRampupStrategy,
+			MaxAttackers:   4,
+			DoTimeoutSec:   1,
+		})
+		r.step = step.Name
+		step.Runners = append(step.Runners, r)
+	}
+	m.Steps = []RunStep{step}
+	m.setCurrentStep(0)
+	srv := httptest.NewServer(m.controlHandler())
+	return m, &ControlClient{BaseURL: srv.URL, HTTP: srv.Client()}, srv.Close
+}
+
+// runControlled runs runners of the current step, returned channel is closed when all of them are finished
+func runControlled(t *testing.T, m *LoadManager, c *ControlClient) chan struct{} {
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for _, r := range m.Steps[0].Runners {
+		wg.Add(1)
+		go r.Run(wg, m)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, r := range m.Steps[0].Runners {
+		for {
+			st, err := c.Handle(r.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Running {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("handle %s is not started", r.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return done
+}
+
+func waitControlled(t *testing.T, done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("runners are not stopped")
+	}
+}
+
+func TestControlHandleActions(t *testing.T) {
+	m, c, closeSrv := testControlManager("first")
+	defer closeSrv()
+	done := runControlled(t, m, c)
+
+	st, err := c.Pause("first")
+	if err != nil || !st.Paused {
+		t.Fatalf("handle must be paused: %+v %v", st, err)
+	}
+	if st, err = c.Resume("first"); err != nil || st.Paused {
+		t.Fatalf("handle must be resumed: %+v %v", st, err)
+	}
+	if st, err = c.SetRPS("first", 20); err != nil || st.TargetRPS != 20 {
+		t.Fatalf("target rps must be changed: %+v %v", st, err)
+	}
+	if _, err = c.SetRPS("first", 0); err == nil || !strings.Contains(err.Error(), "rps must be positive") {
+		t.Fatalf("expected rps error, got %v", err)
+	}
+	if st, err = c.SetMaxAttackers("first", 2); err != nil || st.MaxAttackers != 2 || st.Attackers > 2 {
+		t.Fatalf("attackers must be trimmed: %+v %v", st, err)
+	}
+	if _, err = c.Handle("missing"); err == nil || !strings.Contains(err.Error(), "no handle missing found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	statuses, err := c.Handles()
+	if err != nil || len(statuses) != 1 || statuses[0].Step != "load" {
+		t.Fatalf("unexpected handles: %+v %v", statuses, err)
+	}
+	if _, err = c.StopHandle("first"); err != nil {
+		t.Fatal(err)
+	}
+	waitControlled(t, done)
+	rep := m.Reports[reportKey("load", "first", false)]
+	if rep == nil || !rep.Interrupted {
+		t.Fatalf("stopped handle report must be interrupted: %+v", rep)
+	}
+	if m.skipStep.Get() || m.stopping.Get() {
+		t.Fatal("handle stop must not stop the step or the suite")
+	}
+}
+
+func TestControlNextStep(t *testing.T) {
+	m, c, closeSrv := testControlManager("first", "second")
+	defer closeSrv()
+	done := runControlled(t, m, c)
+	if err := c.NextStep(); err != nil {
+		t.Fatal(err)
+	}
+	waitControlled(t, done)
+	if !m.skipStep.Get() || m.stopping.Get() {
+		t.Fatal("only the current step must be skipped")
+	}
+	for _, h := range []string{"first", "second"} {
+		if !m.Reports[reportKey("load", h, false)].Interrupted {
+			t.Fatalf("%s must be interrupted", h)
+		}
+	}
+}
+
+func TestControlStopSuite(t *testing.T) {
+	m, c, closeSrv := testControlManager("first")
+	defer closeSrv()
+	done := runControlled(t, m, c)
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	waitControlled(t, done)
+	if !m.stopping.Get() || !m.Reports[reportKey("load", "first", false)].Interrupted {
+		t.Fatal("suite must be stopped")
+	}
+}
+
+func TestControlHandleErrors(t *testing.T) {
+	m, c, closeSrv := testControlManager("first")
+	defer closeSrv()
+	r := m.Steps[0].Runners[0]
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", StatusCode: 200}})
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", Error: errAttackDoTimedOut}})
+	r.addResult(result{doResult: DoResult{RequestLabel: "get", StatusCode: 503}})
+
+	statuses, err := c.Handles()
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("unexpected handles: %+v %v", statuses, err)
+	}
+	if statuses[0].Errors["get"] != 2 {
+		t.Fatalf("expected 2 errors of label get, got %+v", statuses[0].Errors)
+	}
+	out := &bytes.Buffer{}
+	PrintHandleStatuses(out, statuses)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+	fields := strings.Fields(lines[1])
+	if fields[len(fields)-1] != "2" {
+		t.Fatalf("errors column must be read from the status:\n%s", out)
+	}
+}
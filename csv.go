@@ -18,6 +18,7 @@ package loadgen
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
 	"os"
 	"sync"
@@ -29,6 +30,8 @@ type CSVData struct {
 	CsvWriter *csv.Writer
 	CsvReader *csv.Reader
 	Recycle   bool
+	// Offset records read from the file
+	Offset int
 }
 
 func NewCSVData(f *os.File, recycle bool) *CSVData {
@@ -73,9 +76,31 @@ func (m *CSVData) Read() ([]string, error) {
 			return nil, err
 		}
 	}
+	m.Offset++
 	return st, nil
 }
 
+// Skip skips records already consumed in previous run
+func (m *CSVData) Skip(count int) error {
+	for i := 0; i < count; i++ {
+		_, err := m.CsvReader.Read()
+		if err == io.EOF {
+			if !m.Recycle {
+				return fmt.Errorf("data EOF after %d records, can not skip %d records", i, count)
+			}
+			if err := m.RecycleData(); err != nil {
+				return err
+			}
+			_, err = m.CsvReader.Read()
+		}
+		if err != nil {
+			return err
+		}
+		m.Offset++
+	}
+	return nil
+}
+
 // Write writes csv string
 func (m *CSVData) Write(rec []string) error {
 	if err := m.CsvWriter.Write(rec); err != nil {
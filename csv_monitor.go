@@ -36,10 +36,10 @@ func (m CSVMonitored) Do(ctx context.Context) DoResult {
 		time.Sleep(time.Duration(cfg.DebugSleep) * time.Millisecond)
 	}
 	before := time.Now()
-	result := m.Attack.Do(ctx)
+	result := m.GetRunner().checkResult(m.Attack.Do(ctx))
 	attackTime := time.Now().Sub(before)
 	status := "ok"
-	if result.Error != nil || result.StatusCode >= 400 {
+	if result.Error != nil {
 		m.GetRunner().L.Debugf("err: %s", result.Error)
 		status = "err"
 	}
@@ -53,6 +53,14 @@ func (m CSVMonitored) Do(ctx context.Context) DoResult {
 	return result
 }
 
+// ValidateResult calls result validator of monitored attack
+func (m CSVMonitored) ValidateResult(res DoResult) error {
+	if v, ok := m.Attack.(ResultValidator); ok {
+		return v.ValidateResult(res)
+	}
+	return nil
+}
+
 func (m CSVMonitored) Setup(c RunnerConfig) error {
 	if err := m.Attack.Setup(c); err != nil {
 		return err
@@ -0,0 +1,161 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LabelManifestFileTmpl labels seen at runtime of a suite, stored in report dir
+const LabelManifestFileTmpl = "%s.labels.json"
+
+// LabelManifest labels of suite steps, used to generate dashboard panels
+type LabelManifest struct {
+	Suite string       `json:"suite"`
+	Steps []StepLabels `json:"steps"`
+}
+
+// StepLabels labels of a step, every handle has label of its name, handles may report results with other labels
+type StepLabels struct {
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+}
+
+// step labels of step, added if missing
+func (lm *LabelManifest) step(name string) *StepLabels {
+	for i := range lm.Steps {
+		if lm.Steps[i].Name == name {
+			return &lm.Steps[i]
+		}
+	}
+	lm.Steps = append(lm.Steps, StepLabels{Name: name})
+	return &lm.Steps[len(lm.Steps)-1]
+}
+
+// add adds labels to step, labels already in step are skipped
+func (lm *LabelManifest) add(step string, labels ...string) {
+	s := lm.step(step)
+	for _, l := range labels {
+		if !contains(s.Labels, l) {
+			s.Labels = append(s.Labels, l)
+		}
+	}
+}
+
+// Labels labels of all steps
+func (lm *LabelManifest) Labels() []string {
+	labels := make([]string, 0)
+	for _, s := range lm.Steps {
+		for _, l := range s.Labels {
+			if !contains(labels, l) {
+				labels = append(labels, l)
+			}
+		}
+	}
+	return labels
+}
+
+// SuiteLabels labels of suite steps in suite order, handles are labels of their names,
+// labels seen at runtime are added from manifest, steps no longer in suite are skipped
+func SuiteLabels(name string, suite *SuiteConfig, seen *LabelManifest) *LabelManifest {
+	lm := &LabelManifest{Suite: name}
+	for _, step := range suite.Steps {
+		lm.step(step.Name)
+		for _, h := range step.Handles {
+			lm.add(step.Name, h.HandleName)
+		}
+		if seen == nil {
+			continue
+		}
+		for _, ss := range seen.Steps {
+			if ss.Name == step.Name {
+				lm.add(step.Name, ss.Labels...)
+			}
+		}
+	}
+	return lm
+}
+
+// LabelManifestPath path of suite label manifest in report dir
+func LabelManifestPath(reportDir string, suitePath string) string {
+	return filepath.Join(reportDir, fmt.Sprintf(LabelManifestFileTmpl, suiteName(suitePath)))
+}
+
+// LoadLabelManifest loads label manifest, manifest is empty if file doesn't exist
+func LoadLabelManifest(path string) (*LabelManifest, error) {
+	lm := &LabelManifest{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lm); err != nil {
+		return nil, fmt.Errorf("failed to parse label manifest %s: %s", path, err)
+	}
+	return lm, nil
+}
+
+// runtimeLabels labels reported by handles of every step
+func (m *LoadManager) runtimeLabels() *LabelManifest {
+	lm := &LabelManifest{Suite: suiteName(m.SuiteConfigPath)}
+	for _, step := range m.Steps {
+		for _, r := range step.Runners {
+			labels := []string{r.name}
+			for l := range r.Metrics {
+				labels = append(labels, l)
+			}
+			sort.Strings(labels[1:])
+			lm.add(step.Name, labels...)
+		}
+	}
+	return lm
+}
+
+// StoreLabelManifest merges labels seen in the run to suite label manifest in report dir if reports.label_manifest is set,
+// labels of previous runs are kept, so handles that skip some labels in a run don't lose their panels
+func (m *LoadManager) StoreLabelManifest() {
+	if !m.GeneratorConfig.Reports.LabelManifest {
+		return
+	}
+	path := LabelManifestPath(m.ReportDir, m.SuiteConfigPath)
+	lm, err := LoadLabelManifest(path)
+	if err != nil {
+		log.Errorf("failed to load label manifest: %s", err)
+		return
+	}
+	lm.Suite = suiteName(m.SuiteConfigPath)
+	for _, s := range m.runtimeLabels().Steps {
+		lm.add(s.Name, s.Labels...)
+	}
+	b, err := json.MarshalIndent(lm, "", "    ")
+	if err != nil {
+		log.Errorf("failed to marshal label manifest: %s", err)
+		return
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		log.Errorf("failed to write label manifest: %s", err)
+		return
+	}
+	log.Infof("labels are written to %s", path)
+}
@@ -0,0 +1,103 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSuiteLabels(t *testing.T) {
+	suite := &SuiteConfig{Steps: []Step{
+		{Name: "warmup", Handles: []RunnerConfig{{HandleName: "get"}}},
+		{Name: "load", Handles: []RunnerConfig{{HandleName: "get"}, {HandleName: "put"}}},
+	}}
+	seen := &LabelManifest{Steps: []StepLabels{
+		{Name: "load", Labels: []string{"put", "put_retry"}},
+		{Name: "removed", Labels: []string{"old"}},
+	}}
+	lm := SuiteLabels("checkout", suite, seen)
+	want := []StepLabels{
+		{Name: "warmup", Labels: []string{"get"}},
+		{Name: "load", Labels: []string{"get", "put", "put_retry"}},
+	}
+	if lm.Suite != "checkout" || !reflect.DeepEqual(lm.Steps, want) {
+		t.Fatalf("unexpected suite labels: %+v", lm)
+	}
+	if labels := lm.Labels(); !reflect.DeepEqual(labels, []string{"get", "put", "put_retry"}) {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+}
+
+func TestStoreLabelManifest(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := &LoadManager{GeneratorConfig: &GeneratorConfig{}, ReportDir: dir, SuiteConfigPath: "suites/checkout.yaml"}
+	m.GeneratorConfig.Reports.LabelManifest = true
+	r := &Runner{name: "put", Metrics: map[string]*Metrics{"put": {}, "put_retry": {}}}
+	m.Steps = []RunStep{{Name: "load", Runners: []*Runner{r}}}
+	m.StoreLabelManifest()
+	r.Metrics = map[string]*Metrics{"put": {}, "put_conflict": {}}
+	m.StoreLabelManifest()
+
+	lm, err := LoadLabelManifest(LabelManifestPath(dir, m.SuiteConfigPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StepLabels{{Name: "load", Labels: []string{"put", "put_retry", "put_conflict"}}}
+	if lm.Suite != "checkout" || !reflect.DeepEqual(lm.Steps, want) {
+		t.Fatalf("labels of every run must be kept: %+v", lm)
+	}
+
+	if lm, err := LoadLabelManifest(LabelManifestPath(dir, "missing.yaml")); err != nil || len(lm.Steps) != 0 {
+		t.Fatalf("missing manifest must be empty: %+v %v", lm, err)
+	}
+}
+
+func TestSuiteDashboardStepRows(t *testing.T) {
+	cfg := &GeneratorConfig{}
+	cfg.Graphite.LoadGeneratorPrefix = "observer"
+	suite := &LabelManifest{Suite: "checkout", Steps: []StepLabels{
+		{Name: "warmup", Labels: []string{"get"}},
+		{Name: "load", Labels: []string{"get", "put"}},
+	}}
+	dashboards := GeneratorDashboards(cfg, suite)
+	d := dashboards[len(dashboards)-1]
+	if d.Title != "observer-checkout" || dashboards[0].Title != "observer-checkout-summary" {
+		t.Fatalf("unexpected titles %s, %s", dashboards[0].Title, d.Title)
+	}
+	titles := make([]string, 0)
+	for _, r := range d.Rows {
+		titles = append(titles, r.Title)
+	}
+	want := []string{"Step warmup", "Step warmup Apdex / SLO", "Step load", "Step load Apdex / SLO", "Generator Metrics", "Generator host Metrics"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Fatalf("unexpected rows %v", titles)
+	}
+	if n := len(d.Rows[0].Panels[0].Targets); n != len(percentiles) {
+		t.Fatalf("warmup latency panel must have targets of its label only, got %d", n)
+	}
+	if n := len(d.Rows[2].Panels[0].Targets); n != 2*len(percentiles) {
+		t.Fatalf("load latency panel must have targets of its labels, got %d", n)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Error categories
+const (
+	ErrCategoryTimeout           = "timeout"
+	ErrCategoryConnectionRefused = "connection_refused"
+	ErrCategoryTLS               = "tls"
+	ErrCategoryHTTP4xx           = "http_4xx"
+	ErrCategoryHTTP5xx           = "http_5xx"
+	ErrCategoryCanceled          = "canceled"
+	ErrCategoryApplication       = "application"
+)
+
+// errorSamplesSize raw error messages kept for every category
+const errorSamplesSize = 5
+
+// ErrorCategory errors count of a category with a few raw messages
+type ErrorCategory struct {
+	Count   int64    `json:"count"`
+	Samples []string `json:"samples,omitempty"`
+}
+
+type errorRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+var (
+	// defaultErrorRules mask ids, addresses, times and numbers, so errors differing only by them are counted as one,
+	// digits inside words are kept, ex.: x509, http2, sha256
+	defaultErrorRules = []errorRule{
+		{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+		{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+		{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<addr>"},
+		{regexp.MustCompile(`\[[0-9a-fA-F:]+\](:\d+)?`), "<addr>"},
+		{regexp.MustCompile(`\b\d+\b`), "<n>"},
+		{regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{8,}\b`), "<hex>"},
+	}
+	errorRulesMu sync.RWMutex
+	// errorRules user rules from errors.normalize config, applied before default rules
+	errorRules []errorRule
+)
+
+// SetErrorNormalizationRules sets rules to mask variable parts of error messages, applied before default rules
+func SetErrorNormalizationRules(rules []ErrorNormalizationRule) error {
+	compiled := make([]errorRule, 0, len(rules))
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid error normalization pattern %q: %s", r.Pattern, err)
+		}
+		compiled = append(compiled, errorRule{re, r.Replace})
+	}
+	errorRulesMu.Lock()
+	defer errorRulesMu.Unlock()
+	errorRules = compiled
+	return nil
+}
+
+// NormalizeError masks variable parts of error message: configured rules, then uuids, times, addresses, hex ids and numbers
+func NormalizeError(msg string) string {
+	errorRulesMu.RLock()
+	defer errorRulesMu.RUnlock()
+	for _, r := range errorRules {
+		msg = r.re.ReplaceAllString(msg, r.replace)
+	}
+	for _, r := range defaultErrorRules {
+		msg = r.re.ReplaceAllString(msg, r.replace)
+	}
+	return msg
+}
+
+// ClassifyError returns error category of a request result, empty if request succeeded
+func ClassifyError(res DoResult) string {
+	if res.Error == nil {
+		if res.checked {
+			// passed handle success criteria
+			return ""
+		}
+		switch {
+		case res.StatusCode >= 500:
+			return ErrCategoryHTTP5xx
+		case res.StatusCode >= 400:
+			return ErrCategoryHTTP4xx
+		}
+		return ""
+	}
+	if res.Error == context.Canceled {
+		return ErrCategoryCanceled
+	}
+	if res.Error == context.DeadlineExceeded || res.Error == errAttackDoTimedOut {
+		return ErrCategoryTimeout
+	}
+	if t, ok := res.Error.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return ErrCategoryTimeout
+	}
+	msg := strings.ToLower(res.Error.Error())
+	switch {
+	case strings.Contains(msg, "context canceled"):
+		return ErrCategoryCanceled
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out") || strings.Contains(msg, "deadline exceeded"):
+		return ErrCategoryTimeout
+	case strings.Contains(msg, "connection refused"):
+		return ErrCategoryConnectionRefused
+	case strings.Contains(msg, "tls") || strings.Contains(msg, "x509") || strings.Contains(msg, "certificate"):
+		return ErrCategoryTLS
+	case res.StatusCode >= 500:
+		return ErrCategoryHTTP5xx
+	case res.StatusCode >= 400:
+		return ErrCategoryHTTP4xx
+	}
+	return ErrCategoryApplication
+}
+
+// errorMessage raw error message of a failed request, http errors without error have status as message
+func errorMessage(res DoResult) string {
+	if res.Error != nil {
+		return res.Error.Error()
+	}
+	return fmt.Sprintf("HTTP %d", res.StatusCode)
+}
+
+// addError counts failed request in its category
+func (m *Metrics) addError(category string, res DoResult) {
+	c, ok := m.ErrorCategories[category]
+	if !ok {
+		c = &ErrorCategory{}
+		m.ErrorCategories[category] = c
+	}
+	c.Count++
+	if len(c.Samples) < errorSamplesSize {
+		msg := errorMessage(res)
+		for _, s := range c.Samples {
+			if s == msg {
+				return
+			}
+		}
+		c.Samples = append(c.Samples, msg)
+	}
+}
+
+// sortedErrorCategories categories names of metrics
+func sortedErrorCategories(m *Metrics) []string {
+	res := make([]string, 0, len(m.ErrorCategories))
+	for c := range m.ErrorCategories {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
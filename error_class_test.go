@@ -0,0 +1,92 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeError(t *testing.T) {
+	defer SetErrorNormalizationRules(nil)
+	cases := map[string]string{
+		"request 3f2b6c1e-8a9d-4c1b-9e2f-0a1b2c3d4e5f failed":  "request <uuid> failed",
+		"dial tcp 10.0.0.12:8080: connect: connection refused": "dial tcp <addr>: connect: connection refused",
+		"at 2020-05-20T15:30:00.123Z: order 12345 not found":   "at <time>: order <n> not found",
+		"tx 9f86d081884c7d65 rejected, retry 3 of 5":           "tx <hex> rejected, retry <n> of <n>",
+		"user42 is not allowed":                                "user42 is not allowed",
+		"x509: certificate has expired, ipv4 route via http2":  "x509: certificate has expired, ipv4 route via http2",
+		"sha256 mismatch after 3 attempts":                     "sha256 mismatch after <n> attempts",
+	}
+	for raw, expected := range cases {
+		if got := NormalizeError(raw); got != expected {
+			t.Errorf("%q normalized to %q, expected %q", raw, got, expected)
+		}
+	}
+	if err := SetErrorNormalizationRules([]ErrorNormalizationRule{{Pattern: `session \w+`, Replace: "session <id>"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := NormalizeError("session abcXYZ expired"); got != "session <id> expired" {
+		t.Errorf("custom rule is not applied: %q", got)
+	}
+	if err := SetErrorNormalizationRules([]ErrorNormalizationRule{{Pattern: `(`}}); err == nil {
+		t.Error("invalid pattern is accepted")
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		res      DoResult
+		expected string
+	}{
+		{DoResult{StatusCode: 200}, ""},
+		{DoResult{StatusCode: 404}, ErrCategoryHTTP4xx},
+		{DoResult{StatusCode: 503}, ErrCategoryHTTP5xx},
+		{DoResult{Error: errAttackDoTimedOut}, ErrCategoryTimeout},
+		{DoResult{Error: context.Canceled}, ErrCategoryCanceled},
+		{DoResult{Error: errors.New("Get http://a: net/http: request canceled (Client.Timeout exceeded)")}, ErrCategoryTimeout},
+		{DoResult{Error: errors.New("dial tcp 127.0.0.1:80: connect: connection refused")}, ErrCategoryConnectionRefused},
+		{DoResult{Error: errors.New("x509: certificate signed by unknown authority")}, ErrCategoryTLS},
+		{DoResult{Error: errors.New("bad response"), StatusCode: 500}, ErrCategoryHTTP5xx},
+		{DoResult{Error: errors.New("balance is negative")}, ErrCategoryApplication},
+	}
+	for _, c := range cases {
+		if got := ClassifyError(c.res); got != c.expected {
+			t.Errorf("%+v classified as %q, expected %q", c.res, got, c.expected)
+		}
+	}
+}
+
+func TestMetricsErrorCategories(t *testing.T) {
+	m := &Metrics{}
+	for i := 0; i < 10; i++ {
+		m.add(result{doResult: DoResult{Error: fmt.Errorf("order %d not found", i)}})
+	}
+	m.add(result{doResult: DoResult{StatusCode: 502}})
+	if len(m.Errors) != 1 || m.ErrorCounts["order <n> not found"] != 10 {
+		t.Fatalf("errors are not deduplicated: %v, %v", m.Errors, m.ErrorCounts)
+	}
+	app := m.ErrorCategories[ErrCategoryApplication]
+	if app.Count != 10 || len(app.Samples) != errorSamplesSize || app.Samples[0] != "order 0 not found" {
+		t.Fatalf("unexpected application errors: %+v", app)
+	}
+	if c := m.ErrorCategories[ErrCategoryHTTP5xx]; c.Count != 1 || c.Samples[0] != "HTTP 502" {
+		t.Fatalf("unexpected http errors: %+v", c)
+	}
+}
@@ -19,22 +19,18 @@ package loadgen
 import (
 	"fmt"
 	"github.com/spf13/viper"
-	"go/ast"
-	"go/parser"
-	"go/token"
 	"strings"
 )
 
-const (
-	labelsPath = "%s/labels.go"
-)
-
 var (
-	percentiles            = []string{"50", "95"}
+	percentiles            = []string{"50", "95", "99"}
 	rpsLabelSuffixes       = []string{"timer", "err"}
+	bytesLabelSuffixes     = []string{"bytes-in", "bytes-out"}
 	hostMetricCPUNames     = []string{"cpu_used"}
 	hostMetricMEMNames     = []string{"mem_total", "mem_free", "mem_used", "mem_cached", "mem_swap_total", "mem_swap_used", "mem_swap_free"}
 	hostMetricNetworkNames = []string{"net_%s_rx", "net_%s_tx"}
+	apdexLabelSuffixes     = []string{"apdex"}
+	sloLabelSuffixes       = []string{"slo", "error-budget"}
 
 	// scale factors for graphs, Ms, Mb, etc
 	cpuScaleFactor         = "1"
@@ -48,6 +44,11 @@ var (
 	rpsTargetTemplate        = "alias(perSecond(%s.%s-%s.count_ps), '%s')"
 	goroutinesTotalTemplate  = "%s.goroutines-%s.value"
 	metricValueTemplate      = "scale(%s.%s.value, %s)"
+	gaugeTargetTemplate      = "alias(%s.%s-%s.value, '%s')"
+
+	graphiteCounterRateTemplate   = "alias(perSecond(%s.%s-%s.count), '%s')"
+	graphiteErrorCategoryTemplate = "aliasSub(perSecond(%s.%s-err-*.count), '^.*(%s-err-[^.]*).*$', '\\1')"
+	graphiteRunnerGaugeTemplate   = "aliasSub(%s.%s-$%s.value, '^.*\\.(%s-[^.]*)\\.value$', '\\1')"
 
 	// Summary dashboard
 	summaryPercentileTargetTemplate = "alias(scale(percentileOfSeries(*.%s-timer.%s-percentile, %s, 'false'), %s), '%s')"
@@ -114,8 +115,17 @@ type Tooltip struct {
 }
 
 type Target struct {
-	RefID  string `json:"refId"`
-	Target string `json:"target"`
+	RefID string `json:"refId"`
+	// Target graphite query
+	Target string `json:"target,omitempty"`
+	// Expr and LegendFormat prometheus query
+	Expr         string `json:"expr,omitempty"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	// Query raw influxql query, Alias may use $tag_<name>
+	Query        string `json:"query,omitempty"`
+	RawQuery     bool   `json:"rawQuery,omitempty"`
+	ResultFormat string `json:"resultFormat,omitempty"`
+	Alias        string `json:"alias,omitempty"`
 }
 
 type Legend struct {
@@ -174,7 +184,9 @@ type Row struct {
 }
 
 type Dashboard struct {
-	Inputs        Inputs        `json:"__inputs"`
+	// UID stable id, import overwrites dashboard with the same uid
+	UID           string        `json:"uid,omitempty"`
+	Inputs        Inputs        `json:"__inputs,omitempty"`
 	Requires      Requires      `json:"__requires"`
 	Annotations   Annotations   `json:"annotations"`
 	Editable      bool          `json:"editable"`
@@ -315,6 +327,19 @@ func GenerateRPSTargets(labels []string, projectMetricPrefix string) []Target {
 	return targets
 }
 
+// GenerateGaugeTargets label gauges targets, ex.: apdex, slo
+func GenerateGaugeTargets(labels []string, projectMetricPrefix string, suffixes []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range suffixes {
+			targets = append(targets, Target{
+				Target: fmt.Sprintf(gaugeTargetTemplate, projectMetricPrefix, label, suffix, fmt.Sprintf(alias, label, suffix)),
+			})
+		}
+	}
+	return targets
+}
+
 func GenerateXTimePanel(title string, targets []Target, xSpan int, yAxisFormat string) Panel {
 	return Panel{
 		AliasColors: struct{}{},
@@ -394,32 +419,112 @@ func GenerateSummaryRows(labels []string) []Row {
 }
 
 func GenerateNodeGeneratorRows(labels []string, projectGeneratorNodePrefix string) []Row {
-	networkIface := viper.GetString("host.network_iface")
-	hostCpuTargets := GenerateHostMetricTargets(metricValueTemplate, projectGeneratorNodePrefix, cpuScaleFactor, hostMetricCPUNames)
-	hostMemTargets := GenerateHostMetricTargets(metricValueTemplate, projectGeneratorNodePrefix, memScaleFactor, hostMetricMEMNames)
-	for i := range hostMetricNetworkNames {
-		hostMetricNetworkNames[i] = fmt.Sprintf(hostMetricNetworkNames[i], networkIface)
+	q := &graphiteQueries{
+		prefix:    projectGeneratorNodePrefix,
+		generator: projectGeneratorNodePrefix,
+		iface:     viper.GetString("host.network_iface"),
 	}
-	hostNetworkTargets := GenerateHostMetricTargets(metricValueTemplate, projectGeneratorNodePrefix, netScaleFactor, hostMetricNetworkNames)
-	infoTargets := GenerateGoroutinesTotalTarget(labels, projectGeneratorNodePrefix)
-	percTargets := GeneratePercentileTargets(labels, projectGeneratorNodePrefix)
-	rpsTargets := GenerateRPSTargets(labels, projectGeneratorNodePrefix)
-	hostCPUPanel := GenerateXTimePanel("CPU used (%)", hostCpuTargets, 4, "short")
-	hostMemPanel := GenerateXTimePanel("Memory (Mb)", hostMemTargets, 4, "short")
-	hostNetworkPanel := GenerateXTimePanel(fmt.Sprintf("Network (tx/rx) (Mb) %s", networkIface), hostNetworkTargets, 4, "short")
-	infoPanel := GenerateXTimePanel("Generator Debug Info", infoTargets, 4, "short")
-	percPanel := GenerateXTimePanel("Response time (50,95)", percTargets, 4, "ms")
-	rpsPanel := GenerateXTimePanel("RPS (Total+Errors)", rpsTargets, 4, "short")
-	hostRow := GenerateRow("Generator host Metrics", hostCPUPanel, hostMemPanel, hostNetworkPanel)
-	generatorRow := GenerateRow("Generator Metrics", percPanel, rpsPanel, infoPanel)
+	return GenerateDashboardRows(q, labels)
+}
 
+// GenerateDashboardRows generator, rates, apdex and host rows from datasource queries
+func GenerateDashboardRows(q DashboardQueries, labels []string) []Row {
+	ds := "${" + q.Input().Name + "}"
+	panel := func(title string, targets []Target, span int, format string) Panel {
+		p := GenerateXTimePanel(title, targets, span, format)
+		p.Datasource = ds
+		return p
+	}
+	generatorRow := GenerateRow("Generator Metrics",
+		panel("Response time (50,95,99)", q.Latency(labels), 4, "ms"),
+		panel("RPS (Total+Errors)", q.Rate(labels), 4, "short"),
+		panel("Attackers", q.Attackers(), 4, "short"),
+	)
+	ratesRow := GenerateRow("Rates",
+		panel("Target vs achieved RPS", q.TargetRate(), 4, "short"),
+		panel("Errors by category", q.ErrorCategories(labels), 4, "short"),
+		panel("Bytes (in/out)", q.Bytes(labels), 4, "Bps"),
+	)
+	sloRow := GenerateRow("Apdex / SLO",
+		panel("Apdex", q.Gauges(labels, apdexLabelSuffixes), 6, "short"),
+		panel("SLO / Error budget left (%)", q.Gauges(labels, sloLabelSuffixes), 6, "percent"),
+	)
+	hostRow := GenerateRow("Generator host Metrics",
+		panel("CPU used (%)", q.HostCPU(), 4, "short"),
+		panel("Memory (Mb)", q.HostMemory(), 4, "short"),
+		panel("Network (tx/rx) (Mb)", q.HostNetwork(), 4, "short"),
+	)
+	return []Row{generatorRow, ratesRow, sloRow, hostRow}
+}
+
+// GenerateSuiteDashboardRows rows of every suite step with panels of step labels, then generator and host rows
+func GenerateSuiteDashboardRows(q DashboardQueries, suite *LabelManifest) []Row {
+	ds := "${" + q.Input().Name + "}"
+	panel := func(title string, targets []Target, span int, format string) Panel {
+		p := GenerateXTimePanel(title, targets, span, format)
+		p.Datasource = ds
+		return p
+	}
 	rows := make([]Row, 0)
-	rows = append(rows, generatorRow, hostRow)
-	return rows
+	for _, step := range suite.Steps {
+		rows = append(rows,
+			GenerateRow(fmt.Sprintf("Step %s", step.Name),
+				panel("Response time (50,95,99)", q.Latency(step.Labels), 4, "ms"),
+				panel("RPS (Total+Errors)", q.Rate(step.Labels), 4, "short"),
+				panel("Errors by category", q.ErrorCategories(step.Labels), 4, "short"),
+			),
+			GenerateRow(fmt.Sprintf("Step %s Apdex / SLO", step.Name),
+				panel("Bytes (in/out)", q.Bytes(step.Labels), 4, "Bps"),
+				panel("Apdex", q.Gauges(step.Labels, apdexLabelSuffixes), 4, "short"),
+				panel("SLO / Error budget left (%)", q.Gauges(step.Labels, sloLabelSuffixes), 4, "percent"),
+			),
+		)
+	}
+	generatorRow := GenerateRow("Generator Metrics",
+		panel("Attackers", q.Attackers(), 6, "short"),
+		panel("Target vs achieved RPS", q.TargetRate(), 6, "short"),
+	)
+	hostRow := GenerateRow("Generator host Metrics",
+		panel("CPU used (%)", q.HostCPU(), 4, "short"),
+		panel("Memory (Mb)", q.HostMemory(), 4, "short"),
+		panel("Network (tx/rx) (Mb)", q.HostNetwork(), 4, "short"),
+	)
+	return append(rows, generatorRow, hostRow)
+}
+
+// GrafanaDashboard dashboard of generator metrics in datasource of queries, with generator host and handle variables
+func GrafanaDashboard(title string, q DashboardQueries, labels []string) Dashboard {
+	return datasourceDashboard(title, q, GenerateDashboardRows(q, labels))
+}
+
+// SuiteDashboard dashboard of suite steps in datasource of queries, with generator host and handle variables
+func SuiteDashboard(title string, q DashboardQueries, suite *LabelManifest) Dashboard {
+	return datasourceDashboard(title, q, GenerateSuiteDashboardRows(q, suite))
+}
+
+func datasourceDashboard(title string, q DashboardQueries, rows []Row) Dashboard {
+	d := DefaultDSDashboard(title, rows)
+	in := q.Input()
+	d.Inputs[0].Name, d.Inputs[0].Label, d.Inputs[0].PluginID, d.Inputs[0].PluginName = in.Name, in.Label, in.PluginID, in.PluginName
+	d.Requires[2].ID, d.Requires[2].Name = in.PluginID, in.PluginName
+	for _, v := range q.Variables() {
+		d.Templating.List = append(d.Templating.List, v)
+	}
+	return d
+}
+
+// dashboardUID grafana uid from title, uid is limited to 40 chars
+func dashboardUID(title string) string {
+	uid := invalidLabelChars.ReplaceAllString(strings.ToLower(title), "-")
+	if len(uid) > 40 {
+		uid = uid[:40]
+	}
+	return uid
 }
 
 func DefaultDSDashboard(title string, rows []Row) Dashboard {
 	return Dashboard{
+		UID: dashboardUID(title),
 		Inputs: Inputs{
 			{
 				Name:        "DS_LOCAL_GRAPHITE",
@@ -501,43 +606,15 @@ func DefaultDSDashboard(title string, rows []Row) Dashboard {
 }
 
 func GrafanaGeneratorNodeDashboard(title string, labels []string, projectMetricPrefix string) Dashboard {
-	rows := GenerateNodeGeneratorRows(labels, projectMetricPrefix)
-	return DefaultDSDashboard(title, rows)
+	q := &graphiteQueries{
+		prefix:    "$" + generatorVariable,
+		generator: projectMetricPrefix,
+		iface:     viper.GetString("host.network_iface"),
+	}
+	return GrafanaDashboard(title, q, labels)
 }
 
 func GrafanaGeneratorsSummaryDashboard(title string, labels []string) Dashboard {
 	rows := GenerateSummaryRows(labels)
 	return DefaultDSDashboard(title, rows)
 }
-
-func CollectYamlLabels() []string {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(
-		fset,
-		fmt.Sprintf(labelsPath, viper.GetString("load_scripts_dir")),
-		nil,
-		parser.ParseComments,
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
-	declarations := make([]token.Pos, 0)
-	labels := make([]string, 0)
-	ast.Inspect(node, func(n ast.Node) bool {
-		var s string
-		switch x := n.(type) {
-		case *ast.BasicLit:
-			labels = append(labels, strings.Replace(x.Value, "\"", "", -1))
-		case *ast.GenDecl:
-			declarations = append(declarations, x.Pos())
-		}
-		if s != "" {
-			fmt.Printf("%s:\t%s\n", fset.Position(n.Pos()), s)
-		}
-		return true
-	})
-	if len(declarations) > 1 {
-		log.Fatal("labels.go file must contains only one const declaration, used to generate dashboards")
-	}
-	return labels
-}
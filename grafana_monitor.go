@@ -18,10 +18,11 @@ package loadgen
 
 import (
 	"context"
-	"sync/atomic"
 	"time"
 )
 
+// Monitored applies debug sleep and success criteria in attack,
+// metrics of every handle are sent to configured metrics sinks
 type Monitored struct {
 	Attack
 }
@@ -35,14 +36,15 @@ func (m Monitored) Do(ctx context.Context) DoResult {
 	if cfg.DebugSleep != 0 {
 		time.Sleep(time.Duration(cfg.DebugSleep) * time.Millisecond)
 	}
-	before := time.Now()
-	result := m.Attack.Do(ctx)
-	attackTime := time.Now().Sub(before)
-	m.GetRunner().registerLabelTimings(result.RequestLabel).Update(attackTime)
-	if result.Error != nil || result.StatusCode >= 400 {
-		m.GetRunner().registerErrCount(result.RequestLabel).Inc(1)
+	return m.GetRunner().checkResult(m.Attack.Do(ctx))
+}
+
+// ValidateResult calls result validator of monitored attack
+func (m Monitored) ValidateResult(res DoResult) error {
+	if v, ok := m.Attack.(ResultValidator); ok {
+		return v.ValidateResult(res)
 	}
-	return result
+	return nil
 }
 
 func (m Monitored) Setup(c RunnerConfig) error {
@@ -53,7 +55,5 @@ func (m Monitored) Setup(c RunnerConfig) error {
 }
 
 func (m Monitored) Clone(r *Runner) Attack {
-	atomic.AddInt64(&r.goroutinesCount, 1)
-	r.goroutinesCountGaugue.Update(r.goroutinesCount)
 	return Monitored{m.Attack.Clone(r)}
 }
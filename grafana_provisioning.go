@@ -0,0 +1,198 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// provisioningName name of datasource and dashboards provider files
+	provisioningName = "loadgen"
+	// GrafanaDashboardsPath path in grafana container dashboards dir of export is mounted to
+	GrafanaDashboardsPath = "/var/lib/grafana/dashboards/loadgen"
+)
+
+// defaultDatasourceURLs datasource urls of docker-compose services if grafana.datasource_url is not set
+var defaultDatasourceURLs = map[string]string{
+	GraphiteDatasource:   "http://graphite",
+	PrometheusDatasource: "http://prometheus:9090",
+	InfluxDBDatasource:   "http://influxdb:8086",
+}
+
+type provisionedDatasource struct {
+	Name      string `yaml:"name"`
+	Type      string `yaml:"type"`
+	Access    string `yaml:"access"`
+	URL       string `yaml:"url"`
+	Database  string `yaml:"database,omitempty"`
+	IsDefault bool   `yaml:"isDefault"`
+	Editable  bool   `yaml:"editable"`
+}
+
+type datasourcesProvisioning struct {
+	APIVersion  int                     `yaml:"apiVersion"`
+	Datasources []provisionedDatasource `yaml:"datasources"`
+}
+
+type dashboardProvider struct {
+	Name                  string            `yaml:"name"`
+	Folder                string            `yaml:"folder"`
+	Type                  string            `yaml:"type"`
+	DisableDeletion       bool              `yaml:"disableDeletion"`
+	UpdateIntervalSeconds int               `yaml:"updateIntervalSeconds"`
+	Options               map[string]string `yaml:"options"`
+}
+
+type dashboardsProvisioning struct {
+	APIVersion int                 `yaml:"apiVersion"`
+	Providers  []dashboardProvider `yaml:"providers"`
+}
+
+// datasourceProvisioning datasource of generated dashboards, url and database are taken from sinks and prometheus config if not set
+func datasourceProvisioning(c *GeneratorConfig, name string, pluginID string) provisionedDatasource {
+	ds := provisionedDatasource{
+		Name:      name,
+		Type:      pluginID,
+		Access:    "proxy",
+		URL:       c.Grafana.DatasourceURL,
+		IsDefault: true,
+		Editable:  true,
+	}
+	switch pluginID {
+	case PrometheusDatasource:
+		if ds.URL == "" && c.Prometheus != nil {
+			ds.URL = c.Prometheus.URL
+		}
+	case InfluxDBDatasource:
+		for _, s := range c.Sinks {
+			if s.Type != InfluxDBSinkType {
+				continue
+			}
+			ds.Database = s.Database
+			if ds.URL == "" && (strings.HasPrefix(s.URL, "http://") || strings.HasPrefix(s.URL, "https://")) {
+				ds.URL = s.URL
+			}
+			break
+		}
+	}
+	if ds.URL == "" {
+		ds.URL = defaultDatasourceURLs[pluginID]
+	}
+	return ds
+}
+
+// provisionedDashboard dashboard with datasource name instead of import input, provisioning doesn't resolve inputs
+func provisionedDashboard(d Dashboard) Dashboard {
+	if len(d.Inputs) == 0 {
+		return d
+	}
+	ref, name := "${"+d.Inputs[0].Name+"}", d.Inputs[0].Label
+	rows := make([]Row, len(d.Rows))
+	for i, r := range d.Rows {
+		r.Panels = append([]Panel{}, r.Panels...)
+		for j := range r.Panels {
+			if r.Panels[j].Datasource == ref {
+				r.Panels[j].Datasource = name
+			}
+		}
+		rows[i] = r
+	}
+	d.Rows = rows
+	vars := make([]interface{}, 0, len(d.Templating.List))
+	for _, v := range d.Templating.List {
+		if tv, ok := v.(TemplateVariable); ok && tv.Datasource == ref {
+			tv.Datasource = name
+			v = tv
+		}
+		vars = append(vars, v)
+	}
+	d.Templating.List = vars
+	d.Inputs = nil
+	return d
+}
+
+func writeYAML(path string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// WriteDashboardFiles writes dashboards and grafana provisioning files for docker-compose:
+//
+// dashboards/<uid>.json                  dashboards, mount dir to GrafanaDashboardsPath
+// provisioning/datasources/loadgen.yaml  datasource of dashboards
+// provisioning/dashboards/loadgen.yaml   dashboards provider, mount provisioning dir to /etc/grafana/provisioning
+func WriteDashboardFiles(dir string, c *GeneratorConfig, dashboards []Dashboard) error {
+	dashboardsDir := filepath.Join(dir, "dashboards")
+	datasourcesDir := filepath.Join(dir, "provisioning", "datasources")
+	providersDir := filepath.Join(dir, "provisioning", "dashboards")
+	for _, d := range []string{dashboardsDir, datasourcesDir, providersDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	datasources := make([]provisionedDatasource, 0)
+	for _, d := range dashboards {
+		for _, in := range d.Inputs {
+			ds := datasourceProvisioning(c, in.Label, in.PluginID)
+			if !containsDatasource(datasources, ds.Name) {
+				datasources = append(datasources, ds)
+			}
+		}
+		data, err := json.MarshalIndent(provisionedDashboard(d), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(dashboardsDir, d.UID+".json"), data); err != nil {
+			return fmt.Errorf("failed to write dashboard %s: %s", d.Title, err)
+		}
+	}
+	if err := writeYAML(filepath.Join(datasourcesDir, provisioningName+".yaml"), datasourcesProvisioning{
+		APIVersion:  1,
+		Datasources: datasources,
+	}); err != nil {
+		return err
+	}
+	return writeYAML(filepath.Join(providersDir, provisioningName+".yaml"), dashboardsProvisioning{
+		APIVersion: 1,
+		Providers: []dashboardProvider{{
+			Name:                  provisioningName,
+			Folder:                c.Grafana.Folder,
+			Type:                  "file",
+			UpdateIntervalSeconds: 30,
+			Options:               map[string]string{"path": GrafanaDashboardsPath},
+		}},
+	})
+}
+
+func containsDatasource(datasources []provisionedDatasource, name string) bool {
+	for _, ds := range datasources {
+		if ds.Name == name {
+			return true
+		}
+	}
+	return false
+}
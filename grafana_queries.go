@@ -0,0 +1,502 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dashboard datasource types
+const (
+	GraphiteDatasource   = "graphite"
+	PrometheusDatasource = "prometheus"
+	InfluxDBDatasource   = "influxdb"
+)
+
+var dashboardDatasources = []string{GraphiteDatasource, PrometheusDatasource, InfluxDBDatasource}
+
+const (
+	// influxRateIntervalSec interval counters are summed in to get per second rates
+	influxRateIntervalSec = 10
+	// templated variables of generated dashboards
+	generatorVariable = "generator"
+	handleVariable    = "handle"
+)
+
+// DatasourceInput grafana datasource dashboard is imported with
+type DatasourceInput struct {
+	// Name input name, panels use it as ${Name}
+	Name       string
+	Label      string
+	PluginID   string
+	PluginName string
+}
+
+// TemplateCurrent selected value of templated variable
+type TemplateCurrent struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// TemplateVariable grafana query variable
+type TemplateVariable struct {
+	Name       string           `json:"name"`
+	Label      string           `json:"label"`
+	Type       string           `json:"type"`
+	Datasource string           `json:"datasource"`
+	Query      string           `json:"query"`
+	Regex      string           `json:"regex"`
+	Refresh    int              `json:"refresh"`
+	Multi      bool             `json:"multi"`
+	IncludeAll bool             `json:"includeAll"`
+	AllValue   string           `json:"allValue,omitempty"`
+	Current    *TemplateCurrent `json:"current,omitempty"`
+	Sort       int              `json:"sort"`
+}
+
+// DashboardQueries panel targets of a datasource, every datasource renders the same panels from the same labels,
+// targets may use $generator and $handle variables
+type DashboardQueries interface {
+	// Input datasource of panels and variables
+	Input() DatasourceInput
+	// Variables templated variables: generator host and handle
+	Variables() []TemplateVariable
+	// Latency p50, p95 and p99 of every label in ms
+	Latency(labels []string) []Target
+	// Rate total and failed requests per second of every label
+	Rate(labels []string) []Target
+	// ErrorCategories failed requests per second of every label by error category
+	ErrorCategories(labels []string) []Target
+	// Bytes bytes in and out per second of every label
+	Bytes(labels []string) []Target
+	// TargetRate target vs achieved rps of handles
+	TargetRate() []Target
+	// Attackers running attackers of handles
+	Attackers() []Target
+	// Gauges label gauges, ex.: apdex, slo, error-budget
+	Gauges(labels []string, suffixes []string) []Target
+	// HostCPU, HostMemory and HostNetwork generator host metrics
+	HostCPU() []Target
+	HostMemory() []Target
+	HostNetwork() []Target
+}
+
+// NewDashboardQueries queries for grafana.datasource, graphite is default
+func NewDashboardQueries(c *GeneratorConfig) DashboardQueries {
+	name := c.Grafana.DatasourceName
+	switch c.Grafana.Datasource {
+	case PrometheusDatasource:
+		return &promQueries{name: name}
+	case InfluxDBDatasource:
+		prefix := defaultInfluxDBPrefix
+		for _, s := range c.Sinks {
+			if s.Type == InfluxDBSinkType && s.Prefix != "" {
+				prefix = s.Prefix
+				break
+			}
+		}
+		return &influxQueries{name: name, prefix: prefix}
+	default:
+		return &graphiteQueries{
+			name:      name,
+			prefix:    "$" + generatorVariable,
+			generator: c.Graphite.LoadGeneratorPrefix,
+			iface:     c.Host.NetworkIface,
+		}
+	}
+}
+
+func datasourceInput(name string, label string, pluginID string, pluginName string) DatasourceInput {
+	if label == "" {
+		label = "Local " + pluginName
+	}
+	return DatasourceInput{Name: name, Label: label, PluginID: pluginID, PluginName: pluginName}
+}
+
+func queryVariable(in DatasourceInput, name string, label string, query string, regex string) TemplateVariable {
+	return TemplateVariable{
+		Name:       name,
+		Label:      label,
+		Type:       "query",
+		Datasource: "${" + in.Name + "}",
+		Query:      query,
+		Regex:      regex,
+		Refresh:    2,
+		Multi:      true,
+		IncludeAll: true,
+		Sort:       1,
+	}
+}
+
+// graphiteQueries queries of graphite sink metrics, prefix is generator prefix or $generator
+type graphiteQueries struct {
+	name string
+	// prefix metrics prefix used in targets
+	prefix string
+	// generator selected generator prefix
+	generator string
+	iface     string
+}
+
+func (q *graphiteQueries) Input() DatasourceInput {
+	return datasourceInput("DS_LOCAL_GRAPHITE", q.name, "graphite", "Graphite")
+}
+
+func (q *graphiteQueries) Variables() []TemplateVariable {
+	generator := queryVariable(q.Input(), generatorVariable, "generator host", "*", "")
+	generator.Multi, generator.IncludeAll = false, false
+	if q.generator != "" {
+		generator.Current = &TemplateCurrent{Text: q.generator, Value: q.generator}
+	}
+	handle := queryVariable(q.Input(), handleVariable, "handle", q.prefix+".goroutines-*", "/goroutines-(.*)/")
+	return []TemplateVariable{generator, handle}
+}
+
+func (q *graphiteQueries) Latency(labels []string) []Target {
+	return GeneratePercentileTargets(labels, q.prefix)
+}
+
+func (q *graphiteQueries) Rate(labels []string) []Target {
+	return GenerateRPSTargets(labels, q.prefix)
+}
+
+func (q *graphiteQueries) ErrorCategories(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		targets = append(targets, Target{
+			Target: fmt.Sprintf(graphiteErrorCategoryTemplate, q.prefix, label, label),
+		})
+	}
+	return targets
+}
+
+func (q *graphiteQueries) Bytes(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range bytesLabelSuffixes {
+			targets = append(targets, Target{
+				Target: fmt.Sprintf(graphiteCounterRateTemplate, q.prefix, label, suffix, fmt.Sprintf(alias, label, suffix)),
+			})
+		}
+	}
+	return targets
+}
+
+func (q *graphiteQueries) runnerGauges(names ...string) []Target {
+	targets := make([]Target, 0)
+	for _, name := range names {
+		targets = append(targets, Target{
+			Target: fmt.Sprintf(graphiteRunnerGaugeTemplate, q.prefix, name, handleVariable, name),
+		})
+	}
+	return targets
+}
+
+func (q *graphiteQueries) TargetRate() []Target {
+	return q.runnerGauges("target_rps", "achieved_rps")
+}
+
+func (q *graphiteQueries) Attackers() []Target {
+	return q.runnerGauges("goroutines")
+}
+
+func (q *graphiteQueries) Gauges(labels []string, suffixes []string) []Target {
+	return GenerateGaugeTargets(labels, q.prefix, suffixes)
+}
+
+func (q *graphiteQueries) HostCPU() []Target {
+	return GenerateHostMetricTargets(metricValueTemplate, q.prefix, cpuScaleFactor, hostMetricCPUNames)
+}
+
+func (q *graphiteQueries) HostMemory() []Target {
+	return GenerateHostMetricTargets(metricValueTemplate, q.prefix, memScaleFactor, hostMetricMEMNames)
+}
+
+func (q *graphiteQueries) HostNetwork() []Target {
+	names := make([]string, 0, len(hostMetricNetworkNames))
+	for _, n := range hostMetricNetworkNames {
+		names = append(names, fmt.Sprintf(n, q.iface))
+	}
+	return GenerateHostMetricTargets(metricValueTemplate, q.prefix, netScaleFactor, names)
+}
+
+// promQueries PromQL queries of prometheus exporter metrics, generator is scrape instance
+type promQueries struct {
+	name string
+}
+
+func (q *promQueries) Input() DatasourceInput {
+	return datasourceInput("DS_PROMETHEUS", q.name, "prometheus", "Prometheus")
+}
+
+func (q *promQueries) Variables() []TemplateVariable {
+	generator := queryVariable(q.Input(), generatorVariable, "generator host", "label_values(loadgen_requests_total, instance)", "")
+	handle := queryVariable(q.Input(), handleVariable, "handle", `label_values(loadgen_requests_total{instance=~"$generator"}, runner)`, "")
+	generator.AllValue, handle.AllValue = ".*", ".*"
+	return []TemplateVariable{generator, handle}
+}
+
+// selector series of selected generators and handles, label is optional
+func (q *promQueries) selector(label string) string {
+	s := `runner=~"$handle",instance=~"$generator"`
+	if label != "" {
+		s = fmt.Sprintf(`label="%s",`, label) + s
+	}
+	return "{" + s + "}"
+}
+
+func (q *promQueries) Latency(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, p := range percentiles {
+			targets = append(targets, Target{
+				Expr: fmt.Sprintf(
+					"histogram_quantile(0.%s, sum by (le) (rate(loadgen_request_duration_seconds_bucket%s[1m]))) * 1000",
+					p, q.selector(label)),
+				LegendFormat: fmt.Sprintf(alias, label, p),
+			})
+		}
+	}
+	return targets
+}
+
+func (q *promQueries) Rate(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		targets = append(targets,
+			Target{
+				Expr:         fmt.Sprintf("sum(rate(loadgen_requests_total%s[1m]))", q.selector(label)),
+				LegendFormat: fmt.Sprintf(alias, label, "timer"),
+			},
+			Target{
+				Expr:         fmt.Sprintf("sum(rate(loadgen_errors_total%s[1m]))", q.selector(label)),
+				LegendFormat: fmt.Sprintf(alias, label, "err"),
+			})
+	}
+	return targets
+}
+
+func (q *promQueries) ErrorCategories(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		targets = append(targets, Target{
+			Expr:         fmt.Sprintf("sum by (category) (rate(loadgen_errors_total%s[1m]))", q.selector(label)),
+			LegendFormat: label + "-{{category}}",
+		})
+	}
+	return targets
+}
+
+func (q *promQueries) Bytes(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range bytesLabelSuffixes {
+			targets = append(targets, Target{
+				Expr: fmt.Sprintf("sum(rate(loadgen_%s_total%s[1m]))",
+					strings.Replace(suffix, "-", "_", -1), q.selector(label)),
+				LegendFormat: fmt.Sprintf(alias, label, suffix),
+			})
+		}
+	}
+	return targets
+}
+
+func (q *promQueries) runnerGauges(metric string, legend string) Target {
+	return Target{
+		Expr:         fmt.Sprintf("sum by (runner) (%s%s)", metric, q.selector("")),
+		LegendFormat: "{{runner}}-" + legend,
+	}
+}
+
+func (q *promQueries) TargetRate() []Target {
+	return []Target{
+		q.runnerGauges("loadgen_target_rps", "target"),
+		q.runnerGauges("loadgen_achieved_rps", "achieved"),
+	}
+}
+
+func (q *promQueries) Attackers() []Target {
+	return []Target{q.runnerGauges("loadgen_active_attackers", "attackers")}
+}
+
+func (q *promQueries) Gauges(labels []string, suffixes []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range suffixes {
+			targets = append(targets, Target{
+				Expr:         fmt.Sprintf("avg(loadgen_%s%s)", strings.Replace(suffix, "-", "_", -1), q.selector(label)),
+				LegendFormat: fmt.Sprintf(alias, label, suffix),
+			})
+		}
+	}
+	return targets
+}
+
+func (q *promQueries) hostTargets(scale string, names ...string) []Target {
+	targets := make([]Target, 0)
+	for _, name := range names {
+		targets = append(targets, Target{
+			Expr:         fmt.Sprintf(`%s{instance=~"$generator"} * %s`, name, scale),
+			LegendFormat: "{{host}}-" + strings.TrimPrefix(name, "loadgen_host_"),
+		})
+	}
+	return targets
+}
+
+func (q *promQueries) HostCPU() []Target {
+	return q.hostTargets(cpuScaleFactor, "loadgen_host_cpu_used_percent")
+}
+
+func (q *promQueries) HostMemory() []Target {
+	return q.hostTargets(memScaleFactor, "loadgen_host_memory_used_bytes", "loadgen_host_memory_total_bytes")
+}
+
+func (q *promQueries) HostNetwork() []Target {
+	return q.hostTargets(netScaleFactor, "loadgen_host_network_receive_bytes_per_second", "loadgen_host_network_transmit_bytes_per_second")
+}
+
+// influxQueries InfluxQL queries of influxdb sink measurements, generator is host tag of host metrics
+type influxQueries struct {
+	name   string
+	prefix string
+}
+
+func (q *influxQueries) Input() DatasourceInput {
+	return datasourceInput("DS_INFLUXDB", q.name, "influxdb", "InfluxDB")
+}
+
+func (q *influxQueries) measurement(name string) string {
+	return fmt.Sprintf(`"%s_%s"`, q.prefix, strings.Replace(name, "-", "_", -1))
+}
+
+func (q *influxQueries) Variables() []TemplateVariable {
+	return []TemplateVariable{
+		queryVariable(q.Input(), generatorVariable, "generator host",
+			fmt.Sprintf(`SHOW TAG VALUES FROM %s WITH KEY = "host"`, q.measurement("cpu_used")), ""),
+		queryVariable(q.Input(), handleVariable, "handle",
+			fmt.Sprintf(`SHOW TAG VALUES FROM %s WITH KEY = "runner"`, q.measurement("requests")), ""),
+	}
+}
+
+// query raw influxql target, label is optional
+func (q *influxQueries) query(selectExpr string, measurement string, label string, groupBy string, alias string) Target {
+	where := `"runner" =~ /^$handle$/`
+	if label != "" {
+		where = fmt.Sprintf(`"label" = '%s' AND `, label) + where
+	}
+	return Target{
+		Query: fmt.Sprintf("SELECT %s FROM %s WHERE %s AND $timeFilter GROUP BY %s fill(null)",
+			selectExpr, q.measurement(measurement), where, groupBy),
+		RawQuery:     true,
+		ResultFormat: "time_series",
+		Alias:        alias,
+	}
+}
+
+func (q *influxQueries) counterRate(measurement string, label string, by string, alias string) Target {
+	groupBy := fmt.Sprintf("time(%ds)", influxRateIntervalSec)
+	if by != "" {
+		groupBy += `, "` + by + `"`
+	}
+	return q.query(fmt.Sprintf(`sum("value") / %d`, influxRateIntervalSec), measurement, label, groupBy, alias)
+}
+
+func (q *influxQueries) Latency(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, p := range percentiles {
+			targets = append(targets, q.query(`mean("value")`, "latency_p"+p, label, "time($__interval)", fmt.Sprintf(alias, label, p)))
+		}
+	}
+	return targets
+}
+
+func (q *influxQueries) Rate(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		targets = append(targets,
+			q.counterRate("requests", label, "", fmt.Sprintf(alias, label, "timer")),
+			q.counterRate("errors", label, "", fmt.Sprintf(alias, label, "err")))
+	}
+	return targets
+}
+
+func (q *influxQueries) ErrorCategories(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		targets = append(targets, q.counterRate("errors", label, "category", label+"-$tag_category"))
+	}
+	return targets
+}
+
+func (q *influxQueries) Bytes(labels []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range bytesLabelSuffixes {
+			targets = append(targets, q.counterRate(suffix, label, "", fmt.Sprintf(alias, label, suffix)))
+		}
+	}
+	return targets
+}
+
+func (q *influxQueries) TargetRate() []Target {
+	return []Target{
+		q.query(`last("value")`, "target_rps", "", `time($__interval), "runner"`, "$tag_runner-target"),
+		q.query(`last("value")`, "achieved_rps", "", `time($__interval), "runner"`, "$tag_runner-achieved"),
+	}
+}
+
+func (q *influxQueries) Attackers() []Target {
+	return []Target{q.query(`last("value")`, "attackers", "", `time($__interval), "runner"`, "$tag_runner-attackers")}
+}
+
+func (q *influxQueries) Gauges(labels []string, suffixes []string) []Target {
+	targets := make([]Target, 0)
+	for _, label := range labels {
+		for _, suffix := range suffixes {
+			targets = append(targets, q.query(`last("value")`, suffix, label, "time($__interval)", fmt.Sprintf(alias, label, suffix)))
+		}
+	}
+	return targets
+}
+
+func (q *influxQueries) hostTargets(scale string, names ...string) []Target {
+	targets := make([]Target, 0)
+	for _, name := range names {
+		targets = append(targets, Target{
+			Query: fmt.Sprintf(`SELECT mean("value") * %s FROM %s WHERE "host" =~ /^$generator$/ AND $timeFilter GROUP BY time($__interval), "host", "iface" fill(null)`,
+				scale, q.measurement(name)),
+			RawQuery:     true,
+			ResultFormat: "time_series",
+			Alias:        "$tag_host-" + name,
+		})
+	}
+	return targets
+}
+
+func (q *influxQueries) HostCPU() []Target {
+	return q.hostTargets(cpuScaleFactor, hostMetricCPUNames...)
+}
+
+func (q *influxQueries) HostMemory() []Target {
+	return q.hostTargets(memScaleFactor, hostMetricMEMNames...)
+}
+
+func (q *influxQueries) HostNetwork() []Target {
+	return q.hostTargets(netScaleFactor, "net_rx", "net_tx")
+}
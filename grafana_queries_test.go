@@ -0,0 +1,108 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// dashboardQueries all panel queries of dashboard
+func dashboardQueries(d Dashboard) string {
+	var b strings.Builder
+	for _, r := range d.Rows {
+		for _, p := range r.Panels {
+			for _, t := range p.Targets {
+				b.WriteString(t.Target + t.Expr + t.Query + " | " + t.LegendFormat + t.Alias + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func TestGrafanaDashboardDatasources(t *testing.T) {
+	tests := []struct {
+		datasource string
+		input      string
+		queries    []string
+	}{
+		{GraphiteDatasource, "DS_LOCAL_GRAPHITE", []string{
+			"alias(scale($generator.first-timer.99-percentile, 0.000001), 'first-99')",
+			"aliasSub(perSecond($generator.first-err-*.count), '^.*(first-err-[^.]*).*$', '\\1')",
+			"alias(perSecond($generator.first-bytes-in.count), 'first-bytes-in')",
+			"aliasSub($generator.target_rps-$handle.value, '^.*\\.(target_rps-[^.]*)\\.value$', '\\1')",
+			"scale($generator.net_eth0_rx.value, 0.000001)",
+		}},
+		{PrometheusDatasource, "DS_PROMETHEUS", []string{
+			`histogram_quantile(0.99, sum by (le) (rate(loadgen_request_duration_seconds_bucket{label="first",runner=~"$handle",instance=~"$generator"}[1m]))) * 1000 | first-99`,
+			`sum by (category) (rate(loadgen_errors_total{label="first",runner=~"$handle",instance=~"$generator"}[1m])) | first-{{category}}`,
+			`sum(rate(loadgen_bytes_out_total{label="first",runner=~"$handle",instance=~"$generator"}[1m])) | first-bytes-out`,
+			`sum by (runner) (loadgen_achieved_rps{runner=~"$handle",instance=~"$generator"}) | {{runner}}-achieved`,
+			`avg(loadgen_error_budget{label="first",runner=~"$handle",instance=~"$generator"}) | first-error-budget`,
+		}},
+		{InfluxDBDatasource, "DS_INFLUXDB", []string{
+			`SELECT mean("value") FROM "load_latency_p95" WHERE "label" = 'first' AND "runner" =~ /^$handle$/ AND $timeFilter GROUP BY time($__interval) fill(null) | first-95`,
+			`SELECT sum("value") / 10 FROM "load_errors" WHERE "label" = 'first' AND "runner" =~ /^$handle$/ AND $timeFilter GROUP BY time(10s), "category" fill(null) | first-$tag_category`,
+			`SELECT last("value") FROM "load_target_rps" WHERE "runner" =~ /^$handle$/ AND $timeFilter GROUP BY time($__interval), "runner" fill(null) | $tag_runner-target`,
+			`FROM "load_cpu_used" WHERE "host" =~ /^$generator$/`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.datasource, func(t *testing.T) {
+			cfg := &GeneratorConfig{}
+			cfg.Grafana.Datasource = tt.datasource
+			cfg.Graphite.LoadGeneratorPrefix = "node1"
+			cfg.Host.NetworkIface = "eth0"
+			cfg.Sinks = []MetricsSinkConfig{{Type: InfluxDBSinkType, URL: "udp://127.0.0.1:8089", Prefix: "load"}}
+			d := GrafanaDashboard("load", NewDashboardQueries(cfg), []string{"first"})
+			if d.Inputs[0].Name != tt.input || d.Requires[2].ID != tt.datasource {
+				t.Fatalf("unexpected datasource: %+v %+v", d.Inputs, d.Requires)
+			}
+			for _, r := range d.Rows {
+				for _, p := range r.Panels {
+					if p.Datasource != "${"+tt.input+"}" {
+						t.Fatalf("panel %s has datasource %s", p.Title, p.Datasource)
+					}
+				}
+			}
+			queries := dashboardQueries(d)
+			for _, q := range tt.queries {
+				if !strings.Contains(queries, q) {
+					t.Fatalf("no %s in queries:\n%s", q, queries)
+				}
+			}
+			data, err := json.Marshal(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []string{`"name":"generator"`, `"name":"handle"`} {
+				if !strings.Contains(string(data), v) {
+					t.Fatalf("no %s variable in dashboard", v)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphiteNodeDashboardGenerator(t *testing.T) {
+	d := GrafanaGeneratorNodeDashboard("node1", []string{"first"}, "node1")
+	v := d.Templating.List[0].(TemplateVariable)
+	if v.Name != generatorVariable || v.Current == nil || v.Current.Value != "node1" {
+		t.Fatalf("generator variable must select node prefix: %+v", v)
+	}
+}
@@ -22,18 +22,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/spf13/viper"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
 var (
 	orgId             = 1
-	timerangeTemplate = "Grafana test data: %s/dashboard/db/observer?orgId=%d&from=%d&to=%d"
+	timerangeTemplate = "%s/dashboard/db/observer?orgId=%d&from=%d&to=%d"
 )
 
-func TimerangeUrl(fromEpoch int64, toEpoch int64) {
-	url := viper.GetString("grafana.url")
-	log.Infof(timerangeTemplate, url, orgId, fromEpoch, toEpoch)
+// TimerangeUrl logs and returns grafana dashboard link for time range
+func TimerangeUrl(fromEpoch int64, toEpoch int64) string {
+	url := fmt.Sprintf(timerangeTemplate, viper.GetString("grafana.url"), orgId, fromEpoch, toEpoch)
+	log.Infof("Grafana test data: %s", url)
+	return url
 }
 
 func basicAuth(username, password string) string {
@@ -56,55 +61,178 @@ type ImportPayload struct {
 	Dashboard Dashboard     `json:"dashboard"`
 	Overwrite bool          `json:"overwrite"`
 	Inputs    []UploadInput `json:"inputs"`
+	FolderID  int           `json:"folderId"`
 }
 
-func uploadDashboard(login string, passwd string, url string, dashboard Dashboard) {
+// GrafanaFolder grafana dashboards folder
+type GrafanaFolder struct {
+	ID    int    `json:"id"`
+	UID   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// GrafanaClient grafana http api client, api token is used if set, basic auth otherwise
+type GrafanaClient struct {
+	URL      string
+	Token    string
+	Login    string
+	Password string
+	HTTP     *http.Client
+}
+
+// NewGrafanaClient creates client from grafana config
+func NewGrafanaClient(c *GeneratorConfig) *GrafanaClient {
+	return &GrafanaClient{
+		URL:      strings.TrimSuffix(c.Grafana.URL, "/"),
+		Token:    c.Grafana.Token,
+		Login:    c.Grafana.Login,
+		Password: c.Grafana.Password,
+		HTTP:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends json body and decodes json response into out if it's not nil
+func (c *GrafanaClient) do(method string, path string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.URL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		req.Header.Set("Authorization", "Basic "+basicAuth(c.Login, c.Password))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s failed with %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// FolderID finds folder by title or creates it, empty title is General folder
+func (c *GrafanaClient) FolderID(title string) (int, error) {
+	if title == "" {
+		return 0, nil
+	}
+	var folders []GrafanaFolder
+	if err := c.do(http.MethodGet, "/api/folders", nil, &folders); err != nil {
+		return 0, err
+	}
+	for _, f := range folders {
+		if f.Title == title {
+			return f.ID, nil
+		}
+	}
+	var folder GrafanaFolder
+	if err := c.do(http.MethodPost, "/api/folders", map[string]string{"title": title}, &folder); err != nil {
+		return 0, err
+	}
+	log.Infof("created grafana folder %s", title)
+	return folder.ID, nil
+}
+
+// ImportDashboard imports dashboard to folder, dashboard with the same uid is overwritten
+func (c *GrafanaClient) ImportDashboard(dashboard Dashboard, folderID int) error {
 	payload := ImportPayload{
 		Dashboard: dashboard,
 		Overwrite: true,
-		Inputs: []UploadInput{
-			{
-				Name:     "DS_LOCAL_GRAPHITE",
-				Type:     "datasource",
-				PluginID: "graphite",
-				Value:    "Local Graphite",
-			},
-		},
-	}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		log.Fatal(err)
+		FolderID:  folderID,
+	}
+	for _, in := range dashboard.Inputs {
+		payload.Inputs = append(payload.Inputs, UploadInput{
+			Name:     in.Name,
+			Type:     "datasource",
+			PluginID: in.PluginID,
+			Value:    in.Label,
+		})
 	}
-	dataBuf := bytes.NewBuffer(data)
-	req, _ := http.NewRequest("POST", url, dataBuf)
-	req.Header.Add(
-		"Authorization",
-		"Basic "+basicAuth(login, passwd))
-	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return c.do(http.MethodPost, "/api/dashboards/import", payload, nil)
+}
+
+// GeneratorDashboards dashboards of suite steps for configured datasource, titled with generator prefix and suite name,
+// summary of all generators is graphite only, other datasources aggregate generators with variables
+func GeneratorDashboards(c *GeneratorConfig, suite *LabelManifest) []Dashboard {
+	title := c.Graphite.LoadGeneratorPrefix
+	if title == "" {
+		title = "loadgen"
+	}
+	if suite.Suite != "" {
+		title = fmt.Sprintf("%s-%s", title, suite.Suite)
+	}
+	q := NewDashboardQueries(c)
+	dashboards := make([]Dashboard, 0)
+	if c.Grafana.Datasource == "" || c.Grafana.Datasource == GraphiteDatasource {
+		summary := GrafanaGeneratorsSummaryDashboard(fmt.Sprintf("%s-summary", title), suite.Labels())
+		summary.Inputs[0].Label = q.Input().Label
+		dashboards = append(dashboards, summary)
+	}
+	return append(dashboards, SuiteDashboard(title, q, suite))
+}
+
+// UploadDashboards imports dashboards to grafana.folder
+func UploadDashboards(c *GeneratorConfig, dashboards []Dashboard) error {
+	client := NewGrafanaClient(c)
+	folderID, err := client.FolderID(c.Grafana.Folder)
 	if err != nil {
+		return fmt.Errorf("failed to find grafana folder %s: %s", c.Grafana.Folder, err)
+	}
+	for _, d := range dashboards {
+		if err := client.ImportDashboard(d, folderID); err != nil {
+			return fmt.Errorf("failed to import dashboard %s: %s", d.Title, err)
+		}
+		log.Infof("dashboard %s is imported to %s", d.Title, client.URL)
+	}
+	return nil
+}
+
+// DashboardCommand generates dashboards of suite handles and labels from suite label manifest,
+// writes them with grafana provisioning files to out dir if set and uploads them if upload is set,
+// dashboards are uploaded if out dir is not set
+func DashboardCommand(suitePath string, out string, upload bool) {
+	var cfg GeneratorConfig
+	if err := viper.Unmarshal(&cfg); err != nil {
 		log.Fatal(err)
 	}
-	if resp.Body == nil {
-		log.Fatalf("no upload body received, exiting")
+	if suitePath == "" {
+		log.Fatal("please set suite config, ex.: loadcli dashboard suite.yaml")
 	}
-	respBody, err := ioutil.ReadAll(resp.Body)
+	suite := LoadSuiteConfig(suitePath)
+	seen, err := LoadLabelManifest(LabelManifestPath(cfg.reportDir(), suitePath))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer resp.Body.Close()
-	log.Infof("import result: %s", respBody)
-}
-
-func UploadGrafanaDashboard() {
-	title := viper.GetString("graphite.loadGeneratorPrefix")
-	url := viper.GetString("grafana.url") + "/api/dashboards/import"
-	login := viper.GetString("grafana.login")
-	passwd := viper.GetString("grafana.password")
-	log.Infof("importing grafana dashboard to %s", url)
-	summaryDashboard := GrafanaGeneratorsSummaryDashboard(fmt.Sprintf("%s-summary", title), CollectYamlLabels())
-	uploadDashboard(login, passwd, url, summaryDashboard)
-	nodeDashboard := GrafanaGeneratorNodeDashboard(title, CollectYamlLabels(), title)
-	uploadDashboard(login, passwd, url, nodeDashboard)
+	dashboards := GeneratorDashboards(&cfg, SuiteLabels(suiteName(suitePath), suite, seen))
+	if out != "" {
+		if err := WriteDashboardFiles(out, &cfg, dashboards); err != nil {
+			log.Fatalf("failed to write dashboards: %s", err)
+		}
+		log.Infof("dashboards and provisioning files are written to %s", out)
+	}
+	if out == "" || upload {
+		log.Infof("importing grafana dashboards to %s", cfg.Grafana.URL)
+		if err := UploadDashboards(&cfg, dashboards); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,169 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// testGrafana grafana api stand-in, dashboards are kept by uid
+type testGrafana struct {
+	mu         *sync.Mutex
+	auth       []string
+	folders    []GrafanaFolder
+	dashboards map[string]ImportPayload
+}
+
+func newTestGrafana() *testGrafana {
+	return &testGrafana{
+		mu:         &sync.Mutex{},
+		folders:    []GrafanaFolder{{ID: 3, UID: "general-load", Title: "existing"}},
+		dashboards: make(map[string]ImportPayload),
+	}
+}
+
+func (g *testGrafana) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.auth = append(g.auth, req.Header.Get("Authorization"))
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/api/folders":
+		json.NewEncoder(w).Encode(g.folders)
+	case req.Method == http.MethodPost && req.URL.Path == "/api/folders":
+		var body map[string]string
+		json.NewDecoder(req.Body).Decode(&body)
+		f := GrafanaFolder{ID: len(g.folders) + 10, Title: body["title"]}
+		g.folders = append(g.folders, f)
+		json.NewEncoder(w).Encode(f)
+	case req.Method == http.MethodPost && req.URL.Path == "/api/dashboards/import":
+		var p ImportPayload
+		json.NewDecoder(req.Body).Decode(&p)
+		if _, ok := g.dashboards[p.Dashboard.UID]; ok && !p.Overwrite {
+			http.Error(w, `{"message":"dashboard with the same uid already exists"}`, http.StatusPreconditionFailed)
+			return
+		}
+		g.dashboards[p.Dashboard.UID] = p
+		w.Write([]byte(`{"imported":true}`))
+	default:
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func TestUploadDashboards(t *testing.T) {
+	setupLogger("console", "error")
+	g := newTestGrafana()
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+	cfg := &GeneratorConfig{}
+	cfg.Grafana.URL = srv.URL + "/"
+	cfg.Grafana.Token = "secret"
+	cfg.Grafana.Folder = "load"
+	cfg.Graphite.LoadGeneratorPrefix = "observer"
+	dashboards := GeneratorDashboards(cfg, &LabelManifest{Steps: []StepLabels{{Name: "load", Labels: []string{"first"}}}})
+	for i := 0; i < 2; i++ {
+		if err := UploadDashboards(cfg, dashboards); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(g.dashboards) != 2 || len(g.folders) != 2 {
+		t.Fatalf("upload must be idempotent, got dashboards %d, folders %+v", len(g.dashboards), g.folders)
+	}
+	p, ok := g.dashboards["observer"]
+	if !ok || p.FolderID != g.folders[1].ID || !p.Overwrite {
+		t.Fatalf("unexpected import of node dashboard: %+v", p)
+	}
+	if len(p.Inputs) != 1 || p.Inputs[0].Name != "DS_LOCAL_GRAPHITE" || p.Inputs[0].Value != "Local Graphite" {
+		t.Fatalf("unexpected inputs: %+v", p.Inputs)
+	}
+	for _, a := range g.auth {
+		if a != "Bearer secret" {
+			t.Fatalf("unexpected authorization %q", a)
+		}
+	}
+
+	cfg.Grafana.Token, cfg.Grafana.Folder = "", "existing"
+	cfg.Grafana.Login, cfg.Grafana.Password = "admin", "admin"
+	if err := UploadDashboards(cfg, dashboards); err != nil {
+		t.Fatal(err)
+	}
+	if g.dashboards["observer"].FolderID != 3 || g.auth[len(g.auth)-1] != "Basic "+basicAuth("admin", "admin") {
+		t.Fatalf("unexpected folder or basic auth: %d %s", g.dashboards["observer"].FolderID, g.auth[len(g.auth)-1])
+	}
+
+	cfg.Grafana.URL = srv.URL + "/missing"
+	if err := UploadDashboards(cfg, dashboards); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestWriteDashboardFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loadgen-dashboards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &GeneratorConfig{}
+	cfg.Grafana.Datasource = PrometheusDatasource
+	cfg.Grafana.Folder = "load"
+	cfg.Prometheus = &Prometheus{URL: "http://prom:9090"}
+	cfg.Graphite.LoadGeneratorPrefix = "observer"
+	if err := WriteDashboardFiles(dir, cfg, GeneratorDashboards(cfg, &LabelManifest{Steps: []StepLabels{{Name: "load", Labels: []string{"first"}}}})); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dashboards", "observer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "${DS_PROMETHEUS}") || strings.Contains(string(data), "__inputs") {
+		t.Fatalf("provisioned dashboard must reference datasource by name:\n%s", data)
+	}
+	var d Dashboard
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Rows[0].Panels[0].Datasource != "Local Prometheus" {
+		t.Fatalf("unexpected panel datasource %s", d.Rows[0].Panels[0].Datasource)
+	}
+
+	var ds datasourcesProvisioning
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "provisioning", "datasources", "loadgen.yaml"))
+	if err := yaml.Unmarshal(data, &ds); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Datasources) != 1 || ds.Datasources[0].Name != "Local Prometheus" || ds.Datasources[0].Type != "prometheus" || ds.Datasources[0].URL != "http://prom:9090" {
+		t.Fatalf("unexpected datasources: %+v", ds)
+	}
+	var providers dashboardsProvisioning
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "provisioning", "dashboards", "loadgen.yaml"))
+	if err := yaml.Unmarshal(data, &providers); err != nil {
+		t.Fatal(err)
+	}
+	if len(providers.Providers) != 1 || providers.Providers[0].Folder != "load" || providers.Providers[0].Options["path"] != GrafanaDashboardsPath {
+		t.Fatalf("unexpected dashboard providers: %+v", providers)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	graphite "github.com/cyberdelia/go-metrics-graphite"
+	"github.com/rcrowley/go-metrics"
+)
+
+// GraphiteSink sends metrics registry to graphite, metric names are the same as in generated grafana dashboards:
+// <label>-timer, <label>-err, <label>-err-<category>, <label>-bytes-in, <label>-apdex, goroutines-<runner>, cpu_used, net_<iface>_rx
+type GraphiteSink struct {
+	cfg graphite.Config
+	// registry metrics of handle runs, they are unregistered when their handles are finished
+	registry metrics.Registry
+	// ownersMu guards owners
+	ownersMu *sync.Mutex
+	// owners handle runs which update a metric, step/handle by metric name
+	owners    map[string]map[string]bool
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// graphiteRegistry sends sink metrics and custom metrics registered in default registry, see RegisterGauge
+type graphiteRegistry struct {
+	metrics.Registry
+	custom metrics.Registry
+}
+
+func (r graphiteRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(f)
+	r.custom.Each(func(name string, i interface{}) {
+		if r.Registry.Get(name) == nil {
+			f(name, i)
+		}
+	})
+}
+
+// NewGraphiteSink starts sending handle metrics to graphite at addr every flush interval,
+// custom metrics registered in default registry are sent too
+func NewGraphiteSink(addr string, prefix string, flushInterval time.Duration) (*GraphiteSink, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve graphite address %s: %s", addr, err)
+	}
+	registry := metrics.NewRegistry()
+	s := &GraphiteSink{
+		cfg: graphite.Config{
+			Addr:          tcpAddr,
+			Registry:      graphiteRegistry{Registry: registry, custom: metrics.DefaultRegistry},
+			FlushInterval: flushInterval,
+			DurationUnit:  time.Nanosecond,
+			Prefix:        prefix,
+			Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+		},
+		registry:  registry,
+		ownersMu:  &sync.Mutex{},
+		owners:    make(map[string]map[string]bool),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := graphite.Once(s.cfg); err != nil {
+					log.Errorf("failed to send metrics to graphite: %s", err)
+				}
+			}
+		}
+	}()
+	return s, nil
+}
+
+// own records handle run as an owner of metric
+func (s *GraphiteSink) own(name string, step string, handle string) string {
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	owners, ok := s.owners[name]
+	if !ok {
+		owners = make(map[string]bool)
+		s.owners[name] = owners
+	}
+	owners[step+"/"+handle] = true
+	return name
+}
+
+func (s *GraphiteSink) Result(step string, handle string, res DoResult, elapsed time.Duration) {
+	metrics.GetOrRegisterTimer(s.own(res.RequestLabel+"-timer", step, handle), s.registry).Update(elapsed)
+	if category := ClassifyError(res); category != "" {
+		metrics.GetOrRegisterCounter(s.own(res.RequestLabel+"-err", step, handle), s.registry).Inc(1)
+		metrics.GetOrRegisterCounter(s.own(res.RequestLabel+"-err-"+category, step, handle), s.registry).Inc(1)
+	}
+	if res.BytesIn > 0 {
+		metrics.GetOrRegisterCounter(s.own(res.RequestLabel+"-bytes-in", step, handle), s.registry).Inc(res.BytesIn)
+	}
+	if res.BytesOut > 0 {
+		metrics.GetOrRegisterCounter(s.own(res.RequestLabel+"-bytes-out", step, handle), s.registry).Inc(res.BytesOut)
+	}
+}
+
+// HandleFinished sends metrics of finished handle run and unregisters metrics no other running handle updates,
+// so the next step starts from zero counters and timers
+func (s *GraphiteSink) HandleFinished(step string, handle string) {
+	if err := graphite.Once(s.cfg); err != nil {
+		log.Errorf("failed to send metrics to graphite: %s", err)
+	}
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	for name, owners := range s.owners {
+		delete(owners, step+"/"+handle)
+		if len(owners) == 0 {
+			s.registry.Unregister(name)
+			delete(s.owners, name)
+		}
+	}
+}
+
+// graphiteGaugeName dashboard name of a gauge
+func graphiteGaugeName(name string, tags map[string]string) string {
+	switch {
+	case tags["label"] != "":
+		return tags["label"] + "-" + strings.Replace(name, "_", "-", -1)
+	case name == "attackers":
+		return "goroutines-" + tags["runner"]
+	case tags["runner"] != "":
+		return name + "-" + tags["runner"]
+	case tags["iface"] != "" && strings.HasPrefix(name, "net_"):
+		return fmt.Sprintf("net_%s_%s", tags["iface"], strings.TrimPrefix(name, "net_"))
+	}
+	return name
+}
+
+func (s *GraphiteSink) Gauge(name string, tags map[string]string, value float64) {
+	gaugeName := graphiteGaugeName(name, tags)
+	if tags["runner"] != "" {
+		s.own(gaugeName, tags["step"], tags["runner"])
+	}
+	metrics.GetOrRegisterGaugeFloat64(gaugeName, s.registry).Update(value)
+}
+
+// Close sends metrics for the last time
+func (s *GraphiteSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = graphite.Once(s.cfg)
+	})
+	return err
+}
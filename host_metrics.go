@@ -17,9 +17,9 @@
 package loadgen
 
 import (
-	"fmt"
 	"github.com/mackerelio/go-osstat/memory"
 	"github.com/mackerelio/go-osstat/network"
+	"sync"
 	"time"
 
 	"github.com/mackerelio/go-osstat/cpu"
@@ -85,43 +85,34 @@ func (m *HostMetrics) GetMem() *memory.Stats {
 	return mem
 }
 
-type HostMetrics struct {
-	hostPrefix       string
-	graphiteUrl      string
-	flushDuration    time.Duration
-	networkInterface string
-
-	cpuUserSystemPercent metrics.Gauge
+// HostSample generator host metrics at a moment
+type HostSample struct {
+	Time       time.Time `json:"time"`
+	CPUPercent int64     `json:"cpu_percent"`
+	MemUsed    uint64    `json:"mem_used"`
+	MemTotal   uint64    `json:"mem_total"`
+	Rx         int64     `json:"rx"`
+	Tx         int64     `json:"tx"`
+}
 
-	memTotal     metrics.Gauge
-	memFree      metrics.Gauge
-	memUsed      metrics.Gauge
-	memCached    metrics.Gauge
-	memSwapTotal metrics.Gauge
-	memSwapUsed  metrics.Gauge
-	memSwapFree  metrics.Gauge
+type HostMetrics struct {
+	samplesMu *sync.Mutex
+	// samples are kept for suite report
+	samples []HostSample
 
-	rx metrics.Gauge
-	tx metrics.Gauge
+	hostName         string
+	networkInterface string
+	// sink receives host gauges
+	sink MetricsSink
 }
 
-// NewOsMetrics
-func NewHostOSMetrics(hostPrefix string, graphiteUrl string, flushDurationSec int, networkInterface string) *HostMetrics {
+// NewHostOSMetrics creates generator host monitor sending gauges to sink
+func NewHostOSMetrics(hostName string, networkInterface string, sink MetricsSink) *HostMetrics {
 	return &HostMetrics{
-		hostPrefix:           hostPrefix,
-		graphiteUrl:          graphiteUrl,
-		flushDuration:        time.Duration(flushDurationSec),
-		networkInterface:     networkInterface,
-		cpuUserSystemPercent: RegisterGauge("cpu_used"),
-		memTotal:             RegisterGauge("mem_total"),
-		memFree:              RegisterGauge("mem_free"),
-		memUsed:              RegisterGauge("mem_used"),
-		memCached:            RegisterGauge("mem_cached"),
-		memSwapTotal:         RegisterGauge("mem_swap_total"),
-		memSwapUsed:          RegisterGauge("mem_swap_used"),
-		memSwapFree:          RegisterGauge("mem_swap_free"),
-		rx:                   RegisterGauge(fmt.Sprintf("net_%s_rx", networkInterface)),
-		tx:                   RegisterGauge(fmt.Sprintf("net_%s_tx", networkInterface)),
+		samplesMu:        &sync.Mutex{},
+		hostName:         hostName,
+		networkInterface: networkInterface,
+		sink:             sink,
 	}
 }
 
@@ -129,29 +120,59 @@ func NewHostOSMetrics(hostPrefix string, graphiteUrl string, flushDurationSec in
 func (m *HostMetrics) Watch(intervalSec int) {
 	go func() {
 		ticker := time.NewTicker(time.Duration(intervalSec) * time.Second)
+		tags := map[string]string{"host": m.hostName}
+		netTags := map[string]string{"host": m.hostName, "iface": m.networkInterface}
 		for {
 			select {
 			case <-ticker.C:
 				cpuUserSystem := m.GetCPU()
-				m.cpuUserSystemPercent.Update(cpuUserSystem)
+				m.sink.Gauge("cpu_used", tags, float64(cpuUserSystem))
 
 				mem := m.GetMem()
-				m.memTotal.Update(int64(mem.Total))
-				m.memFree.Update(int64(mem.Free))
-				m.memUsed.Update(int64(mem.Used))
-				m.memCached.Update(int64(mem.Cached))
-				m.memSwapTotal.Update(int64(mem.SwapTotal))
-				m.memSwapUsed.Update(int64(mem.SwapUsed))
-				m.memSwapFree.Update(int64(mem.SwapFree))
+				m.sink.Gauge("mem_total", tags, float64(mem.Total))
+				m.sink.Gauge("mem_free", tags, float64(mem.Free))
+				m.sink.Gauge("mem_used", tags, float64(mem.Used))
+				m.sink.Gauge("mem_cached", tags, float64(mem.Cached))
+				m.sink.Gauge("mem_swap_total", tags, float64(mem.SwapTotal))
+				m.sink.Gauge("mem_swap_used", tags, float64(mem.SwapUsed))
+				m.sink.Gauge("mem_swap_free", tags, float64(mem.SwapFree))
 
 				rx, tx := m.GetNetwork()
-				m.rx.Update(rx)
-				m.tx.Update(tx)
+				m.sink.Gauge("net_rx", netTags, float64(rx))
+				m.sink.Gauge("net_tx", netTags, float64(tx))
+
+				m.samplesMu.Lock()
+				m.samples = append(m.samples, HostSample{
+					Time:       time.Now(),
+					CPUPercent: cpuUserSystem,
+					MemUsed:    mem.Used,
+					MemTotal:   mem.Total,
+					Rx:         rx,
+					Tx:         tx,
+				})
+				m.samplesMu.Unlock()
 			}
 		}
 	}()
 }
 
+// Samples host metrics collected so far
+func (m *HostMetrics) Samples() []HostSample {
+	m.samplesMu.Lock()
+	defer m.samplesMu.Unlock()
+	return append([]HostSample{}, m.samples...)
+}
+
+// Last the latest host metrics sample
+func (m *HostMetrics) Last() (HostSample, bool) {
+	m.samplesMu.Lock()
+	defer m.samplesMu.Unlock()
+	if len(m.samples) == 0 {
+		return HostSample{}, false
+	}
+	return m.samples[len(m.samples)-1], true
+}
+
 // RegisterGauge registers gauge metric to graphite
 func RegisterGauge(name string) metrics.Gauge {
 	g := metrics.NewGauge()
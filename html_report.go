@@ -0,0 +1,516 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wcharczuk/go-chart"
+	"gopkg.in/yaml.v2"
+)
+
+// HTMLReportFile suite html report file name in run dir
+const HTMLReportFile = "report.html"
+
+// SuiteReport results of a suite run
+type SuiteReport struct {
+	Suite            string       `json:"suite"`
+	StartedAt        time.Time    `json:"startedAt"`
+	FinishedAt       time.Time    `json:"finishedAt"`
+	Interrupted      bool         `json:"interrupted"`
+	Failed           bool         `json:"failed"`
+	ValidationFailed bool         `json:"validationFailed"`
+	Degraded         bool         `json:"degraded"`
+	GrafanaURL       string       `json:"grafanaUrl,omitempty"`
+	Steps            []StepReport `json:"steps"`
+	Regressions      []Regression `json:"regressions,omitempty"`
+	Host             []HostSample `json:"host,omitempty"`
+	Annotations      []Annotation `json:"annotations,omitempty"`
+	SuiteConfig      *SuiteConfig `json:"suiteConfig"`
+	// GeneratorConfig generator config of the run, credentials are masked
+	GeneratorConfig *GeneratorConfig `json:"generatorConfig,omitempty"`
+}
+
+// StepReport results of a suite step
+type StepReport struct {
+	Name          string       `json:"name"`
+	ExecutionMode string       `json:"executionMode"`
+	Reports       []*RunReport `json:"reports"`
+}
+
+// SuiteReport collects results of every step, steps skipped on resume are included from stored reports
+func (m *LoadManager) SuiteReport() *SuiteReport {
+	rep := &SuiteReport{
+		Suite:            m.SuiteConfigPath,
+		StartedAt:        m.StartedAt,
+		FinishedAt:       m.FinishedAt,
+		Interrupted:      m.Interrupted,
+		Failed:           m.Failed,
+		ValidationFailed: m.ValidationFailed,
+		Degraded:         m.Degradation,
+		GrafanaURL:       m.GrafanaURL,
+		Regressions:      m.Regressions,
+		SuiteConfig:      m.SuiteConfig,
+		GeneratorConfig:  m.GeneratorConfig.redacted(),
+		Annotations:      m.Annotations(),
+	}
+	if m.HostMetrics != nil {
+		rep.Host = m.HostMetrics.Samples()
+	}
+	for _, step := range m.Steps {
+		sr := StepReport{Name: step.Name, ExecutionMode: step.ExecutionMode}
+		for _, r := range m.runReports {
+			if r.Step == step.Name {
+				sr.Reports = append(sr.Reports, r)
+			}
+		}
+		rep.Steps = append(rep.Steps, sr)
+	}
+	return rep
+}
+
+// Status overall suite status
+func (r *SuiteReport) Status() string {
+	switch {
+	case r.Interrupted:
+		return "interrupted"
+	case r.GeneratorBound():
+		return "generator-bound"
+	case r.ValidationFailed:
+		return "validation failed"
+	case r.Failed:
+		return "failed"
+	case r.Degraded:
+		return "degraded"
+	}
+	return "passed"
+}
+
+// GeneratorBound checks if any handle run is marked generator-bound
+func (r *SuiteReport) GeneratorBound() bool {
+	for _, s := range r.Steps {
+		for _, rep := range s.Reports {
+			if rep.GeneratorBound {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Saturated checks if generator was the bottleneck of any handle run
+func (r *SuiteReport) Saturated() bool {
+	for _, s := range r.Steps {
+		for _, rep := range s.Reports {
+			if len(rep.Saturation) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StoreHTMLReport writes self-contained html report of the suite run to report dir
+func (m *LoadManager) StoreHTMLReport() {
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, m.SuiteReport()); err != nil {
+		log.Errorf("failed to render html report: %s", err)
+		return
+	}
+	createDirIfNotExists(m.RunDir())
+	repPath := filepath.Join(m.RunDir(), HTMLReportFile)
+	if err := writeFileAtomic(repPath, buf.Bytes()); err != nil {
+		log.Errorf("failed to write html report: %s", err)
+		return
+	}
+	log.Infof("html report is written to %s", repPath)
+}
+
+// htmlRun view of one handle run
+type htmlRun struct {
+	Name        string
+	Report      *RunReport
+	Labels      []string
+	Status      string
+	LatencySVG  template.HTML
+	RateSVG     template.HTML
+	StatusCodes []string
+}
+
+type htmlStep struct {
+	Name          string
+	ExecutionMode string
+	Runs          []htmlRun
+}
+
+type htmlReport struct {
+	*SuiteReport
+	Steps               []htmlStep
+	HostSVG             template.HTML
+	ConfigYAML          string
+	GeneratorConfigYAML string
+	Generated           time.Time
+}
+
+func runStatus(r *RunReport) string {
+	switch {
+	case r.Interrupted:
+		return "interrupted"
+	case r.GeneratorBound:
+		return "generator-bound"
+	case r.Failed:
+		return "stop check fired"
+	case r.Degraded:
+		return "degraded"
+	case len(sloViolations(r)) != 0:
+		return "slo violated"
+	case hasErrors(r):
+		return "errors"
+	}
+	return "passed"
+}
+
+// WriteHTMLReport renders suite report as a single html file, charts are inline svg so it opens offline
+func WriteHTMLReport(out io.Writer, rep *SuiteReport) error {
+	view := htmlReport{SuiteReport: rep, Generated: time.Now()}
+	for _, s := range rep.Steps {
+		hs := htmlStep{Name: s.Name, ExecutionMode: s.ExecutionMode}
+		for _, r := range s.Reports {
+			run := htmlRun{
+				Name:   reportName(r),
+				Report: r,
+				Labels: sortedLabels(r),
+				Status: runStatus(r),
+			}
+			codes := make(map[string]bool)
+			for _, m := range r.Metrics {
+				for code := range m.StatusCodes {
+					codes[code] = true
+				}
+			}
+			for code := range codes {
+				run.StatusCodes = append(run.StatusCodes, code)
+			}
+			sort.Strings(run.StatusCodes)
+			run.LatencySVG = latencyChartSVG(r.Series)
+			run.RateSVG = rateChartSVG(r.Series)
+			hs.Runs = append(hs.Runs, run)
+		}
+		view.Steps = append(view.Steps, hs)
+	}
+	view.HostSVG = hostChartSVG(rep.Host)
+	if rep.SuiteConfig != nil {
+		b, err := yaml.Marshal(rep.SuiteConfig)
+		if err != nil {
+			return err
+		}
+		view.ConfigYAML = string(b)
+	}
+	if rep.GeneratorConfig != nil {
+		b, err := yaml.Marshal(rep.GeneratorConfig)
+		if err != nil {
+			return err
+		}
+		view.GeneratorConfigYAML = string(b)
+	}
+	return htmlReportTemplate.Execute(out, view)
+}
+
+// statusClass css class of a run or suite status, ex.: slo violated -> slo-violated
+func statusClass(status string) string {
+	return strings.Replace(strings.ToLower(status), " ", "-", -1)
+}
+
+// redactedValue replaces credentials in configs shown in reports
+const redactedValue = "<redacted>"
+
+// redacted copy of generator config without credentials
+func (c *GeneratorConfig) redacted() *GeneratorConfig {
+	if c == nil {
+		return nil
+	}
+	mask := func(v string) string {
+		if v == "" {
+			return v
+		}
+		return redactedValue
+	}
+	maskHeaders := func(headers map[string]string) map[string]string {
+		if headers == nil {
+			return nil
+		}
+		res := make(map[string]string, len(headers))
+		for k, v := range headers {
+			res[k] = mask(v)
+		}
+		return res
+	}
+	r := *c
+	r.Grafana.Password = mask(c.Grafana.Password)
+	r.Grafana.Token = mask(c.Grafana.Token)
+	r.ResultsPush.Headers = maskHeaders(c.ResultsPush.Headers)
+	r.Sinks = make([]MetricsSinkConfig, 0, len(c.Sinks))
+	for _, s := range c.Sinks {
+		s.Token = mask(s.Token)
+		s.Headers = maskHeaders(s.Headers)
+		r.Sinks = append(r.Sinks, s)
+	}
+	return &r
+}
+
+type svgLine struct {
+	name   string
+	values []float64
+	dashed bool
+}
+
+// svgChart renders lines over seconds of the run as inline svg, empty if there are not enough points
+func svgChart(yName string, xValues []float64, lines []svgLine) template.HTML {
+	if len(xValues) < 2 {
+		return ""
+	}
+	series := make([]chart.Series, 0, len(lines))
+	for i, l := range lines {
+		style := chart.Style{
+			StrokeColor: chart.GetDefaultColor(i).WithAlpha(255),
+			StrokeWidth: 2,
+		}
+		if l.dashed {
+			style.StrokeDashArray = []float64{5.0, 3.0}
+		}
+		series = append(series, chart.ContinuousSeries{
+			Name:    l.name,
+			Style:   style,
+			XValues: xValues,
+			YValues: l.values,
+		})
+	}
+	graph := chart.Chart{
+		Width:  800,
+		Height: 300,
+		Background: chart.Style{
+			Padding: chart.Box{Top: 20, Left: 20, Right: 20, Bottom: 20},
+		},
+		XAxis:  chart.XAxis{Name: "Time (sec)"},
+		YAxis:  chart.YAxis{Name: yName},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{chart.LegendLeft(&graph)}
+	var buf bytes.Buffer
+	if err := graph.Render(chart.SVG, &buf); err != nil {
+		log.Infof("failed to render report chart: %s", err)
+		return ""
+	}
+	return template.HTML(buf.String())
+}
+
+func latencyChartSVG(series []Snapshot) template.HTML {
+	x := make([]float64, 0, len(series))
+	p50, p95, p99 := make([]float64, 0), make([]float64, 0), make([]float64, 0)
+	for i, s := range series {
+		x = append(x, float64(i+1))
+		p50 = append(p50, latencyMs(s.P50))
+		p95 = append(p95, latencyMs(s.P95))
+		p99 = append(p99, latencyMs(s.P99))
+	}
+	return svgChart("Latency (ms)", x, []svgLine{{name: "p50", values: p50}, {name: "p95", values: p95}, {name: "p99", values: p99}})
+}
+
+func rateChartSVG(series []Snapshot) template.HTML {
+	x := make([]float64, 0, len(series))
+	achieved, target, errs := make([]float64, 0), make([]float64, 0), make([]float64, 0)
+	for i, s := range series {
+		x = append(x, float64(i+1))
+		achieved = append(achieved, float64(s.Requests))
+		target = append(target, float64(s.TargetRPS))
+		errs = append(errs, float64(s.Errors))
+	}
+	return svgChart("RPS", x, []svgLine{
+		{name: "achieved", values: achieved},
+		{name: "target", values: target, dashed: true},
+		{name: "errors", values: errs},
+	})
+}
+
+func hostChartSVG(samples []HostSample) template.HTML {
+	if len(samples) == 0 {
+		return ""
+	}
+	start := samples[0].Time
+	x := make([]float64, 0, len(samples))
+	cpuUsed, memUsed := make([]float64, 0), make([]float64, 0)
+	for _, s := range samples {
+		x = append(x, s.Time.Sub(start).Seconds())
+		cpuUsed = append(cpuUsed, float64(s.CPUPercent))
+		mem := 0.0
+		if s.MemTotal > 0 {
+			mem = float64(s.MemUsed) / float64(s.MemTotal) * 100
+		}
+		memUsed = append(memUsed, mem)
+	}
+	return svgChart("Percent", x, []svgLine{{name: "cpu", values: cpuUsed}, {name: "memory", values: memUsed}})
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(d time.Duration) string {
+		return fmt.Sprintf("%.2f", latencyMs(d))
+	},
+	"percent": func(v float64) string {
+		return fmt.Sprintf("%.2f%%", v*100)
+	},
+	"rate": func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	},
+	"statusClass": statusClass,
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"duration": func(from time.Time, to time.Time) string {
+		return to.Sub(from).Round(time.Second).String()
+	},
+	"mb": func(v uint64) string {
+		return fmt.Sprintf("%.0f MB", float64(v)/1024/1024)
+	},
+}).Parse(htmlReportTmpl))
+
+const htmlReportTmpl = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Load test report {{ .Suite }} {{ time .StartedAt }}</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+h3 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em 0; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+th { background: #f4f4f4; }
+td.name, th.name { text-align: left; }
+.status { font-weight: bold; padding: 2px 6px; border-radius: 3px; }
+.passed { background: #d4f4d4; }
+.interrupted, .degraded, .errors, .generator-bound { background: #fbeec0; }
+.failed, .stop-check-fired, .validation-failed, .slo-violated { background: #f8d0d0; }
+.charts svg { margin-right: 1em; }
+pre { background: #f8f8f8; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Load test report: {{ .Suite }}</h1>
+<p>
+  Status: <span class="status {{ statusClass .Status }}">{{ .Status }}</span><br>
+  Started: {{ time .StartedAt }}, finished: {{ time .FinishedAt }}, duration: {{ duration .StartedAt .FinishedAt }}<br>
+  {{ if .GrafanaURL }}Grafana: <a href="{{ .GrafanaURL }}">{{ .GrafanaURL }}</a><br>{{ end }}
+  Generated: {{ time .Generated }}
+</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th class="name">Step</th><th class="name">Handle</th><th class="name">Label</th><th>Requests</th><th>Rate</th><th>Success</th><th>Mean ms</th><th>p50 ms</th><th>p95 ms</th><th>p99 ms</th><th>Max ms</th><th>Unique errors</th><th class="name">Status</th></tr>
+{{ range $step := .Steps }}{{ range $run := .Runs }}{{ range $label := .Labels }}{{ with index $run.Report.Metrics $label }}
+<tr><td class="name">{{ $step.Name }}</td><td class="name">{{ $run.Name }}</td><td class="name">{{ $label }}</td><td>{{ .Requests }}</td><td>{{ rate .Rate }}</td><td>{{ percent .Success }}</td><td>{{ ms .Latencies.Mean }}</td><td>{{ ms .Latencies.P50 }}</td><td>{{ ms .Latencies.P95 }}</td><td>{{ ms .Latencies.P99 }}</td><td>{{ ms .Latencies.Max }}</td><td>{{ len .Errors }}</td><td class="name"><span class="status {{ statusClass $run.Status }}">{{ $run.Status }}</span></td></tr>
+{{ end }}{{ end }}{{ end }}{{ end }}
+</table>
+
+<h2>Checks</h2>
+<table>
+<tr><th class="name">Check</th><th class="name">Result</th></tr>
+<tr><td class="name">Stop checks</td><td class="name">{{ if .Failed }}<span class="status failed">fired</span>{{ else }}<span class="status passed">passed</span>{{ end }}</td></tr>
+<tr><td class="name">Max rps validation</td><td class="name">{{ if .ValidationFailed }}<span class="status failed">failed</span>{{ else }}<span class="status passed">passed</span>{{ end }}</td></tr>
+<tr><td class="name">Regression</td><td class="name">{{ if .Degraded }}<span class="status degraded">degraded</span>{{ else }}<span class="status passed">passed</span>{{ end }}</td></tr>
+</table>
+{{ if .Saturated }}
+<h2>Generator saturation</h2>
+<p>Generator was the bottleneck, results of these handles show generator limits, not target capacity</p>
+<table>
+<tr><th class="name">Time</th><th class="name">Step</th><th class="name">Handle</th><th class="name">Reason</th><th class="name">Details</th></tr>
+{{ range $step := .Steps }}{{ range $run := .Runs }}{{ range $run.Report.Saturation }}<tr><td class="name">{{ time .Time }}</td><td class="name">{{ $step.Name }}</td><td class="name">{{ $run.Name }}</td><td class="name">{{ .Reason }}</td><td class="name">{{ .Text }}</td></tr>
+{{ end }}{{ end }}{{ end }}</table>
+{{ end }}
+{{ if .Regressions }}
+<table>
+<tr><th class="name">Handle</th><th class="name">Label</th><th class="name">Metric</th><th>Baseline</th><th>Current</th><th>Change</th><th>Threshold</th><th class="name">Status</th></tr>
+{{ range .Regressions }}<tr><td class="name">{{ .Handle }}</td><td class="name">{{ .Label }}</td><td class="name">{{ .Metric }}</td><td>{{ rate .Baseline }}</td><td>{{ rate .Current }}</td><td>{{ .Change }}</td><td>{{ .Threshold }}</td><td class="name">{{ if .Regressed }}<span class="status degraded">regressed</span>{{ else }}ok{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}
+
+{{ range .Steps }}
+<h2>Step {{ .Name }} ({{ .ExecutionMode }})</h2>
+{{ range $run := .Runs }}
+<h3>{{ .Name }} <span class="status {{ statusClass .Status }}">{{ .Status }}</span></h3>
+<p>
+  Target rps: {{ .Report.Configuration.RPS }}, max attackers: {{ .Report.Configuration.MaxAttackers }},
+  attack: {{ .Report.Configuration.AttackTimeSec }}s, ramp up: {{ .Report.Configuration.RampUpTimeSec }}s
+  {{ if .Report.RunError }}<br>Run error: {{ .Report.RunError }}{{ end }}
+  {{ if .Report.CarriedOver }}<br>Step was skipped on resume, results are carried over from the previous run{{ end }}
+</p>
+<div class="charts">{{ .LatencySVG }}{{ .RateSVG }}</div>
+{{ if .StatusCodes }}
+<table>
+<tr><th class="name">Label</th>{{ range .StatusCodes }}<th>{{ . }}</th>{{ end }}</tr>
+{{ range $label := .Labels }}<tr><td class="name">{{ $label }}</td>{{ $m := index $run.Report.Metrics $label }}{{ range $run.StatusCodes }}<td>{{ index $m.StatusCodes . }}</td>{{ end }}</tr>
+{{ end }}</table>
+{{ end }}
+{{ if .Report.Configuration.SLO }}
+<table>
+<tr><th class="name">Label</th><th>Apdex</th><th>Satisfied</th><th>Tolerating</th><th>Frustrated</th><th>Within SLO</th><th>Objective</th><th>Error budget left</th><th class="name">Status</th></tr>
+{{ range $label := .Labels }}{{ with (index $run.Report.Metrics $label).SLO }}<tr><td class="name">{{ $label }}</td><td>{{ printf "%.3f" .Apdex }}</td><td>{{ .Satisfied }}</td><td>{{ .Tolerating }}</td><td>{{ .Frustrated }}</td><td>{{ printf "%.2f%%" .Attainment }}</td><td>{{ if .Objective }}{{ printf "%.2f%%" .Objective }}{{ end }}</td><td>{{ if .Objective }}{{ printf "%.1f%%" .ErrorBudgetRemaining }}{{ end }}</td><td class="name">{{ if .Violated }}<span class="status failed">violated</span>{{ else }}<span class="status passed">met</span>{{ end }}</td></tr>
+{{ end }}{{ end }}</table>
+{{ end }}
+{{ range $label := .Labels }}{{ with index $run.Report.Metrics $label }}{{ if .ErrorCategories }}
+<p>Errors of {{ $label }}:</p>
+<table>
+<tr><th class="name">Category</th><th>Count</th><th class="name">Samples</th></tr>
+{{ range $category, $c := .ErrorCategories }}<tr><td class="name">{{ $category }}</td><td>{{ $c.Count }}</td><td class="name">{{ range $c.Samples }}<code>{{ . }}</code><br>{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Errors }}
+<table>
+<tr><th class="name">Error</th><th>Count</th></tr>
+{{ $m := . }}{{ range .Errors }}<tr><td class="name"><code>{{ . }}</code></td><td>{{ index $m.ErrorCounts . }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ end }}{{ end }}
+{{ end }}
+{{ end }}
+
+{{ if .Annotations }}
+<h2>Timeline</h2>
+<table>
+<tr><th class="name">Time</th><th class="name">Event</th><th class="name">Step</th><th class="name">Handle</th><th class="name">Details</th></tr>
+{{ range .Annotations }}<tr><td class="name">{{ time .Time }}</td><td class="name">{{ .Kind }}</td><td class="name">{{ .Step }}</td><td class="name">{{ .Handle }}</td><td class="name">{{ .Text }}</td></tr>
+{{ end }}</table>
+{{ end }}
+
+{{ if .Host }}
+<h2>Generator host</h2>
+<div class="charts">{{ .HostSVG }}</div>
+{{ end }}
+
+<h2>Configuration</h2>
+{{ if .GeneratorConfigYAML }}<h3>Generator</h3>
+<pre>{{ .GeneratorConfigYAML }}</pre>{{ end }}
+<h3>Suite</h3>
+<pre>{{ .ConfigYAML }}</pre>
+</body>
+</html>
+`
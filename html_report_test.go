@@ -0,0 +1,86 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	setupLogger("console", "error")
+	m := testRegressionManager("")
+	m.SuiteConfig = &SuiteConfig{Steps: []Step{{Name: "steady", ExecutionMode: "parallel"}}}
+	m.Steps = []RunStep{{Name: "steady", ExecutionMode: "parallel"}}
+	rep := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 0.5, 100)
+	rep.Step = "steady"
+	rep.Configuration.HandleName = "first"
+	rep.Metrics["first"].StatusCodes = map[string]int{"200": 5, "500": 5}
+	rep.Metrics["first"].Errors = []string{"<internal error>"}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		rep.Series = append(rep.Series, Snapshot{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			TargetRPS: 10,
+			Requests:  i + 1,
+			P50:       time.Duration(i+1) * time.Millisecond,
+			P95:       time.Duration(i+2) * time.Millisecond,
+			P99:       time.Duration(i+3) * time.Millisecond,
+		})
+	}
+	fired := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	fired.Step = "steady"
+	fired.Configuration.HandleName = "second"
+	fired.Failed = true
+	m.runReports = []*RunReport{rep, fired}
+	m.GeneratorConfig.Host.Name = "load-vm"
+	m.GeneratorConfig.Grafana.Token = "grafana-secret"
+	m.Regressions = m.CompareReports("first", rep, testRegressionReport(50*time.Millisecond, 100*time.Millisecond, 1, 100))
+	m.Degradation = true
+
+	var out bytes.Buffer
+	if err := WriteHTMLReport(&out, m.SuiteReport()); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, expected := range []string{"Step steady (parallel)", "<svg", "&lt;internal error&gt;", "regressed", "class=\"status degraded\"", "class=\"status stop-check-fired\"", "load-vm", "&lt;redacted&gt;"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("html report has no %q", expected)
+		}
+	}
+	if strings.Contains(html, "grafana-secret") {
+		t.Error("html report must not show credentials")
+	}
+	if strings.Count(html, "<svg") != 2 {
+		t.Errorf("expected latency and rps charts, got %d", strings.Count(html, "<svg"))
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, expected := range map[string]string{
+		"passed":           "passed",
+		"slo violated":     "slo-violated",
+		"stop check fired": "stop-check-fired",
+		"generator-bound":  "generator-bound",
+	} {
+		if got := statusClass(status); got != expected {
+			t.Errorf("%q class is %q, expected %q", status, got, expected)
+		}
+	}
+}
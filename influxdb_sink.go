@@ -0,0 +1,171 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultInfluxDBPrefix measurement prefix if sink prefix is not set
+const defaultInfluxDBPrefix = "loadgen"
+
+// influxUDPMaxPacket udp payload size safe for most networks
+const influxUDPMaxPacket = 1432
+
+// influxDBWriter writes points in influxdb line protocol over udp or http:
+// <prefix>_<name>,runner=first,step=load,label=get value=12.5 <unix ns>
+type influxDBWriter struct {
+	prefix string
+	// conn is set for udp
+	conn net.Conn
+	// writeURL and token are set for http
+	writeURL string
+	token    string
+	client   *http.Client
+}
+
+// newInfluxDBWriter creates writer from sink url: udp://host:8089 or http(s)://host:8086,
+// http writes go to /write?db=<database>, token is sent for influxdb 2 compatibility api
+func newInfluxDBWriter(c MetricsSinkConfig) (*influxDBWriter, error) {
+	u, err := sinkURL(c.URL, "udp")
+	if err != nil {
+		return nil, err
+	}
+	w := &influxDBWriter{prefix: c.Prefix}
+	if w.prefix == "" {
+		w.prefix = defaultInfluxDBPrefix
+	}
+	switch u.Scheme {
+	case "udp":
+		if w.conn, err = net.Dial("udp", u.Host); err != nil {
+			return nil, fmt.Errorf("failed to connect to influxdb %s: %s", u.Host, err)
+		}
+	case "http", "https":
+		if c.Database == "" {
+			return nil, fmt.Errorf("database is required for influxdb http api")
+		}
+		q := u.Query()
+		q.Set("db", c.Database)
+		q.Set("precision", "ns")
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+		u.RawQuery = q.Encode()
+		w.writeURL = u.String()
+		w.token = c.Token
+		w.client = &http.Client{Timeout: 10 * time.Second}
+	default:
+		return nil, fmt.Errorf("unknown influxdb url scheme %q, must be udp, http or https", u.Scheme)
+	}
+	return w, nil
+}
+
+func influxEscape(v string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(v)
+}
+
+// influxLine renders point in line protocol, counters are integers
+func (w *influxDBWriter) influxLine(p MetricPoint) string {
+	var b strings.Builder
+	b.WriteString(influxEscape(w.prefix + "_" + p.Name))
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if p.Tags[k] == "" {
+			continue
+		}
+		b.WriteString("," + influxEscape(k) + "=" + influxEscape(p.Tags[k]))
+	}
+	if p.Counter {
+		fmt.Fprintf(&b, " value=%di %d", int64(p.Value), p.Time.UnixNano())
+	} else {
+		fmt.Fprintf(&b, " value=%s %d", promFloat(p.Value), p.Time.UnixNano())
+	}
+	return b.String()
+}
+
+func (w *influxDBWriter) writePoints(points []MetricPoint) error {
+	if w.conn != nil {
+		return w.writeUDP(points)
+	}
+	return w.writeHTTP(points)
+}
+
+// writeUDP sends lines batched into packets
+func (w *influxDBWriter) writeUDP(points []MetricPoint) error {
+	var buf bytes.Buffer
+	send := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := w.conn.Write(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	for _, p := range points {
+		line := w.influxLine(p)
+		if buf.Len() > 0 && buf.Len()+len(line)+1 > influxUDPMaxPacket {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return send()
+}
+
+func (w *influxDBWriter) writeHTTP(points []MetricPoint) error {
+	var buf bytes.Buffer
+	for _, p := range points {
+		buf.WriteString(w.influxLine(p))
+		buf.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, w.writeURL, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("influxdb write failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (w *influxDBWriter) close() error {
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
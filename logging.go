@@ -63,10 +63,15 @@ func (m *Logger) FromCtx(ctx context.Context) *Logger {
 }
 
 func setupLogger(encoding string, level string) *Logger {
+	return setupLoggerOutput(encoding, level, "stdout", "/tmp/logs")
+}
+
+// setupLoggerOutput logger writing to output paths, ex.: stdout or file path
+func setupLoggerOutput(encoding string, level string, outputs ...string) *Logger {
 	rawJSON := []byte(fmt.Sprintf(`{
 	  "level": "%s",
 	  "encoding": "%s",
-	  "outputPaths": ["stdout", "/tmp/logs"],
+	  "outputPaths": [],
 	  "errorOutputPaths": ["stderr"],
 	  "encoderConfig": {
 	    "messageKey": "message",
@@ -84,6 +89,7 @@ func setupLogger(encoding string, level string) *Logger {
 		panic(err)
 	}
 	cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	cfg.OutputPaths = outputs
 	logger, err := cfg.Build()
 	if err != nil {
 		panic(err)
@@ -26,13 +26,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
-	"strconv"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/insolar/x-crypto/ecdsa"
-	"github.com/spf13/viper"
 )
 
 const (
@@ -75,6 +74,54 @@ type LoadManager struct {
 	Failed bool
 	// When max rps validation failed
 	ValidationFailed bool
+	// Regressions results of the last degradation check
+	Regressions []Regression
+	// Interrupted is set when suite is stopped before all steps are done, by signal or control api
+	Interrupted bool
+	// SuiteConfigPath path of suite config
+	SuiteConfigPath string
+	// RunMode selects steps to run: all, resume or only failed, see SuiteState
+	RunMode string
+	// state suite progress persisted in report dir
+	state *SuiteState
+	// HostMetrics generator host monitor, nil if host metrics are not collected
+	HostMetrics *HostMetrics
+	// StartedAt and FinishedAt suite run time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// GrafanaURL grafana dashboard link for suite time range
+	GrafanaURL string
+	// RunID id of the current run, reports are stored in runs/<run id> subdir of report dir
+	RunID string
+	// runReports reports of every handle run in suite order, including validation runs
+	runReports []*RunReport
+	// resultLog every request result, nil if reports.results_log is not set
+	resultLog *ResultLog
+	// exporter prometheus metrics, it's one of sinks, nil if prometheus_exporter.listen is not set
+	exporter *PromExporter
+	// annotations what generator was doing during the run, guarded by annotationsMu
+	annotations   []Annotation
+	annotationsMu sync.Mutex
+	// annotator posts annotations to grafana, nil if grafana.annotations is not set
+	annotator *grafanaAnnotator
+	// saturation detects if generator is the bottleneck, nil until suite is started
+	saturation *SaturationDetector
+	// dashboard live terminal dashboard, nil if not enabled
+	dashboard *TerminalDashboard
+	// sinks live metrics backends
+	sinks multiSink
+
+	// controlMu guards current step
+	controlMu   *sync.RWMutex
+	currentStep int
+	// stopping is set when suite is stopped before all steps are done
+	stopping *AtomicBool
+	// skipStep is set when current step is skipped
+	skipStep *AtomicBool
+	// reported is set when all reports of the suite are written
+	reported AtomicBool
+	// reportFetched is set when html report is fetched from web ui
+	reportFetched AtomicBool
 }
 
 type RunStep struct {
@@ -100,10 +147,17 @@ func NewLoadManager(suiteCfg *SuiteConfig, genCfg *GeneratorConfig) *LoadManager
 		Reports:         make(map[string]*RunReport),
 		CsvStore:        make(map[string]*CSVData),
 		Degradation:     false,
+		controlMu:       &sync.RWMutex{},
+		stopping:        &AtomicBool{},
+		skipStep:        &AtomicBool{},
+	}
+	if lm.ReportDir, err = filepath.Abs(genCfg.reportDir()); err != nil {
+		log.Fatal(err)
 	}
-	if lm.ReportDir, err = filepath.Abs(filepath.Join("example_loadtest", "reports")); err != nil {
+	if err := SetErrorNormalizationRules(genCfg.Errors.Normalize); err != nil {
 		log.Fatal(err)
 	}
+	lm.sinks = newMetricsSinks(genCfg)
 	return lm
 }
 
@@ -130,24 +184,46 @@ func (m *LoadManager) SetupHandleStore(handle RunnerConfig) {
 	}
 }
 
+// HandleShutdownSignal stops suite gracefully on first SIGINT/SIGTERM, partial reports are written,
+// second signal forces exit
 func (m *LoadManager) HandleShutdownSignal() {
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		<-sigs
-		log.Info("exit signal received, exiting")
+		sig := <-sigs
+		log.Infof("%s received, stopping suite gracefully, send it again to force exit", sig)
 		if m.SuiteConfig.GoroutinesDump {
 			buf := make([]byte, 1<<20)
 			stacklen := runtime.Stack(buf, true)
-			log.Infof("=== received SIGTERM ===\n*** goroutine dump...\n%s\n*** end\n", buf[:stacklen])
+			log.Infof("=== received %s ===\n*** goroutine dump...\n%s\n*** end\n", sig, buf[:stacklen])
 		}
-		os.Exit(1)
+		go m.Stop()
+		sig = <-sigs
+		log.Infof("%s received again, exiting", sig)
+		os.Exit(ExitInterrupted)
 	}()
 }
 
 func (m *LoadManager) Shutdown() {
+	if m.dashboard != nil {
+		m.dashboard.Stop()
+	}
+	if m.saturation != nil {
+		m.saturation.Stop()
+	}
+	if m.annotator != nil {
+		m.annotator.Close()
+	}
 	m.CSVLog.Flush()
 	m.RPSScalingLog.Flush()
+	if m.resultLog != nil {
+		if err := m.resultLog.Close(); err != nil {
+			log.Errorf("failed to close result log: %s", err)
+		}
+	}
+	if err := m.sinks.Close(); err != nil {
+		log.Error(err)
+	}
 	for _, s := range m.CsvStore {
 		s.Flush()
 		s.f.Close()
@@ -157,13 +233,38 @@ func (m *LoadManager) Shutdown() {
 // RunSuite starts suite and wait for all generator to shutdown
 func (m *LoadManager) RunSuite() {
 	m.HandleShutdownSignal()
+	if addr := m.GeneratorConfig.Control.Listen; addr != "" {
+		m.StartControlServer(addr)
+	}
+	if addr := m.GeneratorConfig.PrometheusExporter.Listen; addr != "" {
+		m.StartPrometheusExporter(addr)
+	}
 
 	t := timeNow()
+	m.StartedAt = t
+	m.RunID = NewRunID(t)
+	m.openResultLog()
 	startTime := epochNowMillis(t)
 	hrStartTime := timeHumanReadable(t)
 
-	for _, step := range m.Steps {
+	m.initSuiteState()
+	m.startAnnotations()
+	m.startSaturationDetector()
+	for i, step := range m.Steps {
+		if m.stopping.Get() {
+			log.Infof("suite is stopped, skipping step: %s", step.Name)
+			continue
+		}
+		if m.skipStepFromState(step.Name) {
+			continue
+		}
+		for _, r := range step.Runners {
+			delete(m.Reports, reportKey(step.Name, r.name, false))
+			delete(m.Reports, reportKey(step.Name, r.name, true))
+		}
+		m.setCurrentStep(i)
 		log.Infof("running step: %s, execution mode: %s", step.Name, step.ExecutionMode)
+		m.annotate(AnnotationStepStart, step.Name, "", fmt.Sprintf("step %s started, execution mode: %s", step.Name, step.ExecutionMode))
 		switch step.ExecutionMode {
 		case ParallelMode:
 			var wg sync.WaitGroup
@@ -176,28 +277,60 @@ func (m *LoadManager) RunSuite() {
 			wg.Wait()
 		case SequenceMode:
 			for _, r := range step.Runners {
+				if !m.stepRunnable() {
+					break
+				}
 				r.SetupHandleStore(m)
 				r.Run(nil, m)
 			}
 		case SequenceValidateMode:
 			for _, r := range step.Runners {
+				if !m.stepRunnable() {
+					break
+				}
 				r.SetupHandleStore(m)
 				r.Run(nil, m)
-				r.SetValidationParams()
+				if r.interrupted.Get() || !m.stepRunnable() {
+					continue
+				}
+				if err := r.SetValidationParams(); err != nil {
+					r.L.Warnf("skipping max rps validation: %s", err)
+					continue
+				}
 				r.Run(nil, m)
 			}
 		default:
 			log.Fatal("please set execution_mode, parallel, sequence or sequence_validate")
 		}
+		m.saveStepState(step)
+		m.annotate(AnnotationStepFinish, step.Name, "", fmt.Sprintf("step %s finished: %s", step.Name, m.state.Step(step.Name).Status))
 	}
+	// no step is running, live views show the suite as finished
+	m.setCurrentStep(len(m.Steps))
+	m.FinishedAt = timeNow()
 	if m.GeneratorConfig.Grafana.URL != "" {
-		t = timeNow()
-		finishTime := epochNowMillis(t)
-		hrFinishTime := timeHumanReadable(t)
+		finishTime := epochNowMillis(m.FinishedAt)
+		hrFinishTime := timeHumanReadable(m.FinishedAt)
 
-		TimerangeUrl(startTime, finishTime)
+		m.GrafanaURL = TimerangeUrl(startTime, finishTime)
 		HumanReadableTestInterval(hrStartTime, hrFinishTime)
 	}
+	if m.stopping.Get() {
+		log.Infof("suite was interrupted, writing partial reports")
+		m.Interrupted = true
+	}
+	if !m.GeneratorConfig.Checks.Skip {
+		m.CheckErrors()
+		m.CheckSLO()
+		m.CheckDegradation()
+	}
+	m.StoreHandleReports()
+	m.StoreHTMLReport()
+	m.StoreCIReports()
+	m.updateRunIndex()
+	m.StoreLabelManifest()
+	m.reported.Set(true)
+	m.PushResults()
 	m.Shutdown()
 }
 
@@ -211,77 +344,95 @@ func (m *LoadManager) CsvForHandle(name string) *CSVData {
 	return s
 }
 
-// StoreHandleReports stores report for every handle in suite
+// StoreHandleReports stores report for every handle in run dir, see RunDir,
+// run is added to the index by updateRunIndex, successful reports are used as a baseline
 func (m *LoadManager) StoreHandleReports() {
-	ts := time.Now().Unix()
-	for handleName, r := range m.Reports {
+	if m.RunID == "" {
+		m.RunID = NewRunID(timeNow())
+	}
+	createDirIfNotExists(m.RunDir())
+	for key, r := range m.Reports {
 		b, err := json.MarshalIndent(r, "", "    ")
 		if err != nil {
 			log.Fatal(err)
 		}
-		repPath := filepath.Join(m.ReportDir, fmt.Sprintf(ReportFileTmpl, handleName, ts))
-		log.Infof("writing report for handle [%s] in %s", handleName, repPath)
-		f, err := os.Open(repPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if _, err := f.Write(b); err != nil {
+		repPath := filepath.Join(m.RunDir(), fmt.Sprintf(HandleReportFileTmpl, key))
+		log.Infof("writing report for handle [%s] in %s", key, repPath)
+		if err := writeFileAtomic(repPath, b); err != nil {
 			log.Fatal(err)
 		}
-		if !m.Degradation {
-			m.WriteLastSuccess(handleName, ts)
-		}
-	}
-}
-
-// WriteLastSuccess writes ts of last successful run for handle
-func (m *LoadManager) WriteLastSuccess(handleName string, ts int64) {
-	lastSuccessFile := filepath.Join(m.ReportDir, handleName+"_last")
-	createFileIfNotExists(lastSuccessFile)
-	err := ioutil.WriteFile(lastSuccessFile, []byte(strconv.Itoa(int(ts))), 0777)
-	if err != nil {
-		log.Fatal(err)
 	}
 }
 
-// CheckErrors checkStopIf Errors logic
+// CheckErrors fails the run if any handle has errors, partial results of interrupted handles are not checked
 func (m *LoadManager) CheckErrors() {
 	for handleName, currentReport := range m.Reports {
-		if len(currentReport.Metrics[handleName].Errors) > 0 {
+		if currentReport.Interrupted {
+			continue
+		}
+		if hasErrors(currentReport) {
+			log.Infof("handle %s has errors", handleName)
 			m.Failed = true
 		}
 	}
 }
 
-// CheckDegradation checks handle performance degradation to last successful run stored in *handle_name*_last file
+// CheckDegradation compares every handle run report to baseline of the same step, handle and validation,
+// see checks.baseline and checks.thresholds, prints regression table and marks the run degraded if any metric regressed
 func (m *LoadManager) CheckDegradation() {
-	handleThreshold := viper.GetFloat64("checks.handle_threshold_percent")
-	for handleName, currentReport := range m.Reports {
-		lastReport, err := m.LastSuccessReportForHandle(handleName)
+	keys := make([]string, 0, len(m.Reports))
+	for key := range m.Reports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	m.Regressions = make([]Regression, 0)
+	for _, key := range keys {
+		currentReport := m.Reports[key]
+		if currentReport.Interrupted {
+			log.Infof("handle %s was interrupted, skipping regression check", key)
+			continue
+		}
+		if currentReport.CarriedOver {
+			log.Infof("handle %s is carried over from previous run, skipping regression check", key)
+			continue
+		}
+		baseline, err := m.BaselineReportForHandle(key)
 		if os.IsNotExist(err) {
-			log.Infof("nothing to compare for %s handle, no reports in %s", handleName, m.ReportDir)
+			log.Infof("nothing to compare for %s handle, no baseline in %s", key, m.ReportDir)
 			continue
 		}
-		if _, ok := lastReport.Metrics[handleName]; !ok {
-			log.Fatalf("no last report for handle %s found in last report", handleName)
+		if err != nil {
+			log.Fatalf("failed to load baseline for handle %s: %s", key, err)
 		}
-		if _, ok := currentReport.Metrics[handleName]; !ok {
-			log.Fatalf("no last report for handle %s found in current report", handleName)
+		handleName := currentReport.Configuration.HandleName
+		if handleName == "" {
+			handleName = key
 		}
-		currentMean := currentReport.Metrics[handleName].Latencies.P50 / time.Millisecond
-		lastMean := lastReport.Metrics[handleName].Latencies.P50 / time.Millisecond
-		log.Infof("[ %s ] current: %dms, last: %dms\n", handleName, currentMean, lastMean)
-		log.Infof("ratio: %f\n", float64(currentMean)/float64(lastMean))
-		if float64(currentMean)/float64(lastMean) >= handleThreshold {
-			log.Infof("p50 degradation of %s handle: %d > %d", handleName, currentMean, lastMean)
-			m.Degradation = true
-			continue
+		for _, r := range m.CompareReports(handleName, currentReport, baseline) {
+			r.Report = key
+			if r.Regressed {
+				log.Infof("%s degradation of %s label of %s handle: %s", r.Metric, r.Label, key, r.Change())
+				currentReport.Degraded = true
+				m.Degradation = true
+			}
+			m.Regressions = append(m.Regressions, r)
 		}
 	}
+	if len(m.Regressions) != 0 {
+		PrintRegressions(os.Stdout, m.Regressions)
+	}
 }
 
-// LastSuccessReportForHandle gets last successful report for a handle
+// LastSuccessReportForHandle gets last successful report for a handle from run index,
+// reports dirs written before run index are supported too
 func (m *LoadManager) LastSuccessReportForHandle(handleName string) (*RunReport, error) {
+	paths, err := m.indexedHandleReports(handleName, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) != 0 {
+		return readRunReport(paths[0])
+	}
 	f, err := os.Open(filepath.Join(m.ReportDir, handleName+"_last"))
 	defer f.Close()
 	if err != nil {
@@ -350,7 +501,7 @@ func CreateOrReplaceFile(fname string) *os.File {
 
 // createDirIfNotExists create dir if not exists recursively
 func createDirIfNotExists(dirPath string) {
-	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
 		log.Fatal(err)
 	}
 }
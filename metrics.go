@@ -49,14 +49,24 @@ type (
 		Success float64 `json:"success"`
 		// StatusCodes is a histogram of the responses' status codes.
 		StatusCodes map[string]int `json:"status_codes"`
-		// Errors is a set of unique Errors returned by the targets during the attack.
+		// Errors is a set of unique Errors returned by the targets during the attack, ids, addresses and numbers are masked, see NormalizeError.
 		Errors []string `json:"Errors"`
+		// ErrorCounts count of every unique error
+		ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+		// ErrorCategories failed requests by category: timeout, connection_refused, tls, http_4xx, http_5xx, canceled, application
+		ErrorCategories map[string]*ErrorCategory `json:"error_categories,omitempty"`
+		// SLO apdex and slo attainment, set if handle has slo config
+		SLO *SLOMetrics `json:"slo,omitempty"`
+		// LatencySamples is a uniform random sample of latencies used for significance tests.
+		LatencySamples []time.Duration `json:"latency_samples,omitempty"`
 
 		errors       map[string]struct{}
 		errorsCount  int64
 		successRatio float64
 		success      int64
 		latencies    *quantile.Estimator
+		slo          *SLOConfig
+		apdex        apdexCounts
 	}
 
 	// LatencyMetrics holds computed request latency Metrics.
@@ -109,6 +119,10 @@ func (m *Metrics) add(r result) {
 	m.Latencies.Total += r.elapsed
 
 	m.latencies.Add(float64(r.elapsed))
+	m.addSample(r.elapsed)
+	if m.slo != nil {
+		m.apdex.add(m.slo, r)
+	}
 
 	if m.Earliest.IsZero() || m.Earliest.After(r.begin) {
 		m.Earliest = r.begin
@@ -126,16 +140,19 @@ func (m *Metrics) add(r result) {
 		m.Latencies.Max = r.elapsed
 	}
 
+	if category := ClassifyError(r.doResult); category != "" {
+		m.addError(category, r.doResult)
+	}
 	if r.doResult.Error != nil {
-		if _, ok := m.errors[r.doResult.Error.Error()]; !ok {
-			m.errors[r.doResult.Error.Error()] = struct{}{}
-			m.Errors = append(m.Errors, r.doResult.Error.Error())
+		msg := NormalizeError(r.doResult.Error.Error())
+		if _, ok := m.errors[msg]; !ok {
+			m.errors[msg] = struct{}{}
+			m.Errors = append(m.Errors, msg)
 		}
+		m.ErrorCounts[msg]++
 		m.errorsCount++
-	} else {
-		if r.doResult.StatusCode == 0 || (r.doResult.StatusCode >= 200 && r.doResult.StatusCode < 400) {
-			m.success++
-		}
+	} else if r.doResult.checked || defaultSuccessCriteria.successStatus(r.doResult.StatusCode) {
+		m.success++
 	}
 }
 
@@ -153,11 +170,14 @@ func (m *Metrics) updateLatencies() {
 	m.Latencies.P50 = time.Duration(m.latencies.Get(0.50))
 	m.Latencies.P95 = time.Duration(m.latencies.Get(0.95))
 	m.Latencies.P99 = time.Duration(m.latencies.Get(0.99))
+	m.updateSLO()
 }
 
 func (m *Metrics) init() {
 	if m.latencies == nil {
 		m.StatusCodes = map[string]int{}
+		m.ErrorCounts = map[string]int64{}
+		m.ErrorCategories = map[string]*ErrorCategory{}
 		m.errors = map[string]struct{}{}
 		m.latencies = quantile.New(
 			quantile.Known(0.50, 0.01),
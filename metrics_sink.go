@@ -0,0 +1,366 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics sink types
+const (
+	GraphiteSinkType = "graphite"
+	StatsDSinkType   = "statsd"
+	InfluxDBSinkType = "influxdb"
+	OTLPSinkType     = "otlp"
+)
+
+var sinkTypes = []string{GraphiteSinkType, StatsDSinkType, InfluxDBSinkType, OTLPSinkType}
+
+// defaultSinkFlushInterval used if sink flush_interval_sec is not set
+const defaultSinkFlushInterval = 1 * time.Second
+
+// MetricsSink receives live metrics: every request result from runners result pipeline
+// and gauges of runners and host monitor, ex.: attackers, target_rps, cpu_used.
+// Methods are called concurrently.
+type MetricsSink interface {
+	// Result request result of a handle, result is already checked by handle success criteria
+	Result(step string, handle string, res DoResult, elapsed time.Duration)
+	// Gauge current value, tags are runner, step, label, host, iface
+	Gauge(name string, tags map[string]string, value float64)
+	// Close flushes buffered metrics
+	Close() error
+}
+
+// multiSink sends metrics to every sink, nil is a valid empty sink
+type multiSink []MetricsSink
+
+// handleFinisher is implemented by sinks keeping state of handle runs between flushes
+type handleFinisher interface {
+	// HandleFinished is called when handle run is finished
+	HandleFinished(step string, handle string)
+}
+
+// HandleFinished notifies sinks keeping state of handle runs
+func (s multiSink) HandleFinished(step string, handle string) {
+	for _, each := range s {
+		if f, ok := each.(handleFinisher); ok {
+			f.HandleFinished(step, handle)
+		}
+	}
+}
+
+func (s multiSink) Result(step string, handle string, res DoResult, elapsed time.Duration) {
+	for _, each := range s {
+		each.Result(step, handle, res, elapsed)
+	}
+}
+
+func (s multiSink) Gauge(name string, tags map[string]string, value float64) {
+	for _, each := range s {
+		each.Gauge(name, tags, value)
+	}
+}
+
+func (s multiSink) Close() error {
+	var errs []string
+	for _, each := range s {
+		if err := each.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to close metrics sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// MetricPoint aggregated measurement written by interval sinks
+type MetricPoint struct {
+	Name  string
+	Tags  map[string]string
+	Value float64
+	// Counter is set for counts of the interval, gauges are not
+	Counter bool
+	Time    time.Time
+}
+
+// pointWriter writes aggregated points of an interval to a backend
+type pointWriter interface {
+	writePoints(points []MetricPoint) error
+	close() error
+}
+
+// seriesKey identifies aggregated series by name and sorted tags
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("," + k + "=" + tags[k])
+	}
+	return b.String()
+}
+
+type labelLatencies struct {
+	tags      map[string]string
+	latencies []time.Duration
+}
+
+// sinkAggregator aggregates results and gauges of an interval into points:
+// requests and errors counters, latency mean, p50, p95, p99 and max in milliseconds, last gauge values
+type sinkAggregator struct {
+	mu        *sync.Mutex
+	counters  map[string]*MetricPoint
+	gauges    map[string]*MetricPoint
+	latencies map[string]*labelLatencies
+}
+
+func newSinkAggregator() *sinkAggregator {
+	a := &sinkAggregator{mu: &sync.Mutex{}}
+	a.reset()
+	return a
+}
+
+func (a *sinkAggregator) reset() {
+	a.counters = make(map[string]*MetricPoint)
+	a.gauges = make(map[string]*MetricPoint)
+	a.latencies = make(map[string]*labelLatencies)
+}
+
+func resultTags(step string, handle string, label string) map[string]string {
+	return map[string]string{"runner": handle, "step": step, "label": label}
+}
+
+func (a *sinkAggregator) count(name string, tags map[string]string, value float64) {
+	key := seriesKey(name, tags)
+	p, ok := a.counters[key]
+	if !ok {
+		p = &MetricPoint{Name: name, Tags: tags, Counter: true}
+		a.counters[key] = p
+	}
+	p.Value += value
+}
+
+func (a *sinkAggregator) Result(step string, handle string, res DoResult, elapsed time.Duration) {
+	tags := resultTags(step, handle, res.RequestLabel)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.count("requests", tags, 1)
+	if category := ClassifyError(res); category != "" {
+		errTags := resultTags(step, handle, res.RequestLabel)
+		errTags["category"] = category
+		a.count("errors", errTags, 1)
+	}
+	if res.BytesIn > 0 {
+		a.count("bytes_in", tags, float64(res.BytesIn))
+	}
+	if res.BytesOut > 0 {
+		a.count("bytes_out", tags, float64(res.BytesOut))
+	}
+	key := seriesKey("latency", tags)
+	l, ok := a.latencies[key]
+	if !ok {
+		l = &labelLatencies{tags: tags}
+		a.latencies[key] = l
+	}
+	l.latencies = append(l.latencies, elapsed)
+}
+
+func (a *sinkAggregator) Gauge(name string, tags map[string]string, value float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gauges[seriesKey(name, tags)] = &MetricPoint{Name: name, Tags: tags, Value: value}
+}
+
+// flush returns points of the interval and starts a new one, gauges are kept until updated
+func (a *sinkAggregator) flush(t time.Time) []MetricPoint {
+	a.mu.Lock()
+	counters, gauges, latencies := a.counters, a.gauges, a.latencies
+	a.counters = make(map[string]*MetricPoint)
+	a.latencies = make(map[string]*labelLatencies)
+	a.mu.Unlock()
+
+	points := make([]MetricPoint, 0, len(counters)+len(gauges)+5*len(latencies))
+	for _, p := range counters {
+		p.Time = t
+		points = append(points, *p)
+	}
+	for _, l := range latencies {
+		var total time.Duration
+		for _, lat := range l.latencies {
+			total += lat
+		}
+		mean := total / time.Duration(len(l.latencies))
+		p50, p95, p99, max := latencyPercentiles(l.latencies)
+		for _, v := range []struct {
+			name string
+			d    time.Duration
+		}{{"latency_mean", mean}, {"latency_p50", p50}, {"latency_p95", p95}, {"latency_p99", p99}, {"latency_max", max}} {
+			points = append(points, MetricPoint{Name: v.name, Tags: l.tags, Value: latencyMs(v.d), Time: t})
+		}
+	}
+	for _, p := range gauges {
+		cp := *p
+		cp.Time = t
+		points = append(points, cp)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return seriesKey(points[i].Name, points[i].Tags) < seriesKey(points[j].Name, points[j].Tags)
+	})
+	return points
+}
+
+// intervalSink aggregates metrics and writes them every flush interval
+type intervalSink struct {
+	*sinkAggregator
+	w         pointWriter
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+func newIntervalSink(w pointWriter, interval time.Duration) *intervalSink {
+	s := &intervalSink{
+		sinkAggregator: newSinkAggregator(),
+		w:              w,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+		closeOnce:      &sync.Once{},
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case t := <-ticker.C:
+				s.write(t)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *intervalSink) write(t time.Time) error {
+	points := s.flush(t)
+	if len(points) == 0 {
+		return nil
+	}
+	err := s.w.writePoints(points)
+	if err != nil {
+		log.Errorf("failed to write metrics: %s", err)
+	}
+	return err
+}
+
+// Close writes the last interval and closes backend connection
+func (s *intervalSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = s.write(time.Now())
+		if cerr := s.w.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+func (c MetricsSinkConfig) flushInterval() time.Duration {
+	if c.FlushIntervalSec <= 0 {
+		return defaultSinkFlushInterval
+	}
+	return time.Duration(c.FlushIntervalSec) * time.Second
+}
+
+// NewMetricsSink creates sink from config
+func NewMetricsSink(c MetricsSinkConfig) (MetricsSink, error) {
+	switch c.Type {
+	case GraphiteSinkType:
+		return NewGraphiteSink(c.URL, c.Prefix, c.flushInterval())
+	case StatsDSinkType:
+		return NewStatsDSink(c.URL, c.Prefix, c.flushInterval())
+	case InfluxDBSinkType:
+		w, err := newInfluxDBWriter(c)
+		if err != nil {
+			return nil, err
+		}
+		return newIntervalSink(w, c.flushInterval()), nil
+	case OTLPSinkType:
+		w, err := newOTLPWriter(c)
+		if err != nil {
+			return nil, err
+		}
+		return newIntervalSink(w, c.flushInterval()), nil
+	}
+	return nil, fmt.Errorf("unknown metrics sink type %q, must be one of: %s", c.Type, strings.Join(sinkTypes, ", "))
+}
+
+// sinkConfigs configured sinks, legacy graphite config is used as graphite sink
+func (c *GeneratorConfig) sinkConfigs() []MetricsSinkConfig {
+	res := make([]MetricsSinkConfig, 0, len(c.Sinks)+1)
+	if c.Graphite.URL != "" {
+		res = append(res, MetricsSinkConfig{
+			Type:             GraphiteSinkType,
+			URL:              c.Graphite.URL,
+			Prefix:           c.Graphite.LoadGeneratorPrefix,
+			FlushIntervalSec: c.Graphite.FlushIntervalSec,
+		})
+	}
+	return append(res, c.Sinks...)
+}
+
+// newMetricsSinks creates all configured sinks
+func newMetricsSinks(c *GeneratorConfig) multiSink {
+	sinks := make(multiSink, 0)
+	for _, sc := range c.sinkConfigs() {
+		s, err := NewMetricsSink(sc)
+		if err != nil {
+			log.Fatalf("failed to create %s metrics sink: %s", sc.Type, err)
+		}
+		log.Infof("sending metrics to %s at %s", sc.Type, sc.URL)
+		sinks = append(sinks, s)
+	}
+	return sinks
+}
+
+// sinkURL parses sink url, default scheme is used for host:port urls
+func sinkURL(raw string, defaultScheme string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = defaultScheme + "://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in url %q", raw)
+	}
+	return u, nil
+}
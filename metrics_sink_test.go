@@ -0,0 +1,305 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSinkResults sends two results and a gauge
+func testSinkResults(s MetricsSink) {
+	s.Result("load", "first", DoResult{RequestLabel: "get", StatusCode: 200, checked: true}, 10*time.Millisecond)
+	s.Result("load", "first", DoResult{RequestLabel: "get", Error: errAttackDoTimedOut}, 30*time.Millisecond)
+	s.Gauge("attackers", map[string]string{"runner": "first", "step": "load"}, 3)
+}
+
+func readUDP(t *testing.T, conn net.PacketConn) string {
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		lines = append(lines, string(buf[:n]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func listenUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func assertLines(t *testing.T, data string, expected ...string) {
+	for _, e := range expected {
+		if !strings.Contains(data, e) {
+			t.Errorf("no %q in:\n%s", e, data)
+		}
+	}
+}
+
+func TestSinkAggregator(t *testing.T) {
+	a := newSinkAggregator()
+	testSinkResults(&intervalSink{sinkAggregator: a})
+	now := time.Now()
+	points := a.flush(now)
+	values := make(map[string]float64)
+	for _, p := range points {
+		values[seriesKey(p.Name, p.Tags)] = p.Value
+	}
+	expected := map[string]float64{
+		"requests,label=get,runner=first,step=load":                2,
+		"errors,category=timeout,label=get,runner=first,step=load": 1,
+		"latency_mean,label=get,runner=first,step=load":            20,
+		"latency_max,label=get,runner=first,step=load":             30,
+		"attackers,runner=first,step=load":                         3,
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("%s is %v, expected %v", k, values[k], v)
+		}
+	}
+	points = a.flush(now)
+	if len(points) != 1 || points[0].Name != "attackers" {
+		t.Errorf("only gauges must be kept after flush, got %v", points)
+	}
+}
+
+func TestStatsDSink(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+	s, err := NewStatsDSink(conn.LocalAddr().String(), "lg", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSinkResults(s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertLines(t, readUDP(t, conn),
+		"lg.first.get.requests:1|c",
+		"lg.first.get.latency:10|ms",
+		"lg.first.get.errors.timeout:1|c",
+		"lg.first.attackers:3|g",
+	)
+}
+
+func TestInfluxDBUDPSink(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+	s, err := NewMetricsSink(MetricsSinkConfig{Type: InfluxDBSinkType, URL: "udp://" + conn.LocalAddr().String(), FlushIntervalSec: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSinkResults(s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertLines(t, readUDP(t, conn),
+		"loadgen_requests,label=get,runner=first,step=load value=2i ",
+		"loadgen_errors,category=timeout,label=get,runner=first,step=load value=1i ",
+		"loadgen_latency_p99,label=get,runner=first,step=load value=30 ",
+		"loadgen_attackers,runner=first,step=load value=3 ",
+	)
+}
+
+func TestInfluxDBHTTPSink(t *testing.T) {
+	setupLogger("console", "error")
+	var body, query, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body, query, auth = string(b), req.URL.Path+"?"+req.URL.RawQuery, req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	s, err := NewMetricsSink(MetricsSinkConfig{Type: InfluxDBSinkType, URL: srv.URL, Database: "load", Token: "secret", Prefix: "lg", FlushIntervalSec: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSinkResults(s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if query != "/write?db=load&precision=ns" || auth != "Token secret" {
+		t.Errorf("unexpected request: %s, auth %q", query, auth)
+	}
+	assertLines(t, body, "lg_requests,label=get,runner=first,step=load value=2i ")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	s, _ = NewMetricsSink(MetricsSinkConfig{Type: InfluxDBSinkType, URL: failing.URL, Database: "load", FlushIntervalSec: 3600})
+	testSinkResults(s)
+	if err := s.Close(); err == nil || !strings.Contains(err.Error(), "database not found") {
+		t.Errorf("write error is not returned: %v", err)
+	}
+}
+
+func TestOTLPSink(t *testing.T) {
+	var req otlpRequest
+	var path, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+	s, err := NewMetricsSink(MetricsSinkConfig{Type: OTLPSinkType, URL: srv.URL, FlushIntervalSec: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSinkResults(s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/metrics" || contentType != "application/json" {
+		t.Fatalf("unexpected request: %s %s", path, contentType)
+	}
+	metrics := make(map[string]otlpMetric)
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	requests, ok := metrics["loadgen.requests"]
+	if !ok || requests.Sum == nil || !requests.Sum.IsMonotonic || requests.Sum.DataPoints[0].AsInt != "2" {
+		t.Errorf("unexpected requests metric: %+v", requests)
+	}
+	attackers, ok := metrics["loadgen.attackers"]
+	if !ok || attackers.Gauge == nil || *attackers.Gauge.DataPoints[0].AsDouble != 3 {
+		t.Errorf("unexpected attackers metric: %+v", attackers)
+	}
+	if p99 := metrics["loadgen.latency_p99"]; p99.Unit != "ms" {
+		t.Errorf("unexpected latency unit: %+v", p99)
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		received <- strings.Join(lines, "\n")
+	}()
+	s, err := NewGraphiteSink(ln.Addr().String(), "lg", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Result("load", "first", DoResult{RequestLabel: "graphite_get", Error: errAttackDoTimedOut}, 10*time.Millisecond)
+	s.Gauge("attackers", map[string]string{"runner": "graphite_first"}, 3)
+	s.Gauge("apdex", map[string]string{"runner": "graphite_first", "label": "graphite_get"}, 0.5)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		assertLines(t, data, "lg.graphite_get-timer.count 1 ", "lg.graphite_get-err.count 1 ", "lg.graphite_get-err-timeout.count 1 ",
+			"lg.goroutines-graphite_first.value 3", "lg.graphite_get-apdex.value 0.5")
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing is sent to graphite")
+	}
+}
+
+func TestGraphiteSinkHandleFinished(t *testing.T) {
+	setupLogger("console", "error")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			ioutil.ReadAll(conn)
+			conn.Close()
+		}
+	}()
+	s, err := NewGraphiteSink(ln.Addr().String(), "lg", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Result("load", "first", DoResult{RequestLabel: "shared"}, time.Millisecond)
+	s.Result("load", "first", DoResult{RequestLabel: "first_only"}, time.Millisecond)
+	s.Result("load", "second", DoResult{RequestLabel: "shared"}, time.Millisecond)
+	s.Gauge("attackers", map[string]string{"runner": "first", "step": "load"}, 3)
+	s.Gauge("cpu_used", map[string]string{"host": "gen"}, 50)
+
+	s.HandleFinished("load", "first")
+	for name, registered := range map[string]bool{
+		"shared-timer":     true,
+		"first_only-timer": false,
+		"goroutines-first": false,
+		"cpu_used":         true,
+	} {
+		if (s.registry.Get(name) != nil) != registered {
+			t.Errorf("metric %s registered: %v, expected %v", name, !registered, registered)
+		}
+	}
+	s.HandleFinished("load", "second")
+	if s.registry.Get("shared-timer") != nil {
+		t.Error("metrics of finished handles must not be carried over to the next step")
+	}
+}
+
+func TestGraphiteGaugeName(t *testing.T) {
+	cases := []struct {
+		name     string
+		tags     map[string]string
+		expected string
+	}{
+		{"error_budget", map[string]string{"runner": "first", "label": "get"}, "get-error-budget"},
+		{"attackers", map[string]string{"runner": "first"}, "goroutines-first"},
+		{"target_rps", map[string]string{"runner": "first"}, "target_rps-first"},
+		{"net_rx", map[string]string{"host": "gen", "iface": "eth0"}, "net_eth0_rx"},
+		{"cpu_used", map[string]string{"host": "gen"}, "cpu_used"},
+	}
+	for _, c := range cases {
+		if got := graphiteGaugeName(c.name, c.tags); got != c.expected {
+			t.Errorf("%s %v is %s, expected %s", c.name, c.tags, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpDeltaTemporality aggregation temporality of counters, they are counts of the flush interval
+const otlpDeltaTemporality = 1
+
+// otlp json mapping of opentelemetry metrics protocol, int64 values are strings
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string          `json:"key"`
+	Value otlpStringValue `json:"value"`
+}
+
+type otlpStringValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt,omitempty"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+}
+
+// otlpWriter posts points as otlp/http json to <url>/v1/metrics,
+// counters are delta sums, latencies and gauges are gauges
+type otlpWriter struct {
+	prefix   string
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	interval time.Duration
+}
+
+func newOTLPWriter(c MetricsSinkConfig) (*otlpWriter, error) {
+	u, err := sinkURL(c.URL, "http")
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unknown otlp url scheme %q, must be http or https", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	w := &otlpWriter{
+		prefix:   c.Prefix,
+		url:      u.String(),
+		headers:  c.Headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: c.flushInterval(),
+	}
+	if w.prefix == "" {
+		w.prefix = "loadgen"
+	}
+	return w, nil
+}
+
+func otlpAttributes(tags map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if tags[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	res := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, otlpAttribute{Key: k, Value: otlpStringValue{tags[k]}})
+	}
+	return res
+}
+
+// otlpUnit unit of a point by its name
+func otlpUnit(name string) string {
+	switch {
+	case strings.HasPrefix(name, "latency_"):
+		return "ms"
+	case name == "requests" || name == "errors":
+		return "1"
+	}
+	return ""
+}
+
+func (w *otlpWriter) request(points []MetricPoint) otlpRequest {
+	byName := make(map[string]*otlpMetric)
+	names := make([]string, 0)
+	for _, p := range points {
+		m, ok := byName[p.Name]
+		if !ok {
+			m = &otlpMetric{Name: w.prefix + "." + p.Name, Unit: otlpUnit(p.Name)}
+			if p.Counter {
+				m.Sum = &otlpSum{AggregationTemporality: otlpDeltaTemporality, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{}
+			}
+			byName[p.Name] = m
+			names = append(names, p.Name)
+		}
+		dp := otlpDataPoint{
+			Attributes:   otlpAttributes(p.Tags),
+			TimeUnixNano: strconv.FormatInt(p.Time.UnixNano(), 10),
+		}
+		if m.Sum != nil {
+			dp.StartTimeUnixNano = strconv.FormatInt(p.Time.Add(-w.interval).UnixNano(), 10)
+			dp.AsInt = strconv.FormatInt(int64(p.Value), 10)
+			m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+		} else {
+			v := p.Value
+			dp.AsDouble = &v
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+		}
+	}
+	sm := otlpScopeMetrics{Scope: otlpScope{Name: "loadgen"}}
+	for _, name := range names {
+		sm.Metrics = append(sm.Metrics, *byName[name])
+	}
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": w.prefix})},
+		ScopeMetrics: []otlpScopeMetrics{sm},
+	}}}
+}
+
+func (w *otlpWriter) writePoints(points []MetricPoint) error {
+	body, err := json.Marshal(w.request(points))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("otlp export failed with %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+func (w *otlpWriter) close() error {
+	return nil
+}
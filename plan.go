@@ -0,0 +1,319 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+// HandlePlan expected load profile of one handle run, nothing is attacked
+type HandlePlan struct {
+	Handle string
+	// Validation is set for the max rps validation run of sequence_validate mode
+	Validation     bool
+	StartSec       int
+	WaitBeforeSec  int
+	RampUpSec      int
+	AttackSec      int
+	RampUpStrategy string
+	TargetRPS      int
+	MaxAttackers   int
+	// RPS expected rps for every second of the attack, wait before is not included
+	RPS []int
+	// Requests total expected requests
+	Requests int
+}
+
+// DurationSec wall-clock duration of a handle run
+func (p HandlePlan) DurationSec() int {
+	return p.WaitBeforeSec + p.AttackSec
+}
+
+// LatencyBudget max mean response time that still allows MaxAttackers to reach TargetRPS
+func (p HandlePlan) LatencyBudget() time.Duration {
+	return time.Duration(float64(p.MaxAttackers) / float64(p.TargetRPS) * float64(time.Second))
+}
+
+// Curve short description of the rps curve, ex.: 1..100 rps/10s, 100 rps/50s
+func (p HandlePlan) Curve() string {
+	parts := make([]string, 0)
+	if p.RampUpSec > 1 {
+		parts = append(parts, fmt.Sprintf("%d..%d rps/%ds", p.RPS[0], p.RPS[p.RampUpSec-1], p.RampUpSec))
+	} else if p.RampUpSec == 1 {
+		parts = append(parts, fmt.Sprintf("%d rps/1s", p.RPS[0]))
+	}
+	if constantSec := p.AttackSec - p.RampUpSec; constantSec > 0 {
+		parts = append(parts, fmt.Sprintf("%d rps/%ds", p.TargetRPS, constantSec))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StepPlan expected load profile of a suite step
+type StepPlan struct {
+	Name          string
+	ExecutionMode string
+	StartSec      int
+	DurationSec   int
+	Handles       []HandlePlan
+}
+
+// SuitePlan expected load profile of a suite
+type SuitePlan struct {
+	Steps       []StepPlan
+	DurationSec int
+	Requests    int
+}
+
+// NewHandlePlan computes expected rps curve the same way rampup strategies and full attack do
+func NewHandlePlan(c RunnerConfig, startSec int) HandlePlan {
+	p := HandlePlan{
+		Handle:         c.HandleName,
+		Validation:     c.IsValidationRun,
+		StartSec:       startSec,
+		WaitBeforeSec:  c.WaitBeforeSec,
+		RampUpSec:      c.RampUpTimeSec,
+		AttackSec:      c.AttackTimeSec,
+		RampUpStrategy: c.rampupStrategy(),
+		TargetRPS:      c.RPS,
+		MaxAttackers:   c.MaxAttackers,
+		RPS:            make([]int, 0, c.AttackTimeSec),
+	}
+	// see takeDuringOneRampupSecond
+	for i := 1; i <= c.RampUpTimeSec; i++ {
+		rps := i * c.RPS / c.RampUpTimeSec
+		if rps == 0 {
+			rps = 1
+		}
+		p.RPS = append(p.RPS, rps)
+	}
+	for i := c.RampUpTimeSec; i < c.AttackTimeSec; i++ {
+		p.RPS = append(p.RPS, c.RPS)
+	}
+	for _, rps := range p.RPS {
+		p.Requests += rps
+	}
+	return p
+}
+
+// validationPlanConfig mirrors Runner.SetValidationParams, max rps is unknown before the run, so target rps is used as upper bound
+func validationPlanConfig(c RunnerConfig) RunnerConfig {
+	c.IsValidationRun = true
+	c.AttackTimeSec = c.Validation.AttackTimeSec
+	c.RampUpTimeSec = 1
+	c.WaitBeforeSec = 0
+	rps := int(c.Validation.Threshold * float64(c.RPS))
+	if rps == 0 {
+		rps = 1
+	}
+	c.RPS = rps
+	return c
+}
+
+// NewSuitePlan resolves suite steps into expected load profile
+func NewSuitePlan(cfg *SuiteConfig) *SuitePlan {
+	plan := &SuitePlan{}
+	offset := 0
+	for _, step := range cfg.Steps {
+		sp := StepPlan{
+			Name:          step.Name,
+			ExecutionMode: step.ExecutionMode,
+			StartSec:      offset,
+		}
+		cursor := offset
+		for _, h := range step.Handles {
+			switch step.ExecutionMode {
+			case ParallelMode:
+				hp := NewHandlePlan(h, offset)
+				sp.Handles = append(sp.Handles, hp)
+				if end := hp.StartSec + hp.DurationSec(); end > cursor {
+					cursor = end
+				}
+			case SequenceValidateMode:
+				hp := NewHandlePlan(h, cursor)
+				cursor += hp.DurationSec()
+				vp := NewHandlePlan(validationPlanConfig(h), cursor)
+				cursor += vp.DurationSec()
+				sp.Handles = append(sp.Handles, hp, vp)
+			default:
+				hp := NewHandlePlan(h, cursor)
+				cursor += hp.DurationSec()
+				sp.Handles = append(sp.Handles, hp)
+			}
+		}
+		sp.DurationSec = cursor - offset
+		for _, hp := range sp.Handles {
+			plan.Requests += hp.Requests
+		}
+		plan.Steps = append(plan.Steps, sp)
+		offset = cursor
+	}
+	plan.DurationSec = offset
+	return plan
+}
+
+// Print writes human readable plan
+func (p *SuitePlan) Print(out io.Writer) {
+	fmt.Fprintf(out, "suite plan: %d steps, duration %s, expected requests %d\n",
+		len(p.Steps), time.Duration(p.DurationSec)*time.Second, p.Requests)
+	for _, s := range p.Steps {
+		fmt.Fprintf(out, "\nstep %q, execution mode: %s, starts at %s, duration %s\n",
+			s.Name, s.ExecutionMode, time.Duration(s.StartSec)*time.Second, time.Duration(s.DurationSec)*time.Second)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HANDLE\tSTART\tWAIT\tRAMP UP\tATTACK\tSTRATEGY\tRPS CURVE\tMAX ATTACKERS\tLATENCY BUDGET\tREQUESTS")
+		for _, h := range s.Handles {
+			name := h.Handle
+			if h.Validation {
+				name += " (validation)"
+			}
+			fmt.Fprintf(w, "%s\t%ds\t%ds\t%ds\t%ds\t%s\t%s\t%d\t%s\t%d\n",
+				name,
+				h.StartSec,
+				h.WaitBeforeSec,
+				h.RampUpSec,
+				h.AttackSec,
+				h.RampUpStrategy,
+				h.Curve(),
+				h.MaxAttackers,
+				h.LatencyBudget().Round(time.Millisecond),
+				h.Requests,
+			)
+		}
+		w.Flush()
+	}
+}
+
+// Timeline expected rps for every second of the suite, total and per handle run
+func (p *SuitePlan) Timeline() (total ChartLine, handles map[string]ChartLine) {
+	totalRPS := make([]float64, p.DurationSec+1)
+	handles = make(map[string]ChartLine)
+	for _, s := range p.Steps {
+		for _, h := range s.Handles {
+			name := fmt.Sprintf("%s/%s", s.Name, h.Handle)
+			if h.Validation {
+				name += "-validation"
+			}
+			line := handles[name]
+			attackStart := h.StartSec + h.WaitBeforeSec
+			for i, rps := range h.RPS {
+				sec := attackStart + i
+				line.XValues = append(line.XValues, float64(sec))
+				line.YValues = append(line.YValues, float64(rps))
+				totalRPS[sec] += float64(rps)
+			}
+			handles[name] = line
+		}
+	}
+	for sec, rps := range totalRPS {
+		total.XValues = append(total.XValues, float64(sec))
+		total.YValues = append(total.YValues, rps)
+	}
+	return total, handles
+}
+
+// RenderChart renders combined rps over time chart, format is selected by file extension: .png or .svg
+func (p *SuitePlan) RenderChart(fileName string) error {
+	var rp chart.RendererProvider
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".png":
+		rp = chart.PNG
+	case ".svg":
+		rp = chart.SVG
+	default:
+		return fmt.Errorf("unknown chart format: %s, use .png or .svg", fileName)
+	}
+	total, handles := p.Timeline()
+	series := []chart.Series{
+		chart.ContinuousSeries{
+			Name: "total",
+			Style: chart.Style{
+				StrokeColor: chart.GetDefaultColor(0).WithAlpha(255),
+				StrokeWidth: 3,
+			},
+			XValues: total.XValues,
+			YValues: total.YValues,
+		},
+	}
+	names := make([]string, 0, len(handles))
+	for name := range handles {
+		names = append(names, name)
+	}
+	// colors and legend order are stable between renders
+	sort.Strings(names)
+	colorIndex := 1
+	for _, name := range names {
+		line := handles[name]
+		if len(line.XValues) < 2 {
+			continue
+		}
+		series = append(series, chart.ContinuousSeries{
+			Name: name,
+			Style: chart.Style{
+				StrokeColor:     chart.GetDefaultColor(colorIndex).WithAlpha(255),
+				StrokeWidth:     1,
+				StrokeDashArray: []float64{5.0, 3.0},
+			},
+			XValues: line.XValues,
+			YValues: line.YValues,
+		})
+		colorIndex++
+	}
+	graph := chart.Chart{
+		Width:  1280,
+		Height: 640,
+		Background: chart.Style{
+			Padding: chart.Box{Top: 20, Left: 20, Right: 20, Bottom: 20},
+		},
+		XAxis: chart.XAxis{
+			Name: "Time (sec)",
+		},
+		YAxis: chart.YAxis{
+			Name: "Expected RPS",
+		},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{
+		chart.LegendLeft(&graph),
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return graph.Render(rp, file)
+}
+
+// PlanSuiteCommand prints suite plan and optionally renders rps chart
+func PlanSuiteCommand(cfgPath string, chartPath string) {
+	plan := NewSuitePlan(LoadSuiteConfig(cfgPath))
+	plan.Print(os.Stdout)
+	if chartPath == "" {
+		return
+	}
+	if err := plan.RenderChart(chartPath); err != nil {
+		log.Fatalf("failed to render plan chart: %s", err)
+	}
+	log.Infof("plan chart is written to %s", chartPath)
+}
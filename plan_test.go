@@ -0,0 +1,150 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewHandlePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        RunnerConfig
+		rps      []int
+		requests int
+		duration int
+	}{
+		{
+			name:     "linear ramp up",
+			c:        RunnerConfig{HandleName: "first", RPS: 100, RampUpTimeSec: 4, AttackTimeSec: 6},
+			rps:      []int{25, 50, 75, 100, 100, 100},
+			requests: 450,
+			duration: 6,
+		},
+		{
+			name:     "ramp up starts from 1 rps",
+			c:        RunnerConfig{HandleName: "first", RPS: 2, RampUpTimeSec: 4, AttackTimeSec: 5, WaitBeforeSec: 3},
+			rps:      []int{1, 1, 1, 2, 2},
+			requests: 7,
+			duration: 8,
+		},
+		{
+			name:     "no ramp up",
+			c:        RunnerConfig{HandleName: "first", RPS: 10, AttackTimeSec: 3},
+			rps:      []int{10, 10, 10},
+			requests: 30,
+			duration: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHandlePlan(tt.c, 7)
+			if !reflect.DeepEqual(p.RPS, tt.rps) {
+				t.Errorf("expected rps %v, got %v", tt.rps, p.RPS)
+			}
+			if p.Requests != tt.requests || p.DurationSec() != tt.duration || p.StartSec != 7 {
+				t.Errorf("unexpected plan: requests %d, duration %d, start %d", p.Requests, p.DurationSec(), p.StartSec)
+			}
+			if p.RampUpStrategy != defaultRampupStrategy {
+				t.Errorf("unexpected strategy %s", p.RampUpStrategy)
+			}
+		})
+	}
+}
+
+func testPlanSuiteConfig() *SuiteConfig {
+	return &SuiteConfig{Steps: []Step{
+		{
+			Name:          "parallel",
+			ExecutionMode: ParallelMode,
+			Handles: []RunnerConfig{
+				{HandleName: "first", RPS: 10, AttackTimeSec: 10, WaitBeforeSec: 2},
+				{HandleName: "second", RPS: 20, AttackTimeSec: 5},
+			},
+		},
+		{
+			Name:          "validate",
+			ExecutionMode: SequenceValidateMode,
+			Handles: []RunnerConfig{
+				{HandleName: "third", RPS: 10, RampUpTimeSec: 2, AttackTimeSec: 10, Validation: Validation{AttackTimeSec: 5, Threshold: 0.5}},
+			},
+		},
+	}}
+}
+
+func TestNewSuitePlan(t *testing.T) {
+	plan := NewSuitePlan(testPlanSuiteConfig())
+	tests := []struct {
+		step       int
+		handle     int
+		name       string
+		validation bool
+		start      int
+		targetRPS  int
+	}{
+		{0, 0, "first", false, 0, 10},
+		{0, 1, "second", false, 0, 20},
+		{1, 0, "third", false, 12, 10},
+		{1, 1, "third", true, 22, 5},
+	}
+	for _, tt := range tests {
+		h := plan.Steps[tt.step].Handles[tt.handle]
+		if h.Handle != tt.name || h.Validation != tt.validation || h.StartSec != tt.start || h.TargetRPS != tt.targetRPS {
+			t.Errorf("step %d handle %d: unexpected plan %+v", tt.step, tt.handle, h)
+		}
+	}
+	if plan.Steps[0].DurationSec != 12 || plan.Steps[1].StartSec != 12 || plan.Steps[1].DurationSec != 15 {
+		t.Errorf("unexpected step timings: %+v", plan.Steps)
+	}
+	// 100 + 100 + (5 + 10 + 8*10) + 5*5
+	if plan.DurationSec != 27 || plan.Requests != 320 {
+		t.Errorf("unexpected suite duration %d and requests %d", plan.DurationSec, plan.Requests)
+	}
+}
+
+func TestSuitePlanTimeline(t *testing.T) {
+	total, handles := NewSuitePlan(testPlanSuiteConfig()).Timeline()
+	if len(total.XValues) != 28 {
+		t.Fatalf("expected every second of the suite, got %d", len(total.XValues))
+	}
+	tests := []struct {
+		sec int
+		rps float64
+	}{
+		{0, 20},
+		{2, 30},
+		{5, 10},
+		{12, 5},
+		{14, 10},
+		{22, 5},
+		{27, 0},
+	}
+	for _, tt := range tests {
+		if total.YValues[tt.sec] != tt.rps {
+			t.Errorf("second %d: expected total %v rps, got %v", tt.sec, tt.rps, total.YValues[tt.sec])
+		}
+	}
+	first := handles["parallel/first"]
+	if first.XValues[0] != 2 || len(first.XValues) != 10 {
+		t.Errorf("attack must start after wait before: %v", first.XValues)
+	}
+	validation, ok := handles["validate/third-validation"]
+	if !ok || validation.XValues[0] != 22 || validation.YValues[0] != 5 {
+		t.Errorf("unexpected validation line: %+v", validation)
+	}
+}
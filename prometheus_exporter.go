@@ -0,0 +1,288 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets latency histogram buckets in seconds used if prometheus_exporter.buckets is not set
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// promSeriesKey identifies request series of a label
+type promSeriesKey struct {
+	runner, step, label string
+}
+
+// promSeries request counters and latency histogram of a label
+type promSeries struct {
+	requests uint64
+	errors   map[string]uint64
+	bytesIn  uint64
+	bytesOut uint64
+	// buckets cumulative counts of requests not slower than bucket bound
+	buckets []uint64
+	sum     float64
+}
+
+// PromExporter exposes generator metrics in prometheus text format,
+// request counters live for the whole suite, runner gauges are taken from handles of the current step on scrape
+type PromExporter struct {
+	mu      *sync.Mutex
+	m       *LoadManager
+	buckets []float64
+	series  map[promSeriesKey]*promSeries
+	// labelGauges apdex and slo gauges of labels, by name and series key
+	labelGauges map[string]map[promSeriesKey]float64
+}
+
+// NewPromExporter creates exporter of manager metrics, default buckets are used if buckets are empty
+func NewPromExporter(m *LoadManager, buckets []float64) *PromExporter {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	return &PromExporter{
+		mu:          &sync.Mutex{},
+		m:           m,
+		buckets:     b,
+		series:      make(map[promSeriesKey]*promSeries),
+		labelGauges: make(map[string]map[promSeriesKey]float64),
+	}
+}
+
+// Result counts request result of a handle
+func (e *PromExporter) Result(step string, handle string, res DoResult, elapsed time.Duration) {
+	key := promSeriesKey{handle, step, res.RequestLabel}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.series[key]
+	if !ok {
+		s = &promSeries{errors: make(map[string]uint64), buckets: make([]uint64, len(e.buckets))}
+		e.series[key] = s
+	}
+	s.requests++
+	s.bytesIn += uint64(res.BytesIn)
+	s.bytesOut += uint64(res.BytesOut)
+	if category := ClassifyError(res); category != "" {
+		s.errors[category]++
+	}
+	secs := elapsed.Seconds()
+	s.sum += secs
+	for i, bound := range e.buckets {
+		if secs <= bound {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Gauge keeps label gauges, ex.: apdex, runner and host gauges are read on scrape
+func (e *PromExporter) Gauge(name string, tags map[string]string, value float64) {
+	if tags["label"] == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	g, ok := e.labelGauges[name]
+	if !ok {
+		g = make(map[promSeriesKey]float64)
+		e.labelGauges[name] = g
+	}
+	g[promSeriesKey{tags["runner"], tags["step"], tags["label"]}] = value
+}
+
+// Close does nothing, metrics are pulled
+func (e *PromExporter) Close() error {
+	return nil
+}
+
+// promLabels renders label pairs, values are escaped
+func promLabels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Write writes all metrics in prometheus text exposition format
+func (e *PromExporter) Write(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	e.mu.Lock()
+	keys := make([]promSeriesKey, 0, len(e.series))
+	for k := range e.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.runner != b.runner {
+			return a.runner < b.runner
+		}
+		if a.step != b.step {
+			return a.step < b.step
+		}
+		return a.label < b.label
+	})
+	header("loadgen_requests_total", "counter", "Requests finished by label.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "loadgen_requests_total%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label), e.series[k].requests)
+	}
+	header("loadgen_errors_total", "counter", "Failed requests by label and error category.")
+	for _, k := range keys {
+		s := e.series[k]
+		categories := make([]string, 0, len(s.errors))
+		for c := range s.errors {
+			categories = append(categories, c)
+		}
+		sort.Strings(categories)
+		for _, c := range categories {
+			fmt.Fprintf(w, "loadgen_errors_total%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label, "category", c), s.errors[c])
+		}
+	}
+	header("loadgen_bytes_in_total", "counter", "Bytes sent with requests by label.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "loadgen_bytes_in_total%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label), e.series[k].bytesIn)
+	}
+	header("loadgen_bytes_out_total", "counter", "Bytes received with responses by label.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "loadgen_bytes_out_total%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label), e.series[k].bytesOut)
+	}
+	header("loadgen_request_duration_seconds", "histogram", "Request latency by label.")
+	for _, k := range keys {
+		s := e.series[k]
+		for i, bound := range e.buckets {
+			fmt.Fprintf(w, "loadgen_request_duration_seconds_bucket%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label, "le", promFloat(bound)), s.buckets[i])
+		}
+		lbl := promLabels("runner", k.runner, "step", k.step, "label", k.label)
+		fmt.Fprintf(w, "loadgen_request_duration_seconds_bucket%s %d\n", promLabels("runner", k.runner, "step", k.step, "label", k.label, "le", "+Inf"), s.requests)
+		fmt.Fprintf(w, "loadgen_request_duration_seconds_sum%s %s\n", lbl, promFloat(s.sum))
+		fmt.Fprintf(w, "loadgen_request_duration_seconds_count%s %d\n", lbl, s.requests)
+	}
+	names := make([]string, 0, len(e.labelGauges))
+	for name := range e.labelGauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := "loadgen_" + name
+		header(metric, "gauge", "Label "+strings.Replace(name, "_", " ", -1)+".")
+		for _, k := range keys {
+			if v, ok := e.labelGauges[name][k]; ok {
+				fmt.Fprintf(w, "%s%s %s\n", metric, promLabels("runner", k.runner, "step", k.step, "label", k.label), promFloat(v))
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	if step := e.m.CurrentStep(); step != nil {
+		type runnerState struct {
+			lbl                  string
+			attackers, targetRPS int
+			achievedRPS          int
+		}
+		states := make([]runnerState, 0, len(step.Runners))
+		for _, r := range step.Runners {
+			st := runnerState{lbl: promLabels("runner", r.name, "step", r.step)}
+			r.attackersMu.Lock()
+			st.attackers = len(r.attackers)
+			r.attackersMu.Unlock()
+			st.targetRPS = r.targetRPS()
+			if s, ok := r.lastSnapshot(); ok {
+				st.achievedRPS = s.Requests
+			}
+			states = append(states, st)
+		}
+		header("loadgen_active_attackers", "gauge", "Attackers running.")
+		for _, st := range states {
+			fmt.Fprintf(w, "loadgen_active_attackers%s %d\n", st.lbl, st.attackers)
+		}
+		header("loadgen_target_rps", "gauge", "Target requests per second.")
+		for _, st := range states {
+			fmt.Fprintf(w, "loadgen_target_rps%s %d\n", st.lbl, st.targetRPS)
+		}
+		header("loadgen_achieved_rps", "gauge", "Requests finished during the last second.")
+		for _, st := range states {
+			fmt.Fprintf(w, "loadgen_achieved_rps%s %d\n", st.lbl, st.achievedRPS)
+		}
+	}
+
+	if e.m.HostMetrics != nil {
+		if s, ok := e.m.HostMetrics.Last(); ok {
+			host := promLabels("host", e.m.GeneratorConfig.Host.Name)
+			header("loadgen_host_cpu_used_percent", "gauge", "Generator host cpu used.")
+			fmt.Fprintf(w, "loadgen_host_cpu_used_percent%s %d\n", host, s.CPUPercent)
+			header("loadgen_host_memory_used_bytes", "gauge", "Generator host memory used.")
+			fmt.Fprintf(w, "loadgen_host_memory_used_bytes%s %d\n", host, s.MemUsed)
+			header("loadgen_host_memory_total_bytes", "gauge", "Generator host memory total.")
+			fmt.Fprintf(w, "loadgen_host_memory_total_bytes%s %d\n", host, s.MemTotal)
+			header("loadgen_host_network_receive_bytes_per_second", "gauge", "Generator host network received.")
+			fmt.Fprintf(w, "loadgen_host_network_receive_bytes_per_second%s %d\n", host, s.Rx)
+			header("loadgen_host_network_transmit_bytes_per_second", "gauge", "Generator host network transmitted.")
+			fmt.Fprintf(w, "loadgen_host_network_transmit_bytes_per_second%s %d\n", host, s.Tx)
+		}
+	}
+	return w.Flush()
+}
+
+// ServeHTTP serves metrics scrape
+func (e *PromExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.Write(w); err != nil {
+		log.Errorf("failed to write prometheus metrics: %s", err)
+	}
+}
+
+// StartPrometheusExporter serves GET /metrics in prometheus text format on addr
+func (m *LoadManager) StartPrometheusExporter(addr string) {
+	m.exporter = NewPromExporter(m, m.GeneratorConfig.PrometheusExporter.Buckets)
+	m.sinks = append(m.sinks, m.exporter)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.exporter)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to start prometheus exporter on %s: %s", addr, err)
+	}
+	log.Infof("prometheus metrics are exposed on http://%s/metrics", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Errorf("prometheus exporter stopped: %s", err)
+		}
+	}()
+}
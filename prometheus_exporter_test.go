@@ -0,0 +1,70 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPromExporter(t *testing.T) {
+	m := &LoadManager{controlMu: &sync.RWMutex{}, GeneratorConfig: &GeneratorConfig{}}
+	e := NewPromExporter(m, []float64{0.1, 0.01})
+	e.Result("load", "first", DoResult{RequestLabel: "get"}, 5*time.Millisecond)
+	e.Result("load", "first", DoResult{RequestLabel: "get", StatusCode: 503}, 50*time.Millisecond)
+	e.Result("load", "first", DoResult{RequestLabel: "get", Error: errAttackDoTimedOut}, time.Second)
+	e.Result("load", "first", DoResult{RequestLabel: `a"b`, Error: errors.New("boom")}, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	expected := []string{
+		"# TYPE loadgen_requests_total counter",
+		`loadgen_requests_total{runner="first",step="load",label="get"} 3`,
+		`loadgen_errors_total{runner="first",step="load",label="get",category="http_5xx"} 1`,
+		`loadgen_errors_total{runner="first",step="load",label="get",category="timeout"} 1`,
+		`loadgen_errors_total{runner="first",step="load",label="a\"b",category="application"} 1`,
+		"# TYPE loadgen_request_duration_seconds histogram",
+		`loadgen_request_duration_seconds_bucket{runner="first",step="load",label="get",le="0.01"} 1`,
+		`loadgen_request_duration_seconds_bucket{runner="first",step="load",label="get",le="0.1"} 2`,
+		`loadgen_request_duration_seconds_bucket{runner="first",step="load",label="get",le="+Inf"} 3`,
+		`loadgen_request_duration_seconds_sum{runner="first",step="load",label="get"} 1.055`,
+		`loadgen_request_duration_seconds_count{runner="first",step="load",label="get"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("no %q in metrics:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "loadgen_active_attackers") {
+		t.Error("runner gauges are exposed when no step is running")
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST is allowed: %d", rec.Code)
+	}
+}
@@ -23,7 +23,11 @@ import (
 	"go.uber.org/ratelimit"
 )
 
-const defaultRampupStrategy = "exp2"
+const (
+	linearRampupStrategy  = "linear"
+	exp2RampupStrategy    = "exp2"
+	defaultRampupStrategy = exp2RampupStrategy
+)
 
 type rampupStrategy interface {
 	execute(r *Runner)
@@ -34,12 +38,12 @@ type linearIncreasingGoroutinesAndRequestsPerSecondStrategy struct{}
 func (s linearIncreasingGoroutinesAndRequestsPerSecondStrategy) execute(r *Runner) bool {
 	r.spawnAttacker()
 	for i := 1; i <= r.Config.RampUpTimeSec; i++ {
-		if r.stopped {
+		if r.stopped.Get() {
 			return false
 		} else {
-			spawnAttackersToSize(r, i*r.Config.MaxAttackers/r.Config.RampUpTimeSec)
+			spawnAttackersToSize(r, i*r.maxAttackers()/r.Config.RampUpTimeSec)
 			_, rampMetrics := takeDuringOneRampupSecond(r, i)
-			r.RampUpMetrics[r.name] = rampMetrics
+			r.setRampUpMetrics(rampMetrics)
 		}
 	}
 	return true
@@ -47,12 +51,12 @@ func (s linearIncreasingGoroutinesAndRequestsPerSecondStrategy) execute(r *Runne
 
 func spawnAttackersToSize(r *Runner, count int) {
 	routines := count
-	if count > r.Config.MaxAttackers {
-		routines = r.Config.MaxAttackers
+	if max := r.maxAttackers(); count > max {
+		routines = max
 	}
 	// spawn extra goroutines
-	for s := len(r.attackers); s < routines; s++ {
-		if !r.stopped {
+	for s := r.attackersCount(); s < routines; s++ {
+		if !r.stopped.Get() {
 			r.spawnAttacker()
 		}
 	}
@@ -63,17 +67,19 @@ func takeDuringOneRampupSecond(r *Runner, second int) (int, *Metrics) {
 	// collect Metrics for each second
 	rampMetrics := new(Metrics)
 	// rampup can only proceed when at least one attacker is waiting for rps tokens
-	if len(r.attackers) == 0 {
+	if r.attackersCount() == 0 {
 		log.Info("no attackers available to start rampup or full attack")
 		return 0, rampMetrics
 	}
 	// change pipeline function to collect local Metrics
-	r.resultsPipeline = func(rs result) result {
+	r.setResultsPipeline(func(rs result) result {
+		r.metricsMu.Lock()
+		defer r.metricsMu.Unlock()
 		rampMetrics.add(rs)
 		return rs
-	}
+	})
 	// for each second start a new reduced rate limiter
-	rps := second * r.Config.RPS / r.Config.RampUpTimeSec
+	rps := second * r.targetRPS() / r.Config.RampUpTimeSec
 	if rps == 0 { // minimal 1
 		rps = 1
 	}
@@ -81,23 +87,23 @@ func takeDuringOneRampupSecond(r *Runner, second int) (int, *Metrics) {
 	oneSecondAhead := time.Now().Add(1 * time.Second)
 	// put the attackers to work
 	for time.Now().Before(oneSecondAhead) {
-		limiter.Take()
+		oneSecondAhead = oneSecondAhead.Add(r.waitIfPaused())
+		scheduled := limiter.Take()
 		select {
 		case <-r.stop:
 			return rps, rampMetrics
-		default:
-			if !r.stopped {
-				r.next <- true
-			}
+		case r.next <- scheduled:
 		}
 	}
 	limiter.Take() // to compensate for the first Take of the new limiter
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
 	rampMetrics.updateLatencies()
 	rampMetrics.updateSuccessRatio()
 	r.RateLog = append(r.RateLog, rampMetrics.Rate)
 	if r.Config.Verbose {
 		r.L.Infof("rate [%4f -> %v], mean response [%v], # requests [%d], # attackers [%d], %% success [%d]",
-			rampMetrics.Rate, rps, rampMetrics.meanLogEntry(), rampMetrics.Requests, len(r.attackers), rampMetrics.successLogEntry())
+			rampMetrics.Rate, rps, rampMetrics.meanLogEntry(), rampMetrics.Requests, r.attackersCount(), rampMetrics.successLogEntry())
 	}
 	return rps, rampMetrics
 }
@@ -107,18 +113,18 @@ type spawnAsWeNeedStrategy struct{}
 func (s spawnAsWeNeedStrategy) execute(r *Runner) bool {
 	r.spawnAttacker() // start at least one
 	for i := 1; i <= r.Config.RampUpTimeSec; i++ {
-		if r.stopped {
+		if r.stopped.Get() {
 			return false
 		} else {
 			targetRate, lastMetrics := takeDuringOneRampupSecond(r, i)
-			r.RampUpMetrics[r.name] = lastMetrics
+			r.setRampUpMetrics(lastMetrics)
 			currentRate := lastMetrics.Rate
 			if currentRate < float64(targetRate) {
 				factor := float64(targetRate) / currentRate
 				if factor > 2.0 {
 					factor = 2.0
 				}
-				spawnAttackersToSize(r, int(math.Ceil(float64(len(r.attackers))*factor)))
+				spawnAttackersToSize(r, int(math.Ceil(float64(r.attackersCount())*factor)))
 			}
 		}
 	}
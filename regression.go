@@ -0,0 +1,358 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Baseline modes
+const (
+	lastSuccessBaseline = "last_success"
+	medianBaseline      = "median"
+	pinnedBaseline      = "pinned"
+)
+
+// Regression metrics
+const (
+	MetricP50        = "p50"
+	MetricP95        = "p95"
+	MetricP99        = "p99"
+	MetricErrorRate  = "error_rate"
+	MetricThroughput = "throughput"
+)
+
+var regressionMetrics = []string{MetricP50, MetricP95, MetricP99, MetricErrorRate, MetricThroughput}
+
+// Regression comparison of one metric of a label to the baseline
+type Regression struct {
+	Handle string `json:"handle"`
+	// Report key of compared handle run, see reportKey
+	Report string `json:"report,omitempty"`
+	Label  string `json:"label"`
+	Metric string `json:"metric"`
+	// Baseline and Current are ms for latencies, percents for error rate and rps for throughput
+	Baseline  float64 `json:"baseline"`
+	Current   float64 `json:"current"`
+	Threshold float64 `json:"threshold"`
+	// PValue significance test p-value, only set for latencies when test is enabled and samples are present
+	PValue *float64 `json:"p_value,omitempty"`
+	// Regressed is set when change is over threshold and, if tested, significant
+	Regressed bool `json:"regressed"`
+}
+
+// Change human readable change of the metric compared to baseline
+func (r Regression) Change() string {
+	if r.Metric == MetricErrorRate {
+		return fmt.Sprintf("%+.2fpp", r.Current-r.Baseline)
+	}
+	if r.Baseline == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (r.Current/r.Baseline-1)*100)
+}
+
+// thresholdFor merges thresholds matching handle and label, more specific ones override less specific,
+// default is p50 handle_threshold_percent for any label
+func (m *LoadManager) thresholdFor(handle string, label string) RegressionThreshold {
+	res := RegressionThreshold{Handle: handle, Label: label, P50: m.GeneratorConfig.Checks.HandleThresholdPercent}
+	matching := make([]RegressionThreshold, 0)
+	for _, t := range m.GeneratorConfig.Checks.Thresholds {
+		if (t.Handle == "" || t.Handle == handle) && (t.Label == "" || t.Label == label) {
+			matching = append(matching, t)
+		}
+	}
+	specificity := func(t RegressionThreshold) int {
+		s := 0
+		if t.Handle != "" {
+			s += 2
+		}
+		if t.Label != "" {
+			s++
+		}
+		return s
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return specificity(matching[i]) < specificity(matching[j])
+	})
+	for _, t := range matching {
+		if t.P50 != 0 {
+			res.P50 = t.P50
+		}
+		if t.P95 != 0 {
+			res.P95 = t.P95
+		}
+		if t.P99 != 0 {
+			res.P99 = t.P99
+		}
+		if t.ErrorRate != 0 {
+			res.ErrorRate = t.ErrorRate
+		}
+		if t.Throughput != 0 {
+			res.Throughput = t.Throughput
+		}
+	}
+	return res
+}
+
+// metricValue value of a regression metric, ms for latencies, percents for error rate and rps for throughput
+func metricValue(m *Metrics, metric string) float64 {
+	switch metric {
+	case MetricP50:
+		return float64(m.Latencies.P50) / float64(time.Millisecond)
+	case MetricP95:
+		return float64(m.Latencies.P95) / float64(time.Millisecond)
+	case MetricP99:
+		return float64(m.Latencies.P99) / float64(time.Millisecond)
+	case MetricErrorRate:
+		return (1 - m.Success) * 100
+	case MetricThroughput:
+		return m.Rate
+	}
+	return 0
+}
+
+func thresholdValue(t RegressionThreshold, metric string) float64 {
+	switch metric {
+	case MetricP50:
+		return t.P50
+	case MetricP95:
+		return t.P95
+	case MetricP99:
+		return t.P99
+	case MetricErrorRate:
+		return t.ErrorRate
+	case MetricThroughput:
+		return t.Throughput
+	}
+	return 0
+}
+
+// regressed checks if current value is worse than baseline over the threshold
+func regressed(metric string, baseline float64, current float64, threshold float64) bool {
+	switch metric {
+	case MetricErrorRate:
+		return current-baseline > threshold
+	case MetricThroughput:
+		return baseline > 0 && current/baseline <= threshold
+	default:
+		return baseline > 0 && current/baseline >= threshold
+	}
+}
+
+// CompareReports compares every label of handle report to baseline using configured thresholds
+func (m *LoadManager) CompareReports(handle string, current *RunReport, baseline *RunReport) []Regression {
+	labels := make([]string, 0)
+	for label := range current.Metrics {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	res := make([]Regression, 0)
+	for _, label := range labels {
+		base, ok := baseline.Metrics[label]
+		if !ok {
+			log.Infof("no baseline for label %s of handle %s", label, handle)
+			continue
+		}
+		cur := current.Metrics[label]
+		t := m.thresholdFor(handle, label)
+		for _, metric := range regressionMetrics {
+			threshold := thresholdValue(t, metric)
+			if threshold == 0 {
+				continue
+			}
+			r := Regression{
+				Handle:    handle,
+				Label:     label,
+				Metric:    metric,
+				Baseline:  metricValue(base, metric),
+				Current:   metricValue(cur, metric),
+				Threshold: threshold,
+			}
+			r.Regressed = regressed(metric, r.Baseline, r.Current, r.Threshold)
+			if p, ok := m.significance(metric, cur.LatencySamples, base.LatencySamples); ok {
+				r.PValue = &p
+				if p >= m.significanceAlpha() {
+					r.Regressed = false
+				}
+			}
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// BaselineReportForHandle selects baseline report for a handle run by report key according to checks.baseline config
+func (m *LoadManager) BaselineReportForHandle(handleName string) (*RunReport, error) {
+	cfg := m.GeneratorConfig.Checks.Baseline
+	switch cfg.Mode {
+	case medianBaseline:
+		return m.medianReportForHandle(handleName, cfg.LastN)
+	case pinnedBaseline:
+		repPath := cfg.Pinned
+		if strings.Contains(repPath, "%s") {
+			repPath = fmt.Sprintf(repPath, handleName)
+		}
+		return readRunReport(repPath)
+	default:
+		return m.LastSuccessReportForHandle(handleName)
+	}
+}
+
+// handleReports lists stored reports of a handle, newest first, indexed runs go before reports written before run index
+func (m *LoadManager) handleReports(handleName string) ([]string, error) {
+	indexed, err := m.indexedHandleReports(handleName, false)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(m.ReportDir)
+	if os.IsNotExist(err) {
+		return indexed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(handleName) + `-(\d+)\.json$`)
+	type tsFile struct {
+		ts   int64
+		path string
+	}
+	found := make([]tsFile, 0)
+	for _, f := range files {
+		match := re.FindStringSubmatch(f.Name())
+		if match == nil {
+			continue
+		}
+		ts, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		found = append(found, tsFile{ts, filepath.Join(m.ReportDir, f.Name())})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ts > found[j].ts })
+	res := indexed
+	for _, f := range found {
+		res = append(res, f.path)
+	}
+	return res, nil
+}
+
+// medianReportForHandle builds baseline report from medians of the last n successful runs
+func (m *LoadManager) medianReportForHandle(handleName string, n int) (*RunReport, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of runs must be positive for median baseline, got %d", n)
+	}
+	paths, err := m.handleReports(handleName)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*RunReport, 0, n)
+	for _, p := range paths {
+		if len(reports) == n {
+			break
+		}
+		rep, err := readRunReport(p)
+		if err != nil {
+			return nil, err
+		}
+		if !reportSucceeded(rep) {
+			continue
+		}
+		reports = append(reports, rep)
+	}
+	if len(reports) == 0 {
+		return nil, os.ErrNotExist
+	}
+	log.Infof("baseline for %s is median of %d runs", handleName, len(reports))
+	return MedianReport(reports), nil
+}
+
+// MedianReport report with median percentiles, success and rate of every label
+func MedianReport(reports []*RunReport) *RunReport {
+	values := make(map[string]map[string][]float64)
+	samples := make(map[string][]time.Duration)
+	for _, rep := range reports {
+		for label, lm := range rep.Metrics {
+			samples[label] = append(samples[label], lm.LatencySamples...)
+			if _, ok := values[label]; !ok {
+				values[label] = make(map[string][]float64)
+			}
+			for _, metric := range regressionMetrics {
+				values[label][metric] = append(values[label][metric], metricValue(lm, metric))
+			}
+		}
+	}
+	res := &RunReport{Metrics: make(map[string]*Metrics)}
+	for label, lv := range values {
+		ms := func(metric string) time.Duration {
+			return time.Duration(median(lv[metric]) * float64(time.Millisecond))
+		}
+		res.Metrics[label] = &Metrics{
+			Latencies: LatencyMetrics{
+				P50: ms(MetricP50),
+				P95: ms(MetricP95),
+				P99: ms(MetricP99),
+			},
+			Success:        1 - median(lv[MetricErrorRate])/100,
+			Rate:           median(lv[MetricThroughput]),
+			LatencySamples: samples[label],
+		}
+	}
+	return res
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// PrintRegressions writes regression table
+func PrintRegressions(out io.Writer, regressions []Regression) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HANDLE\tLABEL\tMETRIC\tBASELINE\tCURRENT\tCHANGE\tTHRESHOLD\tP-VALUE\tSTATUS")
+	for _, r := range regressions {
+		status := "ok"
+		if r.Regressed {
+			status = "REGRESSED"
+		}
+		pValue := "-"
+		if r.PValue != nil {
+			pValue = fmt.Sprintf("%.4f", *r.PValue)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%.2f\t%s\t%v\t%s\t%s\n",
+			r.Handle, r.Label, r.Metric, r.Baseline, r.Current, r.Change(), r.Threshold, pValue, status)
+	}
+	w.Flush()
+}
@@ -0,0 +1,126 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRegressionReport(p50 time.Duration, p99 time.Duration, success float64, rate float64) *RunReport {
+	return &RunReport{Metrics: map[string]*Metrics{
+		"first": {
+			Latencies: LatencyMetrics{P50: p50, P95: p50, P99: p99},
+			Success:   success,
+			Rate:      rate,
+		},
+	}}
+}
+
+func testRegressionManager(dir string) *LoadManager {
+	cfg := &GeneratorConfig{}
+	cfg.Checks.HandleThresholdPercent = 1.2
+	cfg.Checks.Thresholds = []RegressionThreshold{
+		{P99: 2, ErrorRate: 1},
+		{Handle: "first", Throughput: 0.9},
+		{Handle: "first", Label: "first", P99: 1.5},
+	}
+	return &LoadManager{GeneratorConfig: cfg, ReportDir: dir, Reports: make(map[string]*RunReport)}
+}
+
+func TestThresholdFor(t *testing.T) {
+	m := testRegressionManager("")
+	th := m.thresholdFor("first", "first")
+	if th.P50 != 1.2 || th.P99 != 1.5 || th.ErrorRate != 1 || th.Throughput != 0.9 || th.P95 != 0 {
+		t.Fatalf("unexpected merged threshold: %+v", th)
+	}
+	th = m.thresholdFor("second", "first")
+	if th.P99 != 2 || th.Throughput != 0 {
+		t.Fatalf("unexpected merged threshold: %+v", th)
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	m := testRegressionManager("")
+	base := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	tests := []struct {
+		name    string
+		current *RunReport
+		metrics []string
+	}{
+		{"no regression", testRegressionReport(110*time.Millisecond, 250*time.Millisecond, 0.995, 95), nil},
+		{"p50", testRegressionReport(130*time.Millisecond, 250*time.Millisecond, 1, 100), []string{MetricP50}},
+		{"p99 and errors", testRegressionReport(100*time.Millisecond, 300*time.Millisecond, 0.98, 100), []string{MetricP99, MetricErrorRate}},
+		{"throughput", testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 80), []string{MetricThroughput}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, r := range m.CompareReports("first", tt.current, base) {
+				if r.Regressed {
+					got = append(got, r.Metric)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.metrics) {
+				t.Fatalf("expected regressions %v, got %v", tt.metrics, got)
+			}
+		})
+	}
+}
+
+func TestMedianBaseline(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reports := []*RunReport{
+		testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100),
+		testRegressionReport(300*time.Millisecond, 400*time.Millisecond, 1, 100),
+		testRegressionReport(120*time.Millisecond, 220*time.Millisecond, 1, 100),
+		testRegressionReport(110*time.Millisecond, 210*time.Millisecond, 1, 100),
+		testRegressionReport(500*time.Millisecond, 600*time.Millisecond, 1, 100),
+	}
+	// the oldest report is out of last 2 successful runs, degraded and erroneous ones are never a baseline
+	reports[1].Degraded = true
+	reports[4].Metrics["first"].Errors = []string{"timeout"}
+	for i, rep := range reports {
+		b, _ := json.Marshal(rep)
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf(ReportFileTmpl, "first", 1000+i)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := testRegressionManager(dir)
+	m.GeneratorConfig.Checks.Baseline = BaselineConfig{Mode: medianBaseline, LastN: 2}
+	base, err := m.BaselineReportForHandle("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p50 := base.Metrics["first"].Latencies.P50; p50 != 115*time.Millisecond {
+		t.Fatalf("expected median p50 115ms, got %s", p50)
+	}
+	m.GeneratorConfig.Checks.Baseline.LastN = 0
+	if _, err := m.BaselineReportForHandle("first"); err == nil {
+		t.Fatal("median of no runs must not be a baseline")
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultReportDir reports dir used if reports.dir is not set
+	DefaultReportDir = "example_loadtest/reports"
+	// RunIndexFile index of stored runs in report dir
+	RunIndexFile = "index.json"
+	// runsDir subdir of report dir with a dir for every run
+	runsDir = "runs"
+	// HandleReportFileTmpl handle report file name in run dir, ex.: <step>-<handle>[-validation].json, see reportKey
+	HandleReportFileTmpl = "%s.json"
+)
+
+// reportDir reports.dir or default report dir
+func (c *GeneratorConfig) reportDir() string {
+	if c.Reports.Dir == "" {
+		return DefaultReportDir
+	}
+	return c.Reports.Dir
+}
+
+// RunIndex stored runs, oldest first
+type RunIndex struct {
+	Runs []RunIndexEntry `json:"runs"`
+}
+
+// RunIndexEntry stored run, paths are relative to report dir
+type RunIndexEntry struct {
+	ID         string    `json:"id"`
+	Suite      string    `json:"suite"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exitCode"`
+	Dir        string    `json:"dir"`
+	// Handles handle reports of the run by report key, see reportKey
+	Handles map[string]HandleIndexEntry `json:"handles"`
+}
+
+// HandleIndexEntry stored handle report
+type HandleIndexEntry struct {
+	Report string `json:"report"`
+	// Success report can be used as a baseline: not failed, interrupted, degraded, met slo and has no errors
+	Success bool `json:"success"`
+	// CarriedOver report of a step skipped on resume, see RunReport.CarriedOver
+	CarriedOver bool `json:"carriedOver,omitempty"`
+}
+
+// NewRunID creates sortable unique run id, ex.: 20200520-153000-1a2b3c4d
+func NewRunID(t time.Time) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return fmt.Sprintf("%s-%s", t.UTC().Format("20060102-150405"), hex.EncodeToString(b))
+}
+
+// reportKey identifies handle run in a suite: the same handle may run in several steps and max rps validation runs it again
+func reportKey(step string, handle string, validation bool) string {
+	key := handle
+	if step != "" {
+		key = step + "-" + handle
+	}
+	if validation {
+		key += "-validation"
+	}
+	return key
+}
+
+// key report key of the handle run, see reportKey
+func (r *RunReport) key() string {
+	return reportKey(r.Step, r.Configuration.HandleName, r.Configuration.IsValidationRun)
+}
+
+// reportSucceeded checks if report can be used as a baseline, carried over reports are baselines only in the run they were made
+func reportSucceeded(rep *RunReport) bool {
+	return !rep.CarriedOver && rep.RunError == "" && !rep.Failed && !rep.Interrupted && !rep.Degraded && !rep.GeneratorBound && !hasErrors(rep) && len(sloViolations(rep)) == 0
+}
+
+// RunDir dir of the current run reports
+func (m *LoadManager) RunDir() string {
+	return filepath.Join(m.ReportDir, runsDir, m.RunID)
+}
+
+func (m *LoadManager) runIndexPath() string {
+	return filepath.Join(m.ReportDir, RunIndexFile)
+}
+
+// LoadRunIndex reads index of stored runs, index is empty if no runs are stored yet
+func (m *LoadManager) LoadRunIndex() (*RunIndex, error) {
+	data, err := ioutil.ReadFile(m.runIndexPath())
+	if os.IsNotExist(err) {
+		return &RunIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx RunIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse run index %s: %s", m.runIndexPath(), err)
+	}
+	return &idx, nil
+}
+
+// indexedHandleReports stored reports of a handle run by report key from run index, newest first
+func (m *LoadManager) indexedHandleReports(handleName string, onlySuccess bool) ([]string, error) {
+	idx, err := m.LoadRunIndex()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0)
+	for i := len(idx.Runs) - 1; i >= 0; i-- {
+		h, ok := idx.Runs[i].Handles[handleName]
+		if !ok || (onlySuccess && !h.Success) {
+			continue
+		}
+		res = append(res, filepath.Join(m.ReportDir, h.Report))
+	}
+	return res, nil
+}
+
+// updateRunIndex appends current run to the index of stored runs
+func (m *LoadManager) updateRunIndex() {
+	idx, err := m.LoadRunIndex()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rel := func(path string) string {
+		r, err := filepath.Rel(m.ReportDir, path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return r
+	}
+	entry := RunIndexEntry{
+		ID:         m.RunID,
+		Suite:      m.SuiteConfigPath,
+		StartedAt:  m.StartedAt,
+		FinishedAt: m.FinishedAt,
+		Status:     m.SuiteReport().Status(),
+		ExitCode:   m.ExitCode(),
+		Dir:        rel(m.RunDir()),
+		Handles:    make(map[string]HandleIndexEntry),
+	}
+	for key, r := range m.Reports {
+		entry.Handles[key] = HandleIndexEntry{
+			Report:      rel(filepath.Join(m.RunDir(), fmt.Sprintf(HandleReportFileTmpl, key))),
+			Success:     reportSucceeded(r),
+			CarriedOver: r.CarriedOver,
+		}
+	}
+	idx.Runs = append(idx.Runs, entry)
+	b, err := json.MarshalIndent(idx, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeFileAtomic(m.runIndexPath(), b); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("run %s is added to index %s", m.RunID, m.runIndexPath())
+}
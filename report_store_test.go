@@ -0,0 +1,178 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReportStore(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testRegressionManager(dir)
+	storeRun := func(rep *RunReport) string {
+		m.RunID = NewRunID(time.Now())
+		m.Reports = map[string]*RunReport{"first": rep}
+		m.StoreHandleReports()
+		m.updateRunIndex()
+		return m.RunID
+	}
+	successID := storeRun(testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100))
+	degraded := testRegressionReport(300*time.Millisecond, 400*time.Millisecond, 1, 100)
+	degraded.Degraded = true
+	degradedID := storeRun(degraded)
+	if successID == degradedID {
+		t.Fatal("run ids are not unique")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, runsDir, degradedID, "first.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("unexpected report permissions: %s", info.Mode().Perm())
+	}
+	idx, err := m.LoadRunIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Runs) != 2 || idx.Runs[1].ID != degradedID || idx.Runs[1].Handles["first"].Success {
+		t.Fatalf("unexpected index: %+v", idx)
+	}
+	baseline, err := m.LastSuccessReportForHandle("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline.Metrics["first"].Latencies.P50 != 100*time.Millisecond {
+		t.Fatalf("degraded run is used as a baseline: %+v", baseline.Metrics["first"].Latencies)
+	}
+	paths, err := m.handleReports("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Base(filepath.Dir(paths[0])) != degradedID {
+		t.Fatalf("unexpected handle reports order: %v", paths)
+	}
+}
+
+func TestReportStoreKeysRepeatedHandle(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testRegressionManager(dir)
+	report := func(step string, validation bool, p50 time.Duration) *RunReport {
+		rep := testRegressionReport(p50, 2*p50, 1, 100)
+		rep.Step = step
+		rep.Configuration.HandleName = "first"
+		rep.Configuration.IsValidationRun = validation
+		return rep
+	}
+	m.RunID = NewRunID(time.Now())
+	m.Reports = make(map[string]*RunReport)
+	for _, rep := range []*RunReport{
+		report("warmup", false, 10*time.Millisecond),
+		report("load", false, 100*time.Millisecond),
+		report("load", true, 200*time.Millisecond),
+	} {
+		m.Reports[rep.key()] = rep
+	}
+	m.StoreHandleReports()
+	m.updateRunIndex()
+
+	tests := []struct {
+		key string
+		p50 time.Duration
+	}{
+		{"warmup-first", 10 * time.Millisecond},
+		{"load-first", 100 * time.Millisecond},
+		{"load-first-validation", 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if _, err := os.Stat(filepath.Join(dir, runsDir, m.RunID, tt.key+".json")); err != nil {
+			t.Fatal(err)
+		}
+		baseline, err := m.BaselineReportForHandle(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if baseline.Metrics["first"].Latencies.P50 != tt.p50 {
+			t.Errorf("%s: baseline of another run is used: %+v", tt.key, baseline.Metrics["first"].Latencies)
+		}
+	}
+}
+
+// reportRequests requests of all labels of the report
+func reportRequests(rep *RunReport) uint64 {
+	var n uint64
+	for _, m := range rep.Metrics {
+		n += m.Requests
+	}
+	return n
+}
+
+func TestValidationRunReportIsSeparate(t *testing.T) {
+	setupLogger("console", "error")
+	m := &LoadManager{
+		GeneratorConfig: &GeneratorConfig{},
+		CsvMu:           &sync.Mutex{},
+		Reports:         make(map[string]*RunReport),
+		RPSScalingLog:   csv.NewWriter(ioutil.Discard),
+		controlMu:       &sync.RWMutex{},
+		stopping:        &AtomicBool{},
+		skipStep:        &AtomicBool{},
+	}
+	r := NewRunner("first", m, &attackMock{sleep: time.Millisecond}, nil, RunnerConfig{
+		HandleName:     "first",
+		RPS:            20,
+		AttackTimeSec:  2,
+		RampUpTimeSec:  1,
+		RampUpStrategy: linearRampupStrategy,
+		MaxAttackers:   4,
+		DoTimeoutSec:   1,
+		Validation:     Validation{AttackTimeSec: 2, Threshold: 0.5},
+	})
+	r.step = "load"
+	m.Steps = []RunStep{{Name: "load", ExecutionMode: SequenceValidateMode, Runners: []*Runner{r}}}
+	m.setCurrentStep(0)
+	r.Run(nil, m)
+	main := m.Reports[reportKey("load", "first", false)]
+	mainRequests := reportRequests(main)
+	if err := r.SetValidationParams(); err != nil {
+		t.Fatal(err)
+	}
+	r.Run(nil, m)
+	validation := m.Reports[reportKey("load", "first", true)]
+	if reportRequests(main) != mainRequests {
+		t.Fatalf("validation run is added to main report: %d -> %d requests", mainRequests, reportRequests(main))
+	}
+	if reportRequests(validation) == 0 || reportRequests(validation) == mainRequests {
+		t.Fatalf("validation report must have its own requests: main %d, validation %d", mainRequests, reportRequests(validation))
+	}
+}
@@ -25,6 +25,8 @@ import (
 )
 
 type result struct {
+	// scheduled time when rate limiter released the request, begin is later if there were no free attackers
+	scheduled  time.Time
 	begin, end time.Time
 	elapsed    time.Duration
 	doResult   DoResult
@@ -42,10 +44,14 @@ type DoResult struct {
 	BytesIn int64
 	// Number of bytes transferred when receiving the response.
 	BytesOut int64
+	// checked is set when handle success criteria are applied
+	checked bool
 }
 
 // RunReport is a composition of configuration, measurements and custom output from a loadtest Run.
 type RunReport struct {
+	// Step suite step name
+	Step          string       `json:"step,omitempty"`
 	StartedAt     time.Time    `json:"startedAt"`
 	FinishedAt    time.Time    `json:"finishedAt"`
 	Configuration RunnerConfig `json:"configuration"`
@@ -54,6 +60,18 @@ type RunReport struct {
 	Metrics  map[string]*Metrics `json:"Metrics"`
 	// Failed can be set by your loadtest test program to indicate that the results are not acceptable.
 	Failed bool `json:"failed"`
+	// Degraded is set when any metric regressed compared to baseline
+	Degraded bool `json:"degraded"`
+	// Interrupted is set when run is stopped before attack time ends, by signal or control api, results are partial
+	Interrupted bool `json:"interrupted"`
+	// CarriedOver is set for reports of steps skipped on resume, results are of the previous run
+	CarriedOver bool `json:"carriedOver,omitempty"`
+	// GeneratorBound is set when generator was saturated and saturation.mark_report is set, results show generator limits, not target capacity
+	GeneratorBound bool `json:"generatorBound,omitempty"`
+	// Saturation moments when generator was the bottleneck
+	Saturation []SaturationEvent `json:"saturation,omitempty"`
+	// Series per second results of the run
+	Series []Snapshot `json:"series,omitempty"`
 	// Output is used to publish any custom output in the report.
 	Output map[string]interface{} `json:"output"`
 }
@@ -0,0 +1,358 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ResultLogFile per request results log file name in run dir
+const ResultLogFile = "results.jsonl"
+
+// ResultRecord one request result in results log, times are unix nanoseconds
+type ResultRecord struct {
+	Step   string `json:"step,omitempty"`
+	Handle string `json:"handle"`
+	// Validation is set for results of max rps validation run
+	Validation bool   `json:"validation,omitempty"`
+	Label      string `json:"label"`
+	Scheduled  int64  `json:"scheduled"`
+	Begin      int64  `json:"begin"`
+	End        int64  `json:"end"`
+	Latency    int64  `json:"latency"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	BytesIn    int64  `json:"bytes_in,omitempty"`
+	BytesOut   int64  `json:"bytes_out,omitempty"`
+}
+
+func newResultRecord(step string, handle string, validation bool, res result) ResultRecord {
+	rec := ResultRecord{
+		Step:       step,
+		Handle:     handle,
+		Validation: validation,
+		Label:      res.doResult.RequestLabel,
+		Begin:      res.begin.UnixNano(),
+		End:        res.end.UnixNano(),
+		Latency:    int64(res.elapsed),
+		Status:     res.doResult.StatusCode,
+		BytesIn:    res.doResult.BytesIn,
+		BytesOut:   res.doResult.BytesOut,
+	}
+	if !res.scheduled.IsZero() {
+		rec.Scheduled = res.scheduled.UnixNano()
+	}
+	if res.doResult.Error != nil {
+		rec.Error = res.doResult.Error.Error()
+	}
+	return rec
+}
+
+// result converts record back to result so it can be aggregated the same way as in the run
+func (rec ResultRecord) result() result {
+	res := result{
+		begin:   time.Unix(0, rec.Begin),
+		end:     time.Unix(0, rec.End),
+		elapsed: time.Duration(rec.Latency),
+		doResult: DoResult{
+			RequestLabel: rec.Label,
+			StatusCode:   rec.Status,
+			BytesIn:      rec.BytesIn,
+			BytesOut:     rec.BytesOut,
+			// success criteria were applied before result was logged
+			checked: true,
+		},
+	}
+	if rec.Scheduled != 0 {
+		res.scheduled = time.Unix(0, rec.Scheduled)
+	}
+	if rec.Error != "" {
+		res.doResult.Error = errors.New(rec.Error)
+	}
+	return res
+}
+
+// ResultLog writes every request result as json line
+type ResultLog struct {
+	mu  *sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+	// closed is set on Close
+	closed bool
+}
+
+// NewResultLog creates results log file
+func NewResultLog(path string) (*ResultLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(f, 1<<16)
+	return &ResultLog{mu: &sync.Mutex{}, f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Write appends result of a handle request, results of requests finished after log is closed are dropped
+func (l *ResultLog) Write(step string, handle string, validation bool, res result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	if err := l.enc.Encode(newResultRecord(step, handle, validation, res)); err != nil {
+		log.Errorf("failed to write result log: %s", err)
+	}
+}
+
+// Close flushes and closes results log
+func (l *ResultLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	return l.f.Close()
+}
+
+// openResultLog starts results log in run dir if reports.results_log is set
+func (m *LoadManager) openResultLog() {
+	if !m.GeneratorConfig.Reports.ResultsLog {
+		return
+	}
+	createDirIfNotExists(m.RunDir())
+	path := filepath.Join(m.RunDir(), ResultLogFile)
+	rl, err := NewResultLog(path)
+	if err != nil {
+		log.Fatalf("failed to create result log: %s", err)
+	}
+	log.Infof("writing every request result to %s", path)
+	m.resultLog = rl
+}
+
+// ResultLogFilter selects results to aggregate, zero values match everything
+type ResultLogFilter struct {
+	// From and To time window relative to the first result of every step, handle and validation run,
+	// so warm up of every handle run is skipped
+	From, To time.Duration
+	// Since and Until absolute time window
+	Since, Until time.Time
+	Labels       []string
+	Handles      []string
+	Steps        []string
+}
+
+func contains(values []string, v string) bool {
+	for _, each := range values {
+		if each == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ResultLogFilter) match(rec ResultRecord, start time.Time) bool {
+	if len(f.Labels) != 0 && !contains(f.Labels, rec.Label) {
+		return false
+	}
+	if len(f.Handles) != 0 && !contains(f.Handles, rec.Handle) {
+		return false
+	}
+	if len(f.Steps) != 0 && !contains(f.Steps, rec.Step) {
+		return false
+	}
+	begin := time.Unix(0, rec.Begin)
+	if !f.Since.IsZero() && begin.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !begin.Before(f.Until) {
+		return false
+	}
+	offset := begin.Sub(start)
+	if f.From != 0 && offset < f.From {
+		return false
+	}
+	if f.To != 0 && offset >= f.To {
+		return false
+	}
+	return true
+}
+
+// ReadResultLog recomputes metrics and per second series of every handle run from results log,
+// reports are keyed by step, handle and validation run, see reportKey
+func ReadResultLog(in io.Reader, filter ResultLogFilter) (map[string]*RunReport, error) {
+	records := make([]ResultRecord, 0)
+	dec := json.NewDecoder(bufio.NewReader(in))
+	for {
+		var rec ResultRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read result log record %d: %s", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) == 0 {
+		return map[string]*RunReport{}, nil
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Begin < records[j].Begin })
+	// records are ordered, first record of the run is its start
+	starts := make(map[string]time.Time)
+	for _, rec := range records {
+		key := reportKey(rec.Step, rec.Handle, rec.Validation)
+		if _, ok := starts[key]; !ok {
+			starts[key] = time.Unix(0, rec.Begin)
+		}
+	}
+
+	reports := make(map[string]*RunReport)
+	buckets := make(map[string]*snapshotBucket)
+	seconds := make(map[string]time.Time)
+	flush := func(key string, rep *RunReport, sec time.Time) {
+		s := Snapshot{Time: sec, Step: rep.Step, Handle: rep.Configuration.HandleName}
+		buckets[key].flush(&s)
+		rep.Series = append(rep.Series, s)
+	}
+	for _, rec := range records {
+		key := reportKey(rec.Step, rec.Handle, rec.Validation)
+		if !filter.match(rec, starts[key]) {
+			continue
+		}
+		res := rec.result()
+		rep, ok := reports[key]
+		if !ok {
+			rep = &RunReport{
+				Step:          rec.Step,
+				StartedAt:     res.begin,
+				Configuration: RunnerConfig{HandleName: rec.Handle, IsValidationRun: rec.Validation},
+				Metrics:       make(map[string]*Metrics),
+				Output:        map[string]interface{}{},
+			}
+			reports[key] = rep
+			buckets[key] = newSnapshotBucket()
+			seconds[key] = res.begin.Truncate(time.Second)
+		}
+		m, ok := rep.Metrics[rec.Label]
+		if !ok {
+			m = new(Metrics)
+			rep.Metrics[rec.Label] = m
+		}
+		m.add(res)
+		if res.end.After(rep.FinishedAt) {
+			rep.FinishedAt = res.end
+		}
+		// results are ordered by begin, only seconds with results are in series, gaps are not padded
+		sec := res.begin.Truncate(time.Second)
+		if seconds[key].Before(sec) {
+			flush(key, rep, seconds[key])
+			seconds[key] = sec
+		}
+		buckets[key].add(res)
+	}
+	for key, rep := range reports {
+		flush(key, rep, seconds[key])
+		for _, m := range rep.Metrics {
+			m.updateLatencies()
+			m.updateSuccessRatio()
+		}
+	}
+	return reports, nil
+}
+
+// ReportCommand recomputes reports from results log and prints them as text or json,
+// window is relative to the first result or absolute RFC3339 time, errors are normalized with errors.normalize rules
+func ReportCommand(path string, from string, to string, filter ResultLogFilter, format string, cfg *GeneratorConfig) {
+	if err := SetErrorNormalizationRules(cfg.Errors.Normalize); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	if filter.From, filter.Since, err = parseWindowBound(from); err != nil {
+		log.Fatalf("invalid --from: %s", err)
+	}
+	if filter.To, filter.Until, err = parseWindowBound(to); err != nil {
+		log.Fatalf("invalid --to: %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	reports, err := ReadResultLog(f, filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+	case "text", "":
+		WriteResultLogReport(os.Stdout, reports)
+	default:
+		log.Fatalf("unknown format: %s, use text or json", format)
+	}
+}
+
+func parseWindowBound(v string) (time.Duration, time.Time, error) {
+	if v == "" {
+		return 0, time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d, time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("%q is neither duration nor RFC3339 time", v)
+	}
+	return 0, t, nil
+}
+
+// WriteResultLogReport prints recomputed metrics of every handle run and label
+func WriteResultLogReport(out io.Writer, reports map[string]*RunReport) {
+	keys := make([]string, 0, len(reports))
+	for key := range reports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tHANDLE\tLABEL\tREQUESTS\tRATE\tSUCCESS\tP50 MS\tP95 MS\tP99 MS\tMAX MS\tERRORS\tSECONDS")
+	for _, key := range keys {
+		rep := reports[key]
+		for _, label := range sortedLabels(rep) {
+			m := rep.Metrics[label]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.2f\t%.2f%%\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t%d\n",
+				rep.Step, reportName(rep), label, m.Requests, m.Rate, m.Success*100,
+				latencyMs(m.Latencies.P50), latencyMs(m.Latencies.P95), latencyMs(m.Latencies.P99), latencyMs(m.Latencies.Max),
+				len(m.Errors), len(rep.Series))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,153 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResultLog(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ResultLogFile)
+	rl, err := NewResultLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1590000000, 0)
+	// warm up second is slow, then 3 seconds of fast requests, one of them fails
+	for sec := 0; sec < 4; sec++ {
+		for i := 0; i < 10; i++ {
+			latency := 10 * time.Millisecond
+			if sec == 0 {
+				latency = time.Second
+			}
+			begin := start.Add(time.Duration(sec)*time.Second + time.Duration(i)*50*time.Millisecond)
+			res := result{
+				scheduled: begin,
+				begin:     begin,
+				end:       begin.Add(latency),
+				elapsed:   latency,
+				doResult:  DoResult{RequestLabel: "get", StatusCode: 200},
+			}
+			if sec == 3 && i == 0 {
+				res.doResult = DoResult{RequestLabel: "get", StatusCode: 500, Error: errors.New("internal error")}
+			}
+			rl.Write("steady", "first", false, res)
+		}
+		rl.Write("steady", "second", false, result{begin: start, end: start, doResult: DoResult{RequestLabel: "post"}})
+	}
+	// validation run of the same handle after a pause, seconds without results are not padded
+	for _, sec := range []int{10, 12} {
+		begin := start.Add(time.Duration(sec) * time.Second)
+		rl.Write("steady", "first", true, result{begin: begin, end: begin, doResult: DoResult{RequestLabel: "get", StatusCode: 200}})
+	}
+	if err := rl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rl.Write("steady", "first", false, result{begin: start})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reports, err := ReadResultLog(f, ResultLogFilter{From: time.Second, Labels: []string{"get"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected first handle run and its validation, got %d reports", len(reports))
+	}
+	m := reports["steady-first"].Metrics["get"]
+	if m.Requests != 30 || m.Latencies.Max != 10*time.Millisecond {
+		t.Fatalf("warm up is not excluded: requests %d, max %s", m.Requests, m.Latencies.Max)
+	}
+	if len(m.Errors) != 1 || m.StatusCodes["500"] != 1 {
+		t.Fatalf("unexpected errors: %v, %v", m.Errors, m.StatusCodes)
+	}
+	series := reports["steady-first"].Series
+	if len(series) != 3 || series[0].Requests != 10 || series[2].Errors != 1 {
+		t.Fatalf("unexpected series: %+v", series)
+	}
+	// first second of validation run is skipped too
+	validation := reports["steady-first-validation"]
+	if !validation.Configuration.IsValidationRun || validation.Metrics["get"].Requests != 1 || len(validation.Series) != 1 {
+		t.Fatalf("unexpected validation report: %+v", validation)
+	}
+}
+
+func TestResultLogFromEveryRun(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ResultLogFile)
+	rl, err := NewResultLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1590000000, 0)
+	// sequential handles, second one starts when the first is finished, both have slow warm up second
+	for i, handle := range []string{"first", "second"} {
+		handleStart := start.Add(time.Duration(i) * 5 * time.Second)
+		for sec := 0; sec < 3; sec++ {
+			latency := 10 * time.Millisecond
+			if sec == 0 {
+				latency = time.Second
+			}
+			for j := 0; j < 10; j++ {
+				begin := handleStart.Add(time.Duration(sec)*time.Second + time.Duration(j)*50*time.Millisecond)
+				rl.Write("steady", handle, false, result{
+					begin:    begin,
+					end:      begin.Add(latency),
+					elapsed:  latency,
+					doResult: DoResult{RequestLabel: "get", StatusCode: 200},
+				})
+			}
+		}
+	}
+	if err := rl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reports, err := ReadResultLog(f, ResultLogFilter{From: time.Second, To: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"steady-first", "steady-second"} {
+		m := reports[key].Metrics["get"]
+		if m.Requests != 10 || m.Latencies.Max != 10*time.Millisecond {
+			t.Fatalf("%s: window must be relative to the handle run: requests %d, max %s", key, m.Requests, m.Latencies.Max)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultPushJob pushgateway job used if results_push.job is not set
+const defaultPushJob = "loadgen"
+
+// resultSample final value of a suite, handle or label result
+type resultSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// promLabelName makes valid prometheus label name
+func promLabelName(v string) string {
+	v = invalidLabelChars.ReplaceAllString(v, "_")
+	if v == "" || (v[0] >= '0' && v[0] <= '9') {
+		v = "_" + v
+	}
+	return v
+}
+
+// suiteName suite name from config path, ex.: load/run_configs/first_test.yaml is first_test
+func suiteName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// gitSHA commit of tested code from ci env or git
+func gitSHA() string {
+	for _, env := range []string{"GIT_SHA", "GITHUB_SHA", "CI_COMMIT_SHA"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func copyLabels(labels map[string]string, extra ...string) map[string]string {
+	res := make(map[string]string, len(labels)+len(extra)/2)
+	for k, v := range labels {
+		res[k] = v
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		res[extra[i]] = extra[i+1]
+	}
+	return res
+}
+
+// resultSamples final results of suite, every handle run and label, common labels are added to every sample
+func (r *SuiteReport) resultSamples(common map[string]string, exitCode int) []resultSample {
+	samples := make([]resultSample, 0)
+	add := func(name string, labels map[string]string, value float64) {
+		samples = append(samples, resultSample{name: name, labels: labels, value: value})
+	}
+	add("loadgen_suite_passed", common, boolValue(exitCode == ExitOK))
+	add("loadgen_suite_exit_code", common, float64(exitCode))
+	add("loadgen_suite_degraded", common, boolValue(r.Degraded))
+	add("loadgen_suite_generator_bound", common, boolValue(r.GeneratorBound()))
+	add("loadgen_suite_duration_seconds", common, r.FinishedAt.Sub(r.StartedAt).Seconds())
+	for _, step := range r.Steps {
+		for _, rep := range step.Reports {
+			handle := copyLabels(common, "step", step.Name, "handle", rep.Configuration.HandleName)
+			if rep.Configuration.IsValidationRun {
+				handle["validation"] = "true"
+			}
+			for k, v := range rep.Configuration.Metadata {
+				handle["meta_"+promLabelName(k)] = v
+			}
+			passed := rep.RunError == "" && !rep.Interrupted && len(r.reportFailures(rep)) == 0
+			add("loadgen_run_passed", handle, boolValue(passed))
+			add("loadgen_run_degraded", handle, boolValue(rep.Degraded))
+			add("loadgen_run_interrupted", handle, boolValue(rep.Interrupted))
+			add("loadgen_run_generator_bound", handle, boolValue(rep.GeneratorBound))
+			add("loadgen_run_duration_seconds", handle, rep.FinishedAt.Sub(rep.StartedAt).Seconds())
+			for _, label := range sortedLabels(rep) {
+				m := rep.Metrics[label]
+				lbl := copyLabels(handle, "label", label)
+				add("loadgen_run_requests", lbl, float64(m.Requests))
+				add("loadgen_run_rate", lbl, m.Rate)
+				errorRatio := 0.0
+				if m.Requests > 0 {
+					errorRatio = 1 - m.Success
+				}
+				add("loadgen_run_error_ratio", lbl, errorRatio)
+				add("loadgen_run_latency_mean_seconds", lbl, m.Latencies.Mean.Seconds())
+				add("loadgen_run_latency_max_seconds", lbl, m.Latencies.Max.Seconds())
+				for _, q := range []struct {
+					quantile string
+					d        time.Duration
+				}{{"0.5", m.Latencies.P50}, {"0.95", m.Latencies.P95}, {"0.99", m.Latencies.P99}} {
+					add("loadgen_run_latency_seconds", copyLabels(lbl, "quantile", q.quantile), q.d.Seconds())
+				}
+				if m.SLO != nil {
+					add("loadgen_run_apdex", lbl, m.SLO.Apdex)
+					add("loadgen_run_slo_attainment", lbl, m.SLO.Attainment)
+				}
+			}
+		}
+	}
+	return samples
+}
+
+// writePushText writes samples in prometheus text format, grouping labels are omitted, they are in push url
+func writePushText(samples []resultSample, grouping map[string]string) []byte {
+	// text format requires samples of a metric to be written together
+	order := make(map[string]int)
+	for _, s := range samples {
+		if _, ok := order[s.name]; !ok {
+			order[s.name] = len(order)
+		}
+	}
+	samples = append([]resultSample(nil), samples...)
+	sort.SliceStable(samples, func(i, j int) bool { return order[samples[i].name] < order[samples[j].name] })
+	var b bytes.Buffer
+	for i, s := range samples {
+		if i == 0 || samples[i-1].name != s.name {
+			fmt.Fprintf(&b, "# TYPE %s gauge\n", s.name)
+		}
+		keys := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			if _, ok := grouping[k]; !ok && s.labels[k] != "" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, 2*len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, k, s.labels[k])
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", s.name, promLabels(pairs...), promFloat(s.value))
+	}
+	return b.Bytes()
+}
+
+// pushgatewayURL group url, values are base64 encoded as pushgateway requires for values with slashes
+func pushgatewayURL(base string, job string, grouping map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(base, "/"))
+	b.WriteString("/metrics/job@base64/" + base64.RawURLEncoding.EncodeToString([]byte(job)))
+	keys := make([]string, 0, len(grouping))
+	for k := range grouping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString("/" + k + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(grouping[k])))
+	}
+	return b.String()
+}
+
+// protobuf encoding of prometheus remote write request
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendVarint(b, uint64(field<<3|2))
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// encodeWriteRequest encodes prompb.WriteRequest, every sample is a series with one point at ts
+func encodeWriteRequest(samples []resultSample, ts time.Time) []byte {
+	var req []byte
+	for _, s := range samples {
+		labels := copyLabels(s.labels, "__name__", s.name)
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			if labels[k] != "" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var series []byte
+		for _, k := range keys {
+			var label []byte
+			label = appendBytesField(label, 1, []byte(k))
+			label = appendBytesField(label, 2, []byte(labels[k]))
+			series = appendBytesField(series, 1, label)
+		}
+		var sample []byte
+		sample = appendVarint(sample, 1<<3|1)
+		var v [8]byte
+		binary.LittleEndian.PutUint64(v[:], math.Float64bits(s.value))
+		sample = append(sample, v[:]...)
+		sample = appendVarint(sample, 2<<3|0)
+		sample = appendVarint(sample, uint64(ts.UnixNano()/int64(time.Millisecond)))
+		series = appendBytesField(series, 2, sample)
+		req = appendBytesField(req, 1, series)
+	}
+	return req
+}
+
+// snappyEncode encodes data as snappy block of literals, it's valid snappy without compression,
+// results are small, so compression is not worth a dependency
+func snappyEncode(data []byte) []byte {
+	b := appendVarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 65536 {
+			n = 65536
+		}
+		switch {
+		case n <= 60:
+			b = append(b, byte(n-1)<<2)
+		case n <= 256:
+			b = append(b, 60<<2, byte(n-1))
+		default:
+			b = append(b, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+func pushRequest(method string, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed with %s: %s", method, url, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// PushResults pushes final results of every handle to pushgateway and prometheus remote write if configured,
+// labelled with suite, step, handle, label, git sha, run id, handle metadata and results_push.labels
+func (m *LoadManager) PushResults() {
+	c := m.GeneratorConfig.ResultsPush
+	if c.Pushgateway == "" && c.RemoteWrite == "" {
+		return
+	}
+	rep := m.SuiteReport()
+	suite := suiteName(rep.Suite)
+	common := copyLabels(nil, "suite", suite, "run_id", m.RunID, "git_sha", gitSHA())
+	for k, v := range c.Labels {
+		common[promLabelName(k)] = v
+	}
+	samples := rep.resultSamples(common, m.ExitCode())
+	job := c.Job
+	if job == "" {
+		job = defaultPushJob
+	}
+	if c.Pushgateway != "" {
+		grouping := map[string]string{"suite": suite}
+		url := pushgatewayURL(c.Pushgateway, job, grouping)
+		headers := copyLabels(c.Headers, "Content-Type", "text/plain; version=0.0.4")
+		if err := pushRequest(http.MethodPut, url, writePushText(samples, grouping), headers); err != nil {
+			log.Errorf("failed to push results to pushgateway: %s", err)
+		} else {
+			log.Infof("results are pushed to %s", url)
+		}
+	}
+	if c.RemoteWrite != "" {
+		for i := range samples {
+			samples[i].labels = copyLabels(samples[i].labels, "job", job)
+		}
+		headers := copyLabels(c.Headers,
+			"Content-Type", "application/x-protobuf",
+			"Content-Encoding", "snappy",
+			"X-Prometheus-Remote-Write-Version", "0.1.0",
+		)
+		body := snappyEncode(encodeWriteRequest(samples, rep.FinishedAt))
+		if err := pushRequest(http.MethodPost, c.RemoteWrite, body, headers); err != nil {
+			log.Errorf("failed to write results to prometheus: %s", err)
+		} else {
+			log.Infof("results are written to %s", c.RemoteWrite)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snappyDecodeLiterals decodes snappy block produced by snappyEncode
+func snappyDecodeLiterals(t *testing.T, b []byte) []byte {
+	n, i := uint64(0), 0
+	for shift := uint(0); ; shift += 7 {
+		n |= uint64(b[i]&0x7f) << shift
+		i++
+		if b[i-1] < 0x80 {
+			break
+		}
+	}
+	var out []byte
+	for i < len(b) {
+		tag := b[i] >> 2
+		i++
+		l := int(tag) + 1
+		switch tag {
+		case 60:
+			l = int(b[i]) + 1
+			i++
+		case 61:
+			l = int(b[i]) | int(b[i+1])<<8 + 1
+			i += 2
+		}
+		out = append(out, b[i:i+l]...)
+		i += l
+	}
+	if uint64(len(out)) != n {
+		t.Fatalf("decoded %d bytes, header says %d", len(out), n)
+	}
+	return out
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, size := range []int{0, 10, 200, 70000} {
+		data := []byte(strings.Repeat("a", size))
+		if got := snappyDecodeLiterals(t, snappyEncode(data)); string(got) != string(data) {
+			t.Fatalf("size %d: roundtrip mismatch", size)
+		}
+	}
+}
+
+func TestPushResults(t *testing.T) {
+	setupLogger("console", "error")
+	os.Setenv("GIT_SHA", "abc123")
+	defer os.Unsetenv("GIT_SHA")
+	var pushPath, pushMethod, pushBody string
+	pgw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushPath, pushMethod = r.URL.Path, r.Method
+		b, _ := ioutil.ReadAll(r.Body)
+		pushBody = string(b)
+	}))
+	defer pgw.Close()
+	var rwBody []byte
+	var rwEncoding string
+	rw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rwEncoding = r.Header.Get("Content-Encoding")
+		rwBody, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer rw.Close()
+
+	m := testCIManager()
+	m.SuiteConfigPath = "load/run_configs/nightly.yaml"
+	m.RunID = "run-1"
+	m.runReports[0].Configuration.Metadata = map[string]string{"build-id": "42"}
+	m.runReports[1].Metrics["first"].Requests = 10
+	m.GeneratorConfig.ResultsPush.Pushgateway = pgw.URL
+	m.GeneratorConfig.ResultsPush.RemoteWrite = rw.URL + "/api/v1/write"
+	m.GeneratorConfig.ResultsPush.Labels = map[string]string{"env": "staging"}
+	m.PushResults()
+
+	job := base64.RawURLEncoding.EncodeToString([]byte(defaultPushJob))
+	suite := base64.RawURLEncoding.EncodeToString([]byte("nightly"))
+	if pushMethod != http.MethodPut || pushPath != "/metrics/job@base64/"+job+"/suite@base64/"+suite {
+		t.Fatalf("unexpected push: %s %s", pushMethod, pushPath)
+	}
+	for _, line := range []string{
+		"# TYPE loadgen_run_passed gauge",
+		`loadgen_run_passed{env="staging",git_sha="abc123",handle="first",meta_build_id="42",run_id="run-1",step="steady"} 1`,
+		`loadgen_run_passed{env="staging",git_sha="abc123",handle="second",run_id="run-1",step="steady"} 0`,
+		`loadgen_run_error_ratio{env="staging",git_sha="abc123",handle="second",label="first",run_id="run-1",step="steady"} 0.5`,
+		`loadgen_run_latency_seconds{env="staging",git_sha="abc123",handle="first",label="first",meta_build_id="42",quantile="0.5",run_id="run-1",step="steady"} 0.1`,
+		`loadgen_suite_passed{env="staging",git_sha="abc123",run_id="run-1"} 0`,
+	} {
+		if !strings.Contains(pushBody, line+"\n") {
+			t.Fatalf("no %q in pushed metrics:\n%s", line, pushBody)
+		}
+	}
+	if strings.Contains(pushBody, "suite=") {
+		t.Fatalf("grouping label must be in url only:\n%s", pushBody)
+	}
+
+	if rwEncoding != "snappy" {
+		t.Fatalf("unexpected remote write encoding %q", rwEncoding)
+	}
+	req := string(snappyDecodeLiterals(t, rwBody))
+	for _, s := range []string{"__name__", "loadgen_run_rate", "suite", "nightly", "job", defaultPushJob, "abc123"} {
+		if !strings.Contains(req, s) {
+			t.Fatalf("no %q in remote write request", s)
+		}
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	samples := []resultSample{{name: "m", labels: map[string]string{"a": "b"}, value: 1}}
+	got := encodeWriteRequest(samples, time.Unix(1, 500*int64(time.Millisecond)))
+	want := []byte{
+		0x0a, 0x25, // timeseries
+		0x0a, 0x0d, 0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 0x12, 0x01, 'm', // __name__ label
+		0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', // a label
+		0x12, 0x0c, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x10, 0xdc, 0x0b, // sample 1.0 at 1500ms
+	}
+	if string(got) != string(want) {
+		t.Fatalf("unexpected encoding:\n%x\n%x", got, want)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SuiteStateFile suite progress file in report dir
+	SuiteStateFile = "suite_state.json"
+	// stepReportsDir dir in report dir where reports of every step are kept for resume
+	stepReportsDir = "steps"
+)
+
+// Step statuses
+const (
+	StepCompleted   = "completed"
+	StepFailed      = "failed"
+	StepInterrupted = "interrupted"
+)
+
+// Suite run modes
+const (
+	// RunAll runs all steps, previous state is overwritten
+	RunAll = ""
+	// RunResume runs steps that are not finished in previous run: interrupted or not started
+	RunResume = "resume"
+	// RunOnlyFailed runs steps that are not completed in previous run: failed, interrupted or not started
+	RunOnlyFailed = "only_failed"
+)
+
+// StepState result of a suite step
+type StepState struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Reports handle report paths
+	Reports map[string]string `json:"reports"`
+	// DataOffsets records read from every csv read file, re-run of the step continues from them
+	DataOffsets map[string]int `json:"dataOffsets"`
+}
+
+// SuiteState suite progress, persisted after every step
+type SuiteState struct {
+	Suite     string       `json:"suite"`
+	StartedAt time.Time    `json:"startedAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Steps     []*StepState `json:"steps"`
+}
+
+// Step finds step state by name
+func (s *SuiteState) Step(name string) *StepState {
+	for _, st := range s.Steps {
+		if st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// setStep adds or replaces step state
+func (s *SuiteState) setStep(step *StepState) {
+	for i, st := range s.Steps {
+		if st.Name == step.Name {
+			s.Steps[i] = step
+			return
+		}
+	}
+	s.Steps = append(s.Steps, step)
+}
+
+// shouldSkip checks if step is done in previous run for selected mode
+func (s *SuiteState) shouldSkip(name string, mode string) bool {
+	st := s.Step(name)
+	if st == nil {
+		return false
+	}
+	switch mode {
+	case RunResume:
+		return st.Status == StepCompleted || st.Status == StepFailed
+	case RunOnlyFailed:
+		return st.Status == StepCompleted
+	default:
+		return false
+	}
+}
+
+func (m *LoadManager) suiteStatePath() string {
+	return filepath.Join(m.ReportDir, SuiteStateFile)
+}
+
+// LoadSuiteState reads suite progress of previous run from report dir
+func (m *LoadManager) LoadSuiteState() (*SuiteState, error) {
+	data, err := ioutil.ReadFile(m.suiteStatePath())
+	if err != nil {
+		return nil, err
+	}
+	var state SuiteState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse suite state %s: %s", m.suiteStatePath(), err)
+	}
+	return &state, nil
+}
+
+// initSuiteState prepares suite state for the selected run mode, reports of skipped steps are loaded to be merged with new results
+func (m *LoadManager) initSuiteState() {
+	if m.RunMode == RunAll {
+		m.state = &SuiteState{Suite: m.SuiteConfigPath, StartedAt: time.Now()}
+		return
+	}
+	state, err := m.LoadSuiteState()
+	if os.IsNotExist(err) {
+		log.Infof("no suite state found in %s, running all steps", m.ReportDir)
+		m.state = &SuiteState{Suite: m.SuiteConfigPath, StartedAt: time.Now()}
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if state.Suite != m.SuiteConfigPath {
+		log.Warnf("suite state was written by another suite config: %s, current: %s", state.Suite, m.SuiteConfigPath)
+	}
+	m.state = state
+	for _, step := range m.Steps {
+		st := state.Step(step.Name)
+		if st == nil {
+			continue
+		}
+		if !state.shouldSkip(step.Name, m.RunMode) {
+			continue
+		}
+		for _, repPath := range st.Reports {
+			rep, err := readRunReport(repPath)
+			if err != nil {
+				log.Fatalf("failed to load report of step %s: %s", step.Name, err)
+			}
+			if rep.Step == "" {
+				rep.Step = step.Name
+			}
+			rep.CarriedOver = true
+			m.Reports[rep.key()] = rep
+			m.runReports = append(m.runReports, rep)
+		}
+	}
+}
+
+// dataOffset records of csv read file consumed by the step in previous run
+func (m *LoadManager) dataOffset(stepName string, csvName string) int {
+	if m.state == nil {
+		return 0
+	}
+	st := m.state.Step(stepName)
+	if st == nil {
+		return 0
+	}
+	return st.DataOffsets[csvName]
+}
+
+// skipStepFromState checks if step is already done in previous run
+func (m *LoadManager) skipStepFromState(name string) bool {
+	if m.state.shouldSkip(name, m.RunMode) {
+		log.Infof("step %s is %s in previous run, skipping", name, m.state.Step(name).Status)
+		return true
+	}
+	return false
+}
+
+// saveStepState stores step reports and updates suite state file
+func (m *LoadManager) saveStepState(step RunStep) {
+	st := &StepState{
+		Name:        step.Name,
+		Status:      StepCompleted,
+		FinishedAt:  time.Now(),
+		Reports:     make(map[string]string),
+		DataOffsets: make(map[string]int),
+	}
+	dir := filepath.Join(m.ReportDir, stepReportsDir)
+	createDirIfNotExists(dir)
+	for _, r := range step.Runners {
+		mainKey := reportKey(step.Name, r.name, false)
+		if _, ok := m.Reports[mainKey]; !ok || r.interrupted.Get() {
+			st.Status = StepInterrupted
+		}
+		for _, key := range []string{mainKey, reportKey(step.Name, r.name, true)} {
+			rep, ok := m.Reports[key]
+			if !ok {
+				continue
+			}
+			if st.Status != StepInterrupted && (r.failed.Get() || rep.Failed || hasErrors(rep)) {
+				st.Status = StepFailed
+			}
+			repPath := filepath.Join(dir, fmt.Sprintf(HandleReportFileTmpl, key))
+			b, err := json.MarshalIndent(rep, "", "    ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := writeFileAtomic(repPath, b); err != nil {
+				log.Fatal(err)
+			}
+			st.Reports[key] = repPath
+		}
+		if name := r.Config.ReadFromCsvName; name != "" {
+			if s, ok := m.CsvStore[name]; ok {
+				st.DataOffsets[name] = s.Offset
+			}
+		}
+	}
+	m.state.setStep(st)
+	m.state.UpdatedAt = time.Now()
+	b, err := json.MarshalIndent(m.state, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeFileAtomic(m.suiteStatePath(), b); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("step %s is %s, suite state is written to %s", step.Name, st.Status, m.suiteStatePath())
+}
+
+func hasErrors(rep *RunReport) bool {
+	for _, m := range rep.Metrics {
+		if len(m.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func readRunReport(path string) (*RunReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rep RunReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// writeFileAtomic writes file through temp file in the same dir, so readers never see partial data
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
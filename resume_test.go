@@ -0,0 +1,141 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testResumeManager(dir string, mode string, steps ...RunStep) *LoadManager {
+	return &LoadManager{
+		ReportDir:       dir,
+		SuiteConfigPath: "suite.yaml",
+		RunMode:         mode,
+		Steps:           steps,
+		Reports:         make(map[string]*RunReport),
+		CsvStore:        make(map[string]*CSVData),
+	}
+}
+
+func testResumeStep(name string, handle string) RunStep {
+	return RunStep{Name: name, Runners: []*Runner{{name: handle, step: name}}}
+}
+
+func TestSuiteStateResume(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	steps := []RunStep{
+		testResumeStep("ok", "first"),
+		testResumeStep("failed", "second"),
+		testResumeStep("interrupted", "third"),
+	}
+	m := testResumeManager(dir, RunAll, steps...)
+	m.initSuiteState()
+	m.Reports["ok-first"] = &RunReport{
+		Step:          "ok",
+		Configuration: RunnerConfig{HandleName: "first"},
+		Metrics:       map[string]*Metrics{"first": {Requests: 10}},
+	}
+	m.Reports["ok-first-validation"] = &RunReport{
+		Step:          "ok",
+		Configuration: RunnerConfig{HandleName: "first", IsValidationRun: true},
+		Metrics:       map[string]*Metrics{"first": {Requests: 5}},
+	}
+	m.saveStepState(steps[0])
+	m.Reports["failed-second"] = &RunReport{
+		Step:          "failed",
+		Configuration: RunnerConfig{HandleName: "second"},
+		Metrics:       map[string]*Metrics{"second": {Requests: 10, Errors: []string{"boom"}}},
+	}
+	m.saveStepState(steps[1])
+	steps[2].Runners[0].interrupted.Set(true)
+	m.Reports["interrupted-third"] = &RunReport{Step: "interrupted", Configuration: RunnerConfig{HandleName: "third"}, Interrupted: true}
+	m.saveStepState(steps[2])
+
+	tests := []struct {
+		mode    string
+		skipped map[string]bool
+	}{
+		{RunResume, map[string]bool{"ok": true, "failed": true, "interrupted": false}},
+		{RunOnlyFailed, map[string]bool{"ok": true, "failed": false, "interrupted": false}},
+		{RunAll, map[string]bool{"ok": false, "failed": false, "interrupted": false}},
+	}
+	for _, tt := range tests {
+		resumed := testResumeManager(dir, tt.mode, steps...)
+		resumed.initSuiteState()
+		for step, skip := range tt.skipped {
+			if got := resumed.skipStepFromState(step); got != skip {
+				t.Errorf("mode %q, step %s: expected skip %v, got %v", tt.mode, step, skip, got)
+			}
+		}
+		// reports of skipped steps are merged, validation runs are kept apart from main runs
+		for _, key := range []string{"ok-first", "ok-first-validation"} {
+			rep, ok := resumed.Reports[key]
+			if ok != (tt.mode != RunAll) {
+				t.Errorf("mode %q: unexpected merge of completed step report %s: %v", tt.mode, key, ok)
+			}
+			if ok && (!rep.CarriedOver || reportSucceeded(rep)) {
+				t.Errorf("mode %q: report %s must be carried over and never a baseline", tt.mode, key)
+			}
+		}
+		if tt.mode == RunResume {
+			resumed.RunID = "resumed"
+			resumed.updateRunIndex()
+			idx, err := resumed.LoadRunIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := idx.Runs[len(idx.Runs)-1].Handles["ok-first"]; !h.CarriedOver || h.Success {
+				t.Errorf("carried over report must not be indexed as success: %+v", h)
+			}
+		}
+	}
+}
+
+func TestCSVDataSkip(t *testing.T) {
+	f, err := ioutil.TempFile("", "loadgen-data-*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("1\n2\n3\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	d := NewCSVData(f, false)
+	if err := d.Skip(2); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec[0] != "3" || d.Offset != 3 {
+		t.Fatalf("expected record 3 at offset 3, got %s at %d", rec[0], d.Offset)
+	}
+	if err := d.Skip(1); err == nil {
+		t.Fatal("expected EOF error without recycle")
+	}
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/rcrowley/go-metrics"
-	"github.com/spf13/viper"
 
 	"go.uber.org/ratelimit"
 )
@@ -53,6 +52,11 @@ const (
 	constantLoad
 )
 
+var testStageNames = map[int]string{
+	rampUp:       "rampup",
+	constantLoad: "constant",
+}
+
 // Default runner runtime check types
 const (
 	prometheusCheckType = "prometheus"
@@ -60,23 +64,33 @@ const (
 )
 
 type Runner struct {
-	name             string
-	TestStage        int
-	ReadCsvName      string
-	WriteCsvName     string
-	RecycleData      bool
-	Manager          *LoadManager
-	Config           RunnerConfig
-	attackersMu      *sync.Mutex
-	attackers        []Attack
-	failed           bool // if tests are failed for any reason
-	running          bool
-	shutDownOnce     *sync.Once
-	stopped          bool // if tests are stopped by hook
-	next, quit, stop chan bool
-	results          chan result
-	prototype        Attack
-	resultsPipeline  func(r result) result
+	name         string
+	step         string
+	TestStage    int
+	ReadCsvName  string
+	WriteCsvName string
+	RecycleData  bool
+	Manager      *LoadManager
+	Config       RunnerConfig
+	attackersMu  *sync.Mutex
+	attackers    []Attack
+	quits        []chan bool // quit channel for every attacker
+	failed       AtomicBool  // if tests are failed for any reason
+	running      AtomicBool
+	shutDownOnce *sync.Once
+	stopped      AtomicBool // if tests are stopped by hook
+	// fullAttackStartedAt start of constant load, report start time
+	fullAttackStartedAt time.Time
+	interrupted         AtomicBool // if tests are stopped before attack time ends, by control api or signal
+	paused              *AtomicBool
+	controlMu           *sync.RWMutex // guards RPS, MaxAttackers and TestStage changed on the fly
+	next                chan time.Time
+	stop                chan bool
+	results             chan result
+	prototype           Attack
+	success             *successCriteria // success criteria of request results
+	validator           ResultValidator  // optional attacker result validator
+	resultsPipeline     func(r result) result
 
 	// Checks whether to stop generator
 	checkFunc RuntimeCheckFunc
@@ -86,19 +100,24 @@ type Runner struct {
 	PromClient v1.API
 
 	// Metrics
-	registeredMetricsLabels []string
-	RateLog                 []float64
-	MaxRPS                  float64
+	RateLog []float64
+	MaxRPS  float64
 	// RampUpMetrics store only rampup interval metrics, cleared every interval
 	RampUpMetrics map[string]*Metrics
 	// Metrics store full attack metrics
-	Metrics               map[string]*Metrics
-	timerMu               *sync.RWMutex
-	timers                map[string]metrics.Timer
-	errorsMu              *sync.RWMutex
-	Errors                map[string]metrics.Counter
-	goroutinesCountGaugue metrics.Gauge
-	goroutinesCount       int64
+	Metrics   map[string]*Metrics
+	metricsMu *sync.RWMutex
+	// Errors error counters of request labels for all runs of the handle
+	Errors   map[string]metrics.Counter
+	errorsMu *sync.RWMutex
+	// Snapshots per second results of the last run
+	Snapshots  []Snapshot
+	snapshotMu *sync.Mutex
+	bucket     *snapshotBucket
+	// saturation events when generator was the bottleneck, generatorBound is set if they are marked in report
+	saturation     []SaturationEvent
+	generatorBound bool
+	saturationMu   *sync.Mutex
 
 	L *Logger
 }
@@ -127,22 +146,23 @@ func NewRunner(name string, lm *LoadManager, a Attack, ch RuntimeCheckFunc, c Ru
 		RateLog:    []float64{},
 
 		shutDownOnce: &sync.Once{},
-		next:         make(chan bool),
-		quit:         make(chan bool),
+		paused:       &AtomicBool{},
+		controlMu:    &sync.RWMutex{},
+		next:         make(chan time.Time),
 		stop:         make(chan bool),
 		results:      make(chan result),
 		attackersMu:  &sync.Mutex{},
 		attackers:    []Attack{},
+		quits:        []chan bool{},
 
-		registeredMetricsLabels: make([]string, 0),
-		RampUpMetrics:           make(map[string]*Metrics),
-		Metrics:                 make(map[string]*Metrics),
-		timerMu:                 &sync.RWMutex{},
-		timers:                  make(map[string]metrics.Timer),
-		errorsMu:                &sync.RWMutex{},
-		Errors:                  make(map[string]metrics.Counter),
-		goroutinesCount:         0,
-		goroutinesCountGaugue:   metrics.NewGauge(),
+		RampUpMetrics: make(map[string]*Metrics),
+		Metrics:       make(map[string]*Metrics),
+		metricsMu:     &sync.RWMutex{},
+		Errors:        make(map[string]metrics.Counter),
+		errorsMu:      &sync.RWMutex{},
+		snapshotMu:    &sync.Mutex{},
+		bucket:        newSnapshotBucket(),
+		saturationMu:  &sync.Mutex{},
 
 		L: &Logger{log.With("runner", name)},
 	}
@@ -156,18 +176,25 @@ func NewRunner(name string, lm *LoadManager, a Attack, ch RuntimeCheckFunc, c Ru
 		}
 		fmt.Println()
 		flag.Usage()
-		os.Exit(0)
+		os.Exit(ExitConfigError)
 	}
 
-	// is the attacker interested in the Run lifecycle?
-	if lifecycler, ok := a.(BeforeRunner); ok {
-		if err := lifecycler.BeforeRun(c); err != nil {
-			log.Fatalf("BeforeRun failed: %s", err)
-		}
+	sc, err := newSuccessCriteria(c.Success)
+	if err != nil {
+		log.Fatalf("invalid success criteria: %s", err)
+	}
+	r.success = sc
+	if v, ok := a.(ResultValidator); ok {
+		r.validator = v
 	}
 
-	// do a test if the flag says so
+	// do a test if the flag says so, BeforeRun failure of a suite run is reported by Run
 	if *oSample > 0 {
+		if lifecycler, ok := a.(BeforeRunner); ok {
+			if err := lifecycler.BeforeRun(c); err != nil {
+				log.Fatalf("BeforeRun failed: %s", err)
+			}
+		}
 		r.test(*oSample)
 		report := RunReport{}
 		if lifecycler, ok := a.(AfterRunner); ok {
@@ -183,35 +210,101 @@ func NewRunner(name string, lm *LoadManager, a Attack, ch RuntimeCheckFunc, c Ru
 }
 
 func (r *Runner) initPipeline() {
-	r.resultsPipeline = r.addResult
+	r.setResultsPipeline(r.addResult)
+}
+
+// setResultsPipeline changes function results are collected with, rampup collects results of every second separately
+func (r *Runner) setResultsPipeline(p func(r result) result) {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	r.resultsPipeline = p
+}
+
+// setRampUpMetrics stores metrics of the last rampup second
+func (r *Runner) setRampUpMetrics(m *Metrics) {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	r.RampUpMetrics[r.name] = m
 }
 
 func (r *Runner) spawnAttacker() {
 	if r.Config.Verbose {
-		r.L.Debugf("setup and spawn new attacker [%d]", len(r.attackers)+1)
+		r.L.Debugf("setup and spawn new attacker [%d]", r.attackersCount()+1)
 	}
 	attacker := r.prototype.Clone(r)
 	if err := attacker.Setup(r.Config); err != nil {
-		r.L.Infof("attacker [%d] setup failed with [%v]", len(r.attackers)+1, err)
+		r.L.Infof("attacker [%d] setup failed with [%v]", r.attackersCount()+1, err)
 		return
 	}
+	quit := make(chan bool)
 	r.attackersMu.Lock()
 	defer r.attackersMu.Unlock()
 	r.attackers = append(r.attackers, attacker)
-	go attack(attacker, r.next, r.quit, r.results, r.Config.timeout())
+	r.quits = append(r.quits, quit)
+	go attack(attacker, r.next, quit, r.results, r.Config.timeout())
+}
+
+// attackersCount number of running attackers, attackers may be trimmed by control api
+func (r *Runner) attackersCount() int {
+	r.attackersMu.Lock()
+	defer r.attackersMu.Unlock()
+	return len(r.attackers)
+}
+
+// trimAttackers stops and tears down the latest attackers until count is reached
+func (r *Runner) trimAttackers(count int) {
+	r.attackersMu.Lock()
+	defer r.attackersMu.Unlock()
+	for len(r.attackers) > count {
+		last := len(r.attackers) - 1
+		r.quits[last] <- true
+		if err := r.attackers[last].Teardown(); err != nil {
+			r.L.Infof("failed to teardown attacker [%d]:%v", last, err)
+		}
+		r.attackers = r.attackers[:last]
+		r.quits = r.quits[:last]
+	}
 }
 
 // addResult is called from a dedicated goroutine.
 func (r *Runner) addResult(s result) result {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	// results of in-flight requests after shutdown must not change the stored report
+	if r.stopped.Get() {
+		return s
+	}
 	m, ok := r.Metrics[s.doResult.RequestLabel]
 	if !ok {
 		m = new(Metrics)
+		m.setSLO(r.Config.SLO)
 		r.Metrics[s.doResult.RequestLabel] = m
 	}
 	m.add(s)
+	if ClassifyError(s.doResult) != "" {
+		r.errCounter(s.doResult.RequestLabel).Inc(1)
+	}
 	return s
 }
 
+// errCounter error counter of request label, see Errors
+func (r *Runner) errCounter(label string) metrics.Counter {
+	r.errorsMu.RLock()
+	cnt, ok := r.Errors[label]
+	r.errorsMu.RUnlock()
+	if ok {
+		return cnt
+	}
+	r.errorsMu.Lock()
+	defer r.errorsMu.Unlock()
+	if cnt, ok := r.Errors[label]; ok {
+		return cnt
+	}
+	cnt = metrics.NewCounter()
+	r.Errors[label] = cnt
+	return cnt
+}
+
 // test uses the Attack to perform {count} calls and report its result
 // it is intended for development of an Attack implementation.
 func (r *Runner) test(count int) {
@@ -223,7 +316,7 @@ func (r *Runner) test(count int) {
 	defer probe.Teardown()
 	for s := count; s > 0; s-- {
 		now := time.Now()
-		result := probe.Do(context.Background())
+		result := r.checkResult(probe.Do(context.Background()))
 		log.Infof("test attack call [%s] took [%v] with status [%v] and error [%v]", result.RequestLabel, time.Now().Sub(now), result.StatusCode, result.Error)
 	}
 }
@@ -237,7 +330,14 @@ func (r *Runner) SetupHandleStore(m *LoadManager) {
 		if err != nil {
 			log.Fatalf("no csv read file found: %s", csvReadName)
 		}
-		m.CsvStore[csvReadName] = NewCSVData(f, recycleData)
+		s := NewCSVData(f, recycleData)
+		if offset := m.dataOffset(r.step, csvReadName); offset > 0 {
+			log.Infof("skipping %d records of %s consumed in previous run", offset, csvReadName)
+			if err := s.Skip(offset); err != nil {
+				log.Fatal(err)
+			}
+		}
+		m.CsvStore[csvReadName] = s
 	}
 	csvWriteName := r.Config.WriteToCsvName
 	if csvWriteName != "" {
@@ -278,50 +378,89 @@ func (r *Runner) defaultCheckByData() {
 func (r *Runner) init() {
 	r.shutDownOnce = &sync.Once{}
 	r.attackers = make([]Attack, 0)
-	r.failed = false
-	r.stopped = false
+	r.quits = make([]chan bool, 0)
+	r.stop = make(chan bool)
+	r.failed.Set(false)
+	r.stopped.Set(false)
+	r.interrupted.Set(false)
+	r.paused.Set(false)
+	// stored reports keep metrics of previous runs, validation run starts from scratch
+	r.metricsMu.Lock()
+	r.Metrics = make(map[string]*Metrics)
+	r.RampUpMetrics = make(map[string]*Metrics)
+	r.metricsMu.Unlock()
+	r.saturationMu.Lock()
+	r.saturation = nil
+	r.generatorBound = false
+	r.saturationMu.Unlock()
 	r.collectResults()
-	r.initMonitoring()
 }
 
 // Run offers the complete flow of a test.
 func (r *Runner) Run(wg *sync.WaitGroup, lm *LoadManager) {
 	r.init()
-	r.resultsPipeline = r.addResult
+	// runner may be stopped from now on
+	r.running.Set(true)
+	r.watchSnapshots()
+	r.setResultsPipeline(r.addResult)
 	if wg != nil {
 		defer wg.Done()
 	}
 	if lifecycler, ok := r.prototype.(BeforeRunner); ok {
 		if err := lifecycler.BeforeRun(r.Config); err != nil {
-			r.L.Infof("BeforeRun failed", err)
+			r.L.Errorf("BeforeRun failed: %s", err)
+			r.Shutdown()
+			rep := NewErrorReport(fmt.Errorf("BeforeRun failed: %s", err), r.Config)
+			rep.Step = r.step
+			rep.Metrics = map[string]*Metrics{}
+			r.storeReport(lm, &rep)
+			return
 		}
 	}
 
 	if r.Config.WaitBeforeSec != 0 {
 		r.L.Infof("awaiting runner start, sleeping for %d sec", r.Config.WaitBeforeSec)
-		time.Sleep(time.Duration(r.Config.WaitBeforeSec) * time.Second)
+		select {
+		case <-time.After(time.Duration(r.Config.WaitBeforeSec) * time.Second):
+		case <-r.stop:
+		}
+	}
+	if !lm.stepRunnable() {
+		r.Stop()
 	}
 	r.defaultCheckByData()
 	r.checkStopIf()
-	r.running = true
 	if r.rampUp() {
 		r.fullAttack()
 	}
 	r.Shutdown()
 	r.ReportMaxRPS()
 	report := RunReport{}
+	rep := r.reportMetrics()
 	if lifecycler, ok := r.prototype.(AfterRunner); ok {
 		if err := lifecycler.AfterRun(&report); err != nil {
-			r.L.Infof("AfterRun failed", err)
+			r.L.Errorf("AfterRun failed: %s", err)
+			rep.RunError = fmt.Sprintf("AfterRun failed: %s", err)
+			rep.Failed = true
 		}
 	}
+	r.storeReport(lm, rep)
+}
+
+// storeReport adds handle run report to manager reports
+func (r *Runner) storeReport(lm *LoadManager, rep *RunReport) {
 	lm.CsvMu.Lock()
 	defer lm.CsvMu.Unlock()
-	rep := r.reportMetrics()
-	lm.Reports[r.name] = rep
+	lm.Reports[r.reportKey()] = rep
+	lm.runReports = append(lm.runReports, rep)
 }
 
-func (r *Runner) SetValidationParams() {
+// SetValidationParams prepares validation run of max rps achieved by the main run,
+// max rps of saturated generator is its own limit, such runs are not validated
+func (r *Runner) SetValidationParams() error {
+	if r.saturated() {
+		return fmt.Errorf("generator was saturated, max rps %.2f is a generator limit", r.MaxRPS)
+	}
 	r.RateLog = []float64{}
 	r.Config.IsValidationRun = true
 	r.Config.AttackTimeSec = r.Config.Validation.AttackTimeSec
@@ -333,85 +472,99 @@ func (r *Runner) SetValidationParams() {
 	}
 	r.Config.RPS = rpsWithNoErrors
 	r.L.Infof("running validation of max rps: %d for %d seconds", r.Config.RPS, r.Config.AttackTimeSec)
+	r.annotate(AnnotationValidation, fmt.Sprintf("%s: validation of max rps %d for %ds", r.name, r.Config.RPS, r.Config.AttackTimeSec))
+	return nil
 }
 
-func (r *Runner) initMonitoring() {
-	url := viper.GetString("graphite.url")
-	if url == "" {
-		return
-	}
-	flushDuration := time.Duration(viper.GetInt("graphite.flushDurationSec"))
-	loadGeneratorPrefix := viper.GetString("graphite.loadGeneratorPrefix")
-
-	StartGraphiteSender(loadGeneratorPrefix, flushDuration, url)
-	r.registerMetric("goroutines-"+r.name, r.goroutinesCountGaugue)
+// reportKey key of the current handle run report, see reportKey
+func (r *Runner) reportKey() string {
+	return reportKey(r.step, r.name, r.Config.IsValidationRun)
 }
 
-func (r *Runner) registerLabelTimings(label string) metrics.Timer {
-	r.timerMu.RLock()
-	timer, ok := r.timers[label]
-	r.timerMu.RUnlock()
-	if ok {
-		return timer
+// annotate records annotation of the handle in manager
+func (r *Runner) annotate(kind string, text string) {
+	if r.Manager == nil {
+		return
 	}
-	r.timerMu.Lock()
-	defer r.timerMu.Unlock()
-	timer = metrics.NewTimer()
-	r.timers[label] = timer
-	r.registerMetric(label+"-timer", timer)
-	return timer
+	r.Manager.annotate(kind, r.step, r.name, text)
 }
 
-func (r *Runner) registerErrCount(label string) metrics.Counter {
-	r.errorsMu.RLock()
-	cnt, ok := r.Errors[label]
-	r.errorsMu.RUnlock()
-	if ok {
-		return cnt
+// sendGauges sends runner state of the last second to metrics sinks
+func (r *Runner) sendGauges(s Snapshot) {
+	if r.Manager == nil {
+		return
 	}
-	r.errorsMu.Lock()
-	defer r.errorsMu.Unlock()
-	cnt = metrics.NewCounter()
-	r.Errors[label] = cnt
-	r.registerMetric(label+"-err", cnt)
-	return cnt
+	tags := map[string]string{"runner": r.name, "step": r.step}
+	r.Manager.sinks.Gauge("attackers", tags, float64(s.Attackers))
+	r.Manager.sinks.Gauge("target_rps", tags, float64(s.TargetRPS))
+	r.Manager.sinks.Gauge("achieved_rps", tags, float64(s.Requests))
 }
 
-func (r *Runner) registerMetric(name string, metric interface{}) {
-	r.registeredMetricsLabels = append(r.registeredMetricsLabels, name)
-	if err := metrics.Register(name, metric); err != nil {
-		log.Infof("failed to register metric: %s", err)
+// updateSLOGauges sends apdex, slo attainment and remaining error budget of every label since start of the run
+func (r *Runner) updateSLOGauges() {
+	if r.Manager == nil {
+		return
+	}
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	for label, m := range r.Metrics {
+		if m.slo == nil {
+			continue
+		}
+		m.updateSLO()
+		tags := resultTags(r.step, r.name, label)
+		r.Manager.sinks.Gauge("apdex", tags, m.SLO.Apdex)
+		r.Manager.sinks.Gauge("slo", tags, m.SLO.Attainment)
+		if m.slo.Objective != 0 {
+			r.Manager.sinks.Gauge("error_budget", tags, m.SLO.ErrorBudgetRemaining)
+		}
 	}
 }
 
 func (r *Runner) fullAttack() {
-	r.TestStage = constantLoad
+	r.setStage(constantLoad)
+	r.annotate(AnnotationStage, fmt.Sprintf("%s: constant load %d rps for %ds", r.name, r.targetRPS(), r.Config.AttackTimeSec-r.Config.RampUpTimeSec))
 	if r.Config.Verbose {
 		r.L.Infof("begin full attack of [%d] remaining seconds", r.Config.AttackTimeSec-r.Config.RampUpTimeSec)
 	}
-	fullAttackStartedAt = time.Now()
-	limiter := ratelimit.New(r.Config.RPS)
+	r.fullAttackStartedAt = time.Now()
+	rps := r.targetRPS()
+	limiter := ratelimit.New(rps)
 	doneDeadline := time.Now().Add(time.Duration(r.Config.AttackTimeSec-r.Config.RampUpTimeSec) * time.Second)
 	go func() {
 		interval := 1 * time.Second
 		for {
 			time.Sleep(interval)
-			if r.stopped {
+			if r.stopped.Get() {
 				return
 			}
-			r.Metrics[r.name].updateLatencies()
-			r.Metrics[r.name].updateSuccessRatio()
+			r.metricsMu.Lock()
+			if m, ok := r.Metrics[r.name]; ok {
+				m.updateLatencies()
+				m.updateSuccessRatio()
+			}
+			r.metricsMu.Unlock()
 		}
 	}()
 	for time.Now().Before(doneDeadline) {
+		// paused time is not counted as attack time
+		doneDeadline = doneDeadline.Add(r.waitIfPaused())
+		if current := r.targetRPS(); current != rps {
+			r.L.Infof("changing rps: %d -> %d", rps, current)
+			rps = current
+			limiter = ratelimit.New(rps)
+		}
 		select {
 		case <-r.stop:
 			r.L.Infof("full attack stopped")
 			return
 		default:
-			limiter.Take()
-			if !r.stopped {
-				r.next <- true
+			scheduled := limiter.Take()
+			select {
+			case r.next <- scheduled:
+			case <-r.stop:
+				r.L.Infof("full attack stopped")
+				return
 			}
 		}
 	}
@@ -421,7 +574,11 @@ func (r *Runner) fullAttack() {
 }
 
 func (r *Runner) rampUp() bool {
-	r.TestStage = rampUp
+	r.setStage(rampUp)
+	if r.stopped.Get() {
+		return false
+	}
+	r.annotate(AnnotationStage, fmt.Sprintf("%s: rampup to %d rps in %ds", r.name, r.targetRPS(), r.Config.RampUpTimeSec))
 	strategy := r.Config.rampupStrategy()
 	if r.Config.Verbose {
 		r.L.Infof("begin rampup of [%d] seconds to RPS [%d] within attack of [%d] seconds using strategy [%s]",
@@ -433,15 +590,15 @@ func (r *Runner) rampUp() bool {
 	}
 	var finished bool
 	switch strategy {
-	case "linear":
+	case linearRampupStrategy:
 		finished = linearIncreasingGoroutinesAndRequestsPerSecondStrategy{}.execute(r)
-	case "exp2":
+	case exp2RampupStrategy:
 		finished = spawnAsWeNeedStrategy{}.execute(r)
 	}
 	// restore pipeline function in case it was changed by the rampup strategy
-	r.resultsPipeline = r.addResult
+	r.setResultsPipeline(r.addResult)
 	if r.Config.Verbose {
-		r.L.Infof("end rampup ending up with [%d] attackers", len(r.attackers))
+		r.L.Infof("end rampup ending up with [%d] attackers", r.attackersCount())
 	}
 	return finished
 }
@@ -452,8 +609,8 @@ func (r *Runner) tearDownAttackers() {
 	if r.Config.Verbose {
 		log.Infof("stopping attackers [%d]", len(r.attackers))
 	}
-	for range r.attackers {
-		r.quit <- true
+	for _, quit := range r.quits {
+		quit <- true
 	}
 	if r.Config.Verbose {
 		r.L.Infof("tearing down attackers [%d]", len(r.attackers))
@@ -465,30 +622,45 @@ func (r *Runner) tearDownAttackers() {
 	}
 }
 
-func (r *Runner) unregisterMetrics() {
-	for _, m := range r.registeredMetricsLabels {
-		metrics.Unregister(m)
-	}
-}
-
 func (r *Runner) reportMetrics() *RunReport {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
 	for _, each := range r.Metrics {
 		each.updateLatencies()
 	}
+	r.saturationMu.Lock()
+	defer r.saturationMu.Unlock()
 	return &RunReport{
-		StartedAt:     fullAttackStartedAt,
-		FinishedAt:    time.Now(),
-		Configuration: r.Config,
-		Metrics:       r.Metrics,
-		Failed:        false, // must be overwritten by program
-		Output:        map[string]interface{}{},
+		Step:           r.step,
+		Series:         r.snapshots(),
+		StartedAt:      r.fullAttackStartedAt,
+		FinishedAt:     time.Now(),
+		Configuration:  r.Config,
+		Metrics:        r.Metrics,
+		Failed:         r.failed.Get(), // may be overwritten by program
+		Interrupted:    r.interrupted.Get(),
+		GeneratorBound: r.generatorBound,
+		Saturation:     append([]SaturationEvent{}, r.saturation...),
+		Output:         map[string]interface{}{},
 	}
 }
 
 func (r *Runner) collectResults() {
+	validation := r.Config.IsValidationRun
 	go func() {
 		for {
-			r.resultsPipeline(<-r.results)
+			res := <-r.results
+			r.bucket.add(res)
+			if r.Manager != nil && r.Manager.resultLog != nil {
+				r.Manager.resultLog.Write(r.step, r.name, validation, res)
+			}
+			if r.Manager != nil {
+				r.Manager.sinks.Result(r.step, r.name, res.doResult, res.elapsed)
+			}
+			r.metricsMu.RLock()
+			pipeline := r.resultsPipeline
+			r.metricsMu.RUnlock()
+			pipeline(res)
 		}
 	}()
 }
@@ -496,7 +668,11 @@ func (r *Runner) collectResults() {
 func (r *Runner) ReportMaxRPS() {
 	r.MaxRPS = MaxRPS(r.RateLog)
 	r.L.Infof("max rps: %.2f", r.MaxRPS)
-	if r.Config.IsValidationRun && !r.failed {
+	if r.Config.IsValidationRun && r.saturated() {
+		r.L.Warnf("generator was saturated, max rps is not written to scaling info")
+		return
+	}
+	if r.Config.IsValidationRun && !r.failed.Get() && !r.interrupted.Get() {
 		entry := []string{r.name, os.Getenv("NETWORK_NODES"), fmt.Sprintf("%.2f", r.MaxRPS)}
 		r.L.Infof("writing scaling info: %s", entry)
 		if err := r.Manager.RPSScalingLog.Write(entry); err != nil {
@@ -506,15 +682,17 @@ func (r *Runner) ReportMaxRPS() {
 }
 
 func (r *Runner) Shutdown() {
-	if r.running {
+	if r.running.Get() {
 		r.shutDownOnce.Do(func() {
 			r.L.Infof("test ended, shutting down runner")
-			r.running = false
-			r.stop <- true
-			r.stopped = true
+			r.running.Set(false)
+			r.stopped.Set(true)
+			close(r.stop)
 			r.checkFunc = nil
 			r.tearDownAttackers()
-			r.unregisterMetrics()
+			if r.Manager != nil {
+				r.Manager.sinks.HandleFinished(r.step, r.name)
+			}
 			r.L.Infof("runner shutdown complete")
 		})
 	}
@@ -538,7 +716,8 @@ func (r *Runner) checkStopIf() {
 				}
 				if r.checkFunc(r) {
 					r.L.Infof("runtime check failed, exiting")
-					r.failed = true
+					r.annotate(AnnotationCheckFailed, fmt.Sprintf("%s: stop check failed, handle is stopped", r.name))
+					r.failed.Set(true)
 					r.Manager.Failed = true
 					if r.Config.IsValidationRun {
 						r.Manager.ValidationFailed = true
@@ -550,3 +729,42 @@ func (r *Runner) checkStopIf() {
 		}
 	}()
 }
+
+// targetRPS current target rps, may be changed on the fly by control api
+func (r *Runner) targetRPS() int {
+	r.controlMu.RLock()
+	defer r.controlMu.RUnlock()
+	return r.Config.RPS
+}
+
+// stage current test stage, rampup or constant load
+func (r *Runner) stage() int {
+	r.controlMu.RLock()
+	defer r.controlMu.RUnlock()
+	return r.TestStage
+}
+
+func (r *Runner) setStage(stage int) {
+	r.controlMu.Lock()
+	defer r.controlMu.Unlock()
+	r.TestStage = stage
+}
+
+// maxAttackers current attackers ceiling, may be changed on the fly by control api
+func (r *Runner) maxAttackers() int {
+	r.controlMu.RLock()
+	defer r.controlMu.RUnlock()
+	return r.Config.MaxAttackers
+}
+
+// waitIfPaused blocks while runner is paused, returns how long it was paused
+func (r *Runner) waitIfPaused() time.Duration {
+	if !r.paused.Get() {
+		return 0
+	}
+	start := time.Now()
+	for r.paused.Get() && !r.stopped.Get() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return time.Since(start)
+}
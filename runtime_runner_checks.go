@@ -55,14 +55,17 @@ func PromBooleanQuery(r *Runner) bool {
 }
 
 func ErrorPercentCheck(r *Runner, percent float64) bool {
-	if r.RampUpMetrics[r.name] != nil && r.TestStage == rampUp {
+	r.metricsMu.RLock()
+	defer r.metricsMu.RUnlock()
+	stage := r.stage()
+	if r.RampUpMetrics[r.name] != nil && stage == rampUp {
 		ratio := r.RampUpMetrics[r.name].successRatio
 		if ratio > percent {
 			return true
 		}
 		return false
 	}
-	if r.Metrics[r.name] != nil && r.TestStage == constantLoad {
+	if r.Metrics[r.name] != nil && stage == constantLoad {
 		ratio := r.Metrics[r.name].successRatio
 		if ratio > percent {
 			return true
@@ -0,0 +1,254 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Saturation reasons, generator is the bottleneck, not the target
+const (
+	SaturationCPU          = "cpu"
+	SaturationGCPause      = "gc_pause"
+	SaturationSchedLatency = "sched_latency"
+	SaturationLimiterLag   = "limiter_lag"
+	SaturationAttackers    = "attackers"
+)
+
+// AnnotationSaturation annotation kind of generator saturation
+const AnnotationSaturation = "generator_saturated"
+
+const (
+	defaultSaturationCPUPercent     = 90
+	defaultSaturationLimiterLagMs   = 100
+	defaultSaturationGCPauseMs      = 100
+	defaultSaturationSchedLatencyMs = 50
+	defaultSaturationWindowSec      = 5
+	// saturationAchievedRatio attackers capped at max_attackers saturate generator if achieved rps is lower than this part of target
+	saturationAchievedRatio = 0.9
+	// schedProbe timer used to measure scheduler latency
+	schedProbe = 1 * time.Millisecond
+)
+
+func (c SaturationConfig) cpuPercent() int64 {
+	if c.CPUPercent == 0 {
+		return defaultSaturationCPUPercent
+	}
+	return c.CPUPercent
+}
+
+func (c SaturationConfig) limiterLag() time.Duration {
+	if c.LimiterLagMs == 0 {
+		return defaultSaturationLimiterLagMs * time.Millisecond
+	}
+	return time.Duration(c.LimiterLagMs) * time.Millisecond
+}
+
+func (c SaturationConfig) gcPause() time.Duration {
+	if c.GCPauseMs == 0 {
+		return defaultSaturationGCPauseMs * time.Millisecond
+	}
+	return time.Duration(c.GCPauseMs) * time.Millisecond
+}
+
+func (c SaturationConfig) schedLatency() time.Duration {
+	if c.SchedLatencyMs == 0 {
+		return defaultSaturationSchedLatencyMs * time.Millisecond
+	}
+	return time.Duration(c.SchedLatencyMs) * time.Millisecond
+}
+
+func (c SaturationConfig) windowSec() int {
+	if c.WindowSec == 0 {
+		return defaultSaturationWindowSec
+	}
+	return c.WindowSec
+}
+
+// SaturationEvent generator was the bottleneck of a handle for saturation window
+type SaturationEvent struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Text   string    `json:"text"`
+}
+
+// RuntimeSample go runtime stats of generator process during a second
+type RuntimeSample struct {
+	Time         time.Time     `json:"time"`
+	Goroutines   int           `json:"goroutines"`
+	GCPause      time.Duration `json:"gc_pause"`
+	SchedLatency time.Duration `json:"sched_latency"`
+}
+
+// saturationSignal threshold exceeded during a second
+type saturationSignal struct {
+	reason string
+	text   string
+}
+
+// SaturationDetector checks every second if generator itself is the bottleneck of running handles:
+// host cpu, gc pauses, scheduler latency, limiter lag and attackers capped at max_attackers while rps is below target
+type SaturationDetector struct {
+	m            *LoadManager
+	c            SaturationConfig
+	pauseTotalNs uint64
+	// streaks seconds in a row a threshold is exceeded, by step, handle and reason
+	streaks map[string]int
+	stop    chan struct{}
+	done    chan struct{}
+	once    *sync.Once
+}
+
+// NewSaturationDetector creates detector with thresholds of saturation config
+func NewSaturationDetector(m *LoadManager) *SaturationDetector {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return &SaturationDetector{
+		m:            m,
+		c:            m.GeneratorConfig.Saturation,
+		pauseTotalNs: ms.PauseTotalNs,
+		streaks:      make(map[string]int),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		once:         &sync.Once{},
+	}
+}
+
+// Start checks saturation every second until Stop
+func (d *SaturationDetector) Start() {
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		tags := map[string]string{"host": d.m.GeneratorConfig.Host.Name}
+		for {
+			select {
+			case <-d.stop:
+				return
+			case t := <-ticker.C:
+				rt := d.readRuntime(t)
+				d.m.sinks.Gauge("go_goroutines", tags, float64(rt.Goroutines))
+				d.m.sinks.Gauge("go_gc_pause_ms", tags, latencyMs(rt.GCPause))
+				d.m.sinks.Gauge("go_sched_latency_ms", tags, latencyMs(rt.SchedLatency))
+				var host *HostSample
+				if d.m.HostMetrics != nil {
+					if s, ok := d.m.HostMetrics.Last(); ok {
+						host = &s
+					}
+				}
+				if step := d.m.CurrentStep(); step != nil {
+					d.check(t, host, rt, step.Runners)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checks
+func (d *SaturationDetector) Stop() {
+	d.once.Do(func() {
+		close(d.stop)
+		<-d.done
+	})
+}
+
+// readRuntime goroutines, gc pauses since previous read and scheduler latency
+func (d *SaturationDetector) readRuntime(now time.Time) RuntimeSample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	pause := ms.PauseTotalNs - d.pauseTotalNs
+	d.pauseTotalNs = ms.PauseTotalNs
+	start := time.Now()
+	time.Sleep(schedProbe)
+	return RuntimeSample{
+		Time:         now,
+		Goroutines:   runtime.NumGoroutine(),
+		GCPause:      time.Duration(pause),
+		SchedLatency: time.Since(start) - schedProbe,
+	}
+}
+
+// check finds thresholds exceeded by generator and by every handle that is attacking now,
+// handle is saturated when a threshold is exceeded for saturation window in a row
+func (d *SaturationDetector) check(now time.Time, host *HostSample, rt RuntimeSample, runners []*Runner) {
+	generator := make([]saturationSignal, 0)
+	if host != nil && now.Sub(host.Time) <= time.Duration(d.c.windowSec())*time.Second && host.CPUPercent >= d.c.cpuPercent() {
+		generator = append(generator, saturationSignal{SaturationCPU, fmt.Sprintf("host cpu is %d%%", host.CPUPercent)})
+	}
+	if rt.GCPause >= d.c.gcPause() {
+		generator = append(generator, saturationSignal{SaturationGCPause, fmt.Sprintf("gc paused for %s per second, %d goroutines", rt.GCPause, rt.Goroutines)})
+	}
+	if rt.SchedLatency >= d.c.schedLatency() {
+		generator = append(generator, saturationSignal{SaturationSchedLatency, fmt.Sprintf("scheduler latency is %s, %d goroutines", rt.SchedLatency, rt.Goroutines)})
+	}
+	seen := make(map[string]bool)
+	for _, r := range runners {
+		s, ok := r.lastSnapshot()
+		// snapshots are taken every second while handle is attacking
+		if !ok || now.Sub(s.Time) > 2*time.Second {
+			continue
+		}
+		signals := append([]saturationSignal{}, generator...)
+		if s.LimiterLag >= d.c.limiterLag() {
+			signals = append(signals, saturationSignal{SaturationLimiterLag, fmt.Sprintf("requests waited %s for a free attacker", s.LimiterLag)})
+		}
+		if max := r.maxAttackers(); max > 0 && s.Attackers >= max && float64(s.Requests) < float64(s.TargetRPS)*saturationAchievedRatio {
+			signals = append(signals, saturationSignal{SaturationAttackers, fmt.Sprintf("%d attackers are capped at max_attackers, achieved %d of %d rps", s.Attackers, s.Requests, s.TargetRPS)})
+		}
+		for _, sig := range signals {
+			key := r.step + "/" + r.name + "/" + sig.reason
+			seen[key] = true
+			d.streaks[key]++
+			if d.streaks[key] == d.c.windowSec() {
+				r.saturate(now, sig, d.c.MarkReport)
+			}
+		}
+	}
+	for key := range d.streaks {
+		if !seen[key] {
+			delete(d.streaks, key)
+		}
+	}
+}
+
+// saturate records saturation of the handle and warns that results show generator limits
+func (r *Runner) saturate(now time.Time, sig saturationSignal, mark bool) {
+	r.L.Warnf("generator is saturated: %s, results show generator limits, not target capacity", sig.text)
+	r.saturationMu.Lock()
+	r.saturation = append(r.saturation, SaturationEvent{Time: now, Reason: sig.reason, Text: sig.text})
+	if mark {
+		r.generatorBound = true
+	}
+	r.saturationMu.Unlock()
+	r.annotate(AnnotationSaturation, fmt.Sprintf("%s: generator is saturated, %s", r.name, sig.text))
+}
+
+// saturated checks if generator was the bottleneck of the handle
+func (r *Runner) saturated() bool {
+	r.saturationMu.Lock()
+	defer r.saturationMu.Unlock()
+	return len(r.saturation) != 0
+}
+
+// startSaturationDetector starts generator saturation checks of the suite
+func (m *LoadManager) startSaturationDetector() {
+	m.saturation = NewSaturationDetector(m)
+	m.saturation.Start()
+}
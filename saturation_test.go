@@ -0,0 +1,166 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testSaturationRunner(name string, maxAttackers int) *Runner {
+	return &Runner{
+		name:         name,
+		step:         "load",
+		Config:       RunnerConfig{MaxAttackers: maxAttackers},
+		controlMu:    &sync.RWMutex{},
+		snapshotMu:   &sync.Mutex{},
+		saturationMu: &sync.Mutex{},
+		L:            &Logger{log.With("runner", name)},
+	}
+}
+
+func testSaturationDetector(c SaturationConfig) *SaturationDetector {
+	return &SaturationDetector{c: c, streaks: make(map[string]int)}
+}
+
+func TestSaturationDetectorAttackersCapped(t *testing.T) {
+	setupLogger("console", "error")
+	d := testSaturationDetector(SaturationConfig{WindowSec: 3, MarkReport: true})
+	capped := testSaturationRunner("capped", 10)
+	reached := testSaturationRunner("reached", 10)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		capped.Snapshots = append(capped.Snapshots, Snapshot{Time: now, TargetRPS: 100, Attackers: 10, Requests: 60})
+		reached.Snapshots = append(reached.Snapshots, Snapshot{Time: now, TargetRPS: 100, Attackers: 10, Requests: 98})
+		if i == 1 && capped.saturated() {
+			t.Fatal("handle must be saturated only after window")
+		}
+		d.check(now, nil, RuntimeSample{}, []*Runner{capped, reached})
+	}
+	if !capped.saturated() || !capped.generatorBound || capped.saturation[0].Reason != SaturationAttackers {
+		t.Fatalf("capped attackers below target must saturate generator: %+v", capped.saturation)
+	}
+	if !strings.Contains(capped.saturation[0].Text, "achieved 60 of 100 rps") {
+		t.Fatalf("unexpected saturation text %q", capped.saturation[0].Text)
+	}
+	if reached.saturated() {
+		t.Fatal("capped attackers reaching target rps must not saturate generator")
+	}
+}
+
+func TestSaturationDetectorStreak(t *testing.T) {
+	setupLogger("console", "error")
+	d := testSaturationDetector(SaturationConfig{WindowSec: 2, LimiterLagMs: 20})
+	r := testSaturationRunner("lagging", 0)
+	host := &HostSample{CPUPercent: 95}
+	start := time.Now()
+	lags := []time.Duration{30 * time.Millisecond, 0, 30 * time.Millisecond}
+	for i, lag := range lags {
+		now := start.Add(time.Duration(i) * time.Second)
+		host.Time = now
+		r.Snapshots = append(r.Snapshots, Snapshot{Time: now, LimiterLag: lag})
+		d.check(now, host, RuntimeSample{}, []*Runner{r})
+	}
+	if len(r.saturation) != 1 || r.saturation[0].Reason != SaturationCPU {
+		t.Fatalf("limiter lag streak must be reset, cpu must saturate generator: %+v", r.saturation)
+	}
+	if r.generatorBound {
+		t.Fatal("report must be marked only if mark_report is set")
+	}
+
+	stale := start.Add(10 * time.Second)
+	d.check(stale, host, RuntimeSample{GCPause: time.Second}, []*Runner{r})
+	if len(d.streaks) != 0 {
+		t.Fatalf("handles that are not attacking must not be checked: %v", d.streaks)
+	}
+}
+
+func TestSnapshotLimiterLag(t *testing.T) {
+	b := newSnapshotBucket()
+	scheduled := time.Now()
+	b.add(result{scheduled: scheduled, begin: scheduled.Add(10 * time.Millisecond)})
+	b.add(result{scheduled: scheduled, begin: scheduled.Add(30 * time.Millisecond)})
+	var s Snapshot
+	b.flush(&s)
+	if s.LimiterLag != 20*time.Millisecond {
+		t.Fatalf("expected 20ms average lag, got %s", s.LimiterLag)
+	}
+}
+
+func TestGeneratorBoundReport(t *testing.T) {
+	rep := &RunReport{
+		GeneratorBound: true,
+		Saturation:     []SaturationEvent{{Time: time.Now(), Reason: SaturationCPU, Text: "host cpu is 97%"}},
+		Metrics:        map[string]*Metrics{},
+	}
+	if reportSucceeded(rep) {
+		t.Fatal("generator-bound report must not be a baseline")
+	}
+	if s := runStatus(rep); s != "generator-bound" {
+		t.Fatalf("unexpected status %s", s)
+	}
+	m := &LoadManager{GeneratorConfig: &GeneratorConfig{}, runReports: []*RunReport{rep}}
+	if code := m.ExitCode(); code != ExitOK {
+		t.Fatalf("generator-bound run must not fail without saturation.fail_run, got %d", code)
+	}
+	m.GeneratorConfig.Saturation.FailRun = true
+	if code := m.ExitCode(); code != ExitInfraError {
+		t.Fatalf("unexpected exit code %d", code)
+	}
+	// stop checks fired because generator is the bottleneck
+	m.Failed = true
+	if code := m.ExitCode(); code != ExitInfraError {
+		t.Fatalf("generator-bound run must be infra error before performance verdict, got %d", code)
+	}
+	m.GeneratorConfig.Saturation.FailRun = false
+	if code := m.ExitCode(); code != ExitPerformanceFailure {
+		t.Fatalf("unexpected exit code %d", code)
+	}
+	sr := &SuiteReport{Steps: []StepReport{{Name: "load", Reports: []*RunReport{rep}}}}
+	if sr.Status() != "generator-bound" {
+		t.Fatalf("unexpected suite status %s", sr.Status())
+	}
+	var b strings.Builder
+	if err := WriteHTMLReport(&b, sr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "Generator saturation") || !strings.Contains(b.String(), "host cpu is 97%") {
+		t.Fatal("report has no generator saturation")
+	}
+}
+
+func TestSaturatedRunValidation(t *testing.T) {
+	m, _, closeSrv := testControlManager("first")
+	defer closeSrv()
+	r := m.Steps[0].Runners[0]
+	r.MaxRPS = 30
+	r.Config.Validation.Threshold = 0.5
+	r.saturate(time.Now(), saturationSignal{reason: SaturationCPU, text: "host cpu is 97%"}, true)
+	if err := r.SetValidationParams(); err == nil || r.Config.IsValidationRun || r.Config.RPS != 50 {
+		t.Fatalf("max rps of saturated run must not be validated: %v %+v", err, r.Config)
+	}
+	r.init()
+	if r.saturated() || r.generatorBound {
+		t.Fatal("saturation of previous run must be reset")
+	}
+	if err := r.SetValidationParams(); err != nil || r.Config.RPS != 15 {
+		t.Fatalf("unexpected validation params: %v %+v", err, r.Config)
+	}
+}
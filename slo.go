@@ -0,0 +1,195 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SLOMetrics apdex and slo attainment of a label
+type SLOMetrics struct {
+	// Satisfied, Tolerating and Frustrated apdex requests, failed requests are frustrated
+	Satisfied  int64 `json:"satisfied"`
+	Tolerating int64 `json:"tolerating"`
+	Frustrated int64 `json:"frustrated"`
+	// Good requests within SLO: successful and not slower than slo latency
+	Good  int64 `json:"good"`
+	Total int64 `json:"total"`
+	// Apdex (satisfied + tolerating / 2) / total
+	Apdex float64 `json:"apdex"`
+	// Attainment percent of requests within SLO
+	Attainment float64 `json:"attainment"`
+	// Objective target percent of requests within SLO
+	Objective float64 `json:"objective,omitempty"`
+	// ErrorBudgetRemaining percent of error budget left, negative when budget is exhausted
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	// Violated is set when attainment is lower than objective or apdex is lower than min apdex
+	Violated bool `json:"violated"`
+}
+
+func (c *SLOConfig) satisfied() time.Duration {
+	return time.Duration(c.SatisfiedMs) * time.Millisecond
+}
+
+func (c *SLOConfig) tolerating() time.Duration {
+	if c.ToleratingMs == 0 {
+		return 4 * c.satisfied()
+	}
+	return time.Duration(c.ToleratingMs) * time.Millisecond
+}
+
+func (c *SLOConfig) latency() time.Duration {
+	if c.LatencyMs == 0 {
+		return c.satisfied()
+	}
+	return time.Duration(c.LatencyMs) * time.Millisecond
+}
+
+// success checks request result against slo status codes
+func (c *SLOConfig) success(res DoResult) bool {
+	if res.Error != nil {
+		return false
+	}
+	if len(c.StatusCodes) == 0 {
+		return res.checked || defaultSuccessCriteria.successStatus(res.StatusCode)
+	}
+	for _, code := range c.StatusCodes {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// apdexCounts counts of requests by apdex zone and within slo
+type apdexCounts struct {
+	satisfied, tolerating, frustrated, good int64
+}
+
+func (a *apdexCounts) add(c *SLOConfig, r result) {
+	ok := c.success(r.doResult)
+	switch {
+	case !ok:
+		a.frustrated++
+	case r.elapsed <= c.satisfied():
+		a.satisfied++
+	case r.elapsed <= c.tolerating():
+		a.tolerating++
+	default:
+		a.frustrated++
+	}
+	if ok && r.elapsed <= c.latency() {
+		a.good++
+	}
+}
+
+func (a apdexCounts) total() int64 {
+	return a.satisfied + a.tolerating + a.frustrated
+}
+
+func (a apdexCounts) apdex() float64 {
+	if a.total() == 0 {
+		return 0
+	}
+	return (float64(a.satisfied) + float64(a.tolerating)/2) / float64(a.total())
+}
+
+func (a apdexCounts) attainment() float64 {
+	if a.total() == 0 {
+		return 0
+	}
+	return float64(a.good) / float64(a.total()) * 100
+}
+
+// errorBudgetRemaining percent of allowed bad requests not spent yet
+func (a apdexCounts) errorBudgetRemaining(objective float64) float64 {
+	bad := float64(a.total() - a.good)
+	allowed := (100 - objective) / 100 * float64(a.total())
+	if allowed == 0 {
+		// 100% objective has no budget, any bad request exhausts it
+		if bad == 0 {
+			return 100
+		}
+		return -100
+	}
+	return (allowed - bad) / allowed * 100
+}
+
+// setSLO enables apdex and slo computation for label metrics
+func (m *Metrics) setSLO(c *SLOConfig) {
+	if c == nil {
+		return
+	}
+	m.slo = c
+	m.SLO = &SLOMetrics{Objective: c.Objective}
+}
+
+// updateSLO computes apdex, attainment and error budget of the run
+func (m *Metrics) updateSLO() {
+	if m.slo == nil {
+		return
+	}
+	s := m.SLO
+	a := m.apdex
+	s.Satisfied, s.Tolerating, s.Frustrated, s.Good, s.Total = a.satisfied, a.tolerating, a.frustrated, a.good, a.total()
+	s.Apdex = a.apdex()
+	s.Attainment = a.attainment()
+	s.ErrorBudgetRemaining = 0
+	if m.slo.Objective != 0 {
+		s.ErrorBudgetRemaining = a.errorBudgetRemaining(m.slo.Objective)
+	}
+	s.Violated = s.Total > 0 && ((m.slo.Objective != 0 && s.Attainment < m.slo.Objective) || s.Apdex < m.slo.MinApdex)
+}
+
+// sloViolations describes labels of report which missed slo
+func sloViolations(rep *RunReport) []string {
+	res := make([]string, 0)
+	for _, label := range sortedLabels(rep) {
+		s := rep.Metrics[label].SLO
+		if s == nil || !s.Violated {
+			continue
+		}
+		if s.Objective != 0 && s.Attainment < s.Objective {
+			res = append(res, fmt.Sprintf("slo of %s is %.2f%%, objective is %.2f%%, error budget remaining %.1f%%", label, s.Attainment, s.Objective, s.ErrorBudgetRemaining))
+		}
+		if c := rep.Configuration.SLO; c != nil && s.Apdex < c.MinApdex {
+			res = append(res, fmt.Sprintf("apdex of %s is %.3f, min is %.3f", label, s.Apdex, c.MinApdex))
+		}
+	}
+	return res
+}
+
+// CheckSLO fails the run if any label missed its slo objective or min apdex, partial results of interrupted handles are not checked
+func (m *LoadManager) CheckSLO() {
+	handles := make([]string, 0, len(m.Reports))
+	for handleName := range m.Reports {
+		handles = append(handles, handleName)
+	}
+	sort.Strings(handles)
+	for _, handleName := range handles {
+		rep := m.Reports[handleName]
+		if rep.Interrupted {
+			continue
+		}
+		for _, v := range sloViolations(rep) {
+			log.Infof("handle %s missed slo: %s", handleName, v)
+			m.Failed = true
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func sloResult(elapsed time.Duration, status int, err error) result {
+	return result{elapsed: elapsed, doResult: DoResult{RequestLabel: "first", StatusCode: status, Error: err}}
+}
+
+func TestMetricsSLO(t *testing.T) {
+	m := &Metrics{}
+	m.setSLO(&SLOConfig{SatisfiedMs: 100, LatencyMs: 200, Objective: 90, MinApdex: 0.7})
+	// 6 satisfied, 2 tolerating, 1 frustrated by latency, 1 failed
+	for i := 0; i < 6; i++ {
+		m.add(sloResult(50*time.Millisecond, 200, nil))
+	}
+	m.add(sloResult(150*time.Millisecond, 200, nil))
+	m.add(sloResult(300*time.Millisecond, 200, nil))
+	m.add(sloResult(time.Second, 200, nil))
+	m.add(sloResult(10*time.Millisecond, 500, nil))
+	m.updateLatencies()
+	s := m.SLO
+	if s.Satisfied != 6 || s.Tolerating != 2 || s.Frustrated != 2 || s.Total != 10 {
+		t.Fatalf("unexpected apdex zones: %+v", s)
+	}
+	if math.Abs(s.Apdex-0.7) > 1e-9 {
+		t.Errorf("apdex is %f, expected 0.7", s.Apdex)
+	}
+	// 7 requests are successful and not slower than 200ms
+	if math.Abs(s.Attainment-70) > 1e-9 {
+		t.Errorf("attainment is %f, expected 70", s.Attainment)
+	}
+	// budget is 1 request, 3 are spent
+	if math.Abs(s.ErrorBudgetRemaining+200) > 1e-9 {
+		t.Errorf("error budget remaining is %f, expected -200", s.ErrorBudgetRemaining)
+	}
+	if !s.Violated {
+		t.Error("slo is not violated")
+	}
+	rep := &RunReport{Configuration: RunnerConfig{SLO: m.slo}, Metrics: map[string]*Metrics{"first": m}}
+	if v := sloViolations(rep); len(v) != 1 {
+		t.Errorf("unexpected violations: %v", v)
+	}
+	if runStatus(rep) != "slo violated" || reportSucceeded(rep) {
+		t.Error("report violating slo is considered successful")
+	}
+}
+
+func TestSLOSuccessStatusCodes(t *testing.T) {
+	c := &SLOConfig{SatisfiedMs: 100, StatusCodes: []int{200, 404}}
+	if !c.success(DoResult{StatusCode: 404}) || c.success(DoResult{StatusCode: 201}) {
+		t.Error("status codes are not respected")
+	}
+	if c.success(DoResult{StatusCode: 200, Error: errors.New("bad body")}) {
+		t.Error("request with error is successful")
+	}
+	var a apdexCounts
+	a.add(c, sloResult(time.Millisecond, 200, nil))
+	if a.errorBudgetRemaining(100) != 100 {
+		t.Error("budget of 100% objective is spent without bad requests")
+	}
+	a.add(c, sloResult(time.Millisecond, 500, nil))
+	if a.errorBudgetRemaining(100) != -100 {
+		t.Error("budget of 100% objective is not exhausted by a bad request")
+	}
+}
+
+func TestCheckSLO(t *testing.T) {
+	setupLogger("console", "error")
+	m := &LoadManager{Reports: map[string]*RunReport{}}
+	met := &Metrics{SLO: &SLOMetrics{Apdex: 0.95, Attainment: 99.9, Objective: 99, Total: 10}}
+	m.Reports["first"] = &RunReport{Configuration: RunnerConfig{SLO: &SLOConfig{Objective: 99}}, Metrics: map[string]*Metrics{"first": met}}
+	m.CheckSLO()
+	if m.Failed {
+		t.Fatal("run is failed when slo is met")
+	}
+	met.SLO.Violated, met.SLO.Attainment = true, 98
+	m.Reports["first"].Interrupted = true
+	m.CheckSLO()
+	if m.Failed {
+		t.Fatal("interrupted run is checked")
+	}
+	m.Reports["first"].Interrupted = false
+	m.CheckSLO()
+	if !m.Failed {
+		t.Fatal("run is not failed when slo is violated")
+	}
+}
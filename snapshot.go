@@ -0,0 +1,172 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Snapshot runner state and results finished during one second
+type Snapshot struct {
+	Time      time.Time `json:"time"`
+	Step      string    `json:"step"`
+	Handle    string    `json:"handle"`
+	Stage     string    `json:"stage"`
+	TargetRPS int       `json:"target_rps"`
+	Attackers int       `json:"attackers"`
+	// Requests finished during the second, it's achieved rps
+	Requests int           `json:"requests"`
+	Errors   int           `json:"errors"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+	// LimiterLag average time requests of the second waited for a free attacker after rate limiter released them
+	LimiterLag time.Duration `json:"limiter_lag,omitempty"`
+	// Apdex and SLOAttainment of the second, set if handle has slo config
+	Apdex         float64 `json:"apdex,omitempty"`
+	SLOAttainment float64 `json:"slo_attainment,omitempty"`
+}
+
+// snapshotBucket results of the current second
+type snapshotBucket struct {
+	mu        *sync.Mutex
+	latencies []time.Duration
+	errors    int
+	lag       time.Duration
+	slo       *SLOConfig
+	apdex     apdexCounts
+}
+
+func newSnapshotBucket() *snapshotBucket {
+	return &snapshotBucket{mu: &sync.Mutex{}}
+}
+
+func (b *snapshotBucket) add(res result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latencies = append(b.latencies, res.elapsed)
+	if !res.scheduled.IsZero() {
+		b.lag += res.begin.Sub(res.scheduled)
+	}
+	if res.doResult.Error != nil {
+		b.errors++
+	}
+	if b.slo != nil {
+		b.apdex.add(b.slo, res)
+	}
+}
+
+// setSLO enables apdex and slo attainment per second
+func (b *snapshotBucket) setSLO(c *SLOConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.slo = c
+	b.apdex = apdexCounts{}
+}
+
+// flush computes snapshot of the second and starts a new one
+func (b *snapshotBucket) flush(s *Snapshot) {
+	b.mu.Lock()
+	latencies, errors, lag, apdex := b.latencies, b.errors, b.lag, b.apdex
+	b.latencies, b.errors, b.lag, b.apdex = nil, 0, 0, apdexCounts{}
+	b.mu.Unlock()
+	s.Requests = len(latencies)
+	if s.Requests > 0 {
+		s.LimiterLag = lag / time.Duration(s.Requests)
+	}
+	s.Errors = errors
+	s.Apdex, s.SLOAttainment = apdex.apdex(), apdex.attainment()
+	s.P50, s.P95, s.P99, s.Max = latencyPercentiles(latencies)
+}
+
+// latencyPercentiles sorts latencies and returns p50, p95, p99 and max, zero if there are no latencies
+func latencyPercentiles(latencies []time.Duration) (p50, p95, p99, max time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	at := func(q float64) time.Duration {
+		idx := int(q*float64(len(latencies))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return latencies[idx]
+	}
+	return at(0.50), at(0.95), at(0.99), latencies[len(latencies)-1]
+}
+
+// watchSnapshots records snapshot every second until runner is stopped
+func (r *Runner) watchSnapshots() {
+	r.snapshotMu.Lock()
+	r.Snapshots = make([]Snapshot, 0)
+	r.snapshotMu.Unlock()
+	r.bucket.setSLO(r.Config.SLO)
+	stop := r.stop
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case t := <-ticker.C:
+				r.takeSnapshot(t)
+			}
+		}
+	}()
+}
+
+func (r *Runner) takeSnapshot(t time.Time) Snapshot {
+	r.attackersMu.Lock()
+	attackers := len(r.attackers)
+	r.attackersMu.Unlock()
+	s := Snapshot{
+		Time:      t,
+		Step:      r.step,
+		Handle:    r.name,
+		Stage:     testStageNames[r.stage()],
+		TargetRPS: r.targetRPS(),
+		Attackers: attackers,
+	}
+	r.bucket.flush(&s)
+	r.sendGauges(s)
+	r.updateSLOGauges()
+	r.snapshotMu.Lock()
+	r.Snapshots = append(r.Snapshots, s)
+	r.snapshotMu.Unlock()
+	return s
+}
+
+// lastSnapshot the latest recorded snapshot
+func (r *Runner) lastSnapshot() (Snapshot, bool) {
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+	if len(r.Snapshots) == 0 {
+		return Snapshot{}, false
+	}
+	return r.Snapshots[len(r.Snapshots)-1], true
+}
+
+// snapshots copy of recorded snapshots
+func (r *Runner) snapshots() []Snapshot {
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+	return append([]Snapshot{}, r.Snapshots...)
+}
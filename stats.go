@@ -0,0 +1,175 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// latencySamplesSize size of latency reservoir stored in report for every label
+	latencySamplesSize = 2000
+	// bootstrapIterations resamples for bootstrap test
+	bootstrapIterations = 1000
+	// defaultSignificanceAlpha significance level if not set
+	defaultSignificanceAlpha = 0.05
+)
+
+// Significance test methods
+const (
+	mannWhitneySignificance = "mann_whitney"
+	bootstrapSignificance   = "bootstrap"
+)
+
+// addSample keeps uniform random sample of latencies, see reservoir sampling algorithm R
+func (m *Metrics) addSample(elapsed time.Duration) {
+	if len(m.LatencySamples) < latencySamplesSize {
+		m.LatencySamples = append(m.LatencySamples, elapsed)
+		return
+	}
+	if i := rand.Int63n(int64(m.Requests)); i < latencySamplesSize {
+		m.LatencySamples[i] = elapsed
+	}
+}
+
+func samplesMs(samples []time.Duration) []float64 {
+	res := make([]float64, len(samples))
+	for i, s := range samples {
+		res[i] = float64(s) / float64(time.Millisecond)
+	}
+	return res
+}
+
+// MannWhitneyGreater one-sided Mann-Whitney U test p-value for values of a being greater than values of b,
+// normal approximation with tie correction
+func MannWhitneyGreater(a []float64, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type value struct {
+		v     float64
+		fromA bool
+	}
+	all := make([]value, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, value{v, true})
+	}
+	for _, v := range b {
+		all = append(all, value{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	n := n1 + n2
+	var rankSumA, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		// average rank of tied values, ranks start from 1
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	u := rankSumA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (u - mean - 0.5) / sigma
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// BootstrapPercentileGreater one-sided bootstrap p-value for percentile q of a being greater than percentile q of b
+func BootstrapPercentileGreater(a []float64, b []float64, q float64, iterations int) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 1
+	}
+	// fixed seed keeps verdicts reproducible for the same reports
+	rng := rand.New(rand.NewSource(1))
+	resampleA := make([]float64, len(a))
+	resampleB := make([]float64, len(b))
+	notGreater := 0
+	for i := 0; i < iterations; i++ {
+		for j := range resampleA {
+			resampleA[j] = a[rng.Intn(len(a))]
+		}
+		for j := range resampleB {
+			resampleB[j] = b[rng.Intn(len(b))]
+		}
+		if percentile(resampleA, q) <= percentile(resampleB, q) {
+			notGreater++
+		}
+	}
+	return float64(notGreater) / float64(iterations)
+}
+
+// percentile nearest rank percentile, values are sorted in place
+func percentile(values []float64, q float64) float64 {
+	sort.Float64s(values)
+	idx := int(math.Ceil(q*float64(len(values)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return values[idx]
+}
+
+// latencyQuantile quantile of a latency regression metric
+func latencyQuantile(metric string) (float64, bool) {
+	switch metric {
+	case MetricP50:
+		return 0.50, true
+	case MetricP95:
+		return 0.95, true
+	case MetricP99:
+		return 0.99, true
+	}
+	return 0, false
+}
+
+// significance p-value of latency metric being greater in current samples than in baseline samples,
+// ok is false if test is disabled, metric is not a latency or there are no samples
+func (m *LoadManager) significance(metric string, current []time.Duration, baseline []time.Duration) (p float64, ok bool) {
+	q, isLatency := latencyQuantile(metric)
+	method := m.GeneratorConfig.Checks.Significance.Method
+	if method == "" || !isLatency || len(current) == 0 || len(baseline) == 0 {
+		return 0, false
+	}
+	switch method {
+	case bootstrapSignificance:
+		return BootstrapPercentileGreater(samplesMs(current), samplesMs(baseline), q, bootstrapIterations), true
+	default:
+		return MannWhitneyGreater(samplesMs(current), samplesMs(baseline)), true
+	}
+}
+
+func (m *LoadManager) significanceAlpha() float64 {
+	if a := m.GeneratorConfig.Checks.Significance.Alpha; a > 0 {
+		return a
+	}
+	return defaultSignificanceAlpha
+}
@@ -0,0 +1,87 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func testLatencySamples(seed int64, n int, mean time.Duration) []time.Duration {
+	rng := rand.New(rand.NewSource(seed))
+	res := make([]time.Duration, n)
+	for i := range res {
+		res[i] = mean + time.Duration(rng.NormFloat64()*float64(mean)/10)
+	}
+	return res
+}
+
+func TestSignificanceTests(t *testing.T) {
+	base := samplesMs(testLatencySamples(1, 500, 100*time.Millisecond))
+	same := samplesMs(testLatencySamples(2, 500, 100*time.Millisecond))
+	slower := samplesMs(testLatencySamples(3, 500, 110*time.Millisecond))
+	if p := MannWhitneyGreater(same, base); p < 0.05 {
+		t.Errorf("mann-whitney: same distribution is significant, p = %f", p)
+	}
+	if p := MannWhitneyGreater(slower, base); p >= 0.05 {
+		t.Errorf("mann-whitney: shift is not significant, p = %f", p)
+	}
+	if p := BootstrapPercentileGreater(same, base, 0.5, 500); p < 0.05 {
+		t.Errorf("bootstrap: same distribution is significant, p = %f", p)
+	}
+	if p := BootstrapPercentileGreater(slower, base, 0.5, 500); p >= 0.05 {
+		t.Errorf("bootstrap: shift is not significant, p = %f", p)
+	}
+}
+
+func TestLatencySamplesReservoir(t *testing.T) {
+	m := &Metrics{}
+	for i := 0; i < latencySamplesSize*3; i++ {
+		m.Requests++
+		m.addSample(time.Duration(i))
+	}
+	if len(m.LatencySamples) != latencySamplesSize {
+		t.Fatalf("expected %d samples, got %d", latencySamplesSize, len(m.LatencySamples))
+	}
+}
+
+func TestCompareReportsSignificance(t *testing.T) {
+	m := testRegressionManager("")
+	m.GeneratorConfig.Checks.Significance.Method = mannWhitneySignificance
+	base := testRegressionReport(100*time.Millisecond, 200*time.Millisecond, 1, 100)
+	base.Metrics["first"].LatencySamples = testLatencySamples(1, 500, 100*time.Millisecond)
+	// p50 is over threshold, but samples are from the same distribution
+	noise := testRegressionReport(130*time.Millisecond, 200*time.Millisecond, 1, 100)
+	noise.Metrics["first"].LatencySamples = testLatencySamples(2, 500, 100*time.Millisecond)
+	for _, r := range m.CompareReports("first", noise, base) {
+		if r.Regressed {
+			t.Fatalf("noise is reported as regression: %+v", r)
+		}
+	}
+	slower := testRegressionReport(130*time.Millisecond, 200*time.Millisecond, 1, 100)
+	slower.Metrics["first"].LatencySamples = testLatencySamples(3, 500, 130*time.Millisecond)
+	regressed := false
+	for _, r := range m.CompareReports("first", slower, base) {
+		if r.Metric == MetricP50 && r.Regressed && r.PValue != nil {
+			regressed = true
+		}
+	}
+	if !regressed {
+		t.Fatal("significant p50 regression is not reported")
+	}
+}
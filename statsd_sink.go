@@ -0,0 +1,153 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdMaxPacket udp payload size safe for most networks
+const statsdMaxPacket = 1432
+
+// StatsDSink sends every result as statsd counters and timing, aggregation is done by statsd:
+// <prefix>.<runner>.<label>.requests:1|c, <prefix>.<runner>.<label>.latency:12.5|ms,
+// <prefix>.<runner>.<label>.errors.<category>:1|c, gauges are <prefix>.<tag values>.<name>:v|g
+type StatsDSink struct {
+	prefix    string
+	mu        *sync.Mutex
+	conn      net.Conn
+	buf       *bytes.Buffer
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// NewStatsDSink sends metrics to statsd at udp addr, lines are batched into packets flushed every flush interval
+func NewStatsDSink(addr string, prefix string, flushInterval time.Duration) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd %s: %s", addr, err)
+	}
+	s := &StatsDSink{
+		prefix:    prefix,
+		mu:        &sync.Mutex{},
+		conn:      conn,
+		buf:       &bytes.Buffer{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				s.flush()
+				s.mu.Unlock()
+			}
+		}
+	}()
+	return s, nil
+}
+
+// statsdName makes metric path part of a tag value
+func statsdName(v string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", " ", "_", "\n", "_").Replace(v)
+}
+
+func (s *StatsDSink) path(parts ...string) string {
+	res := make([]string, 0, len(parts)+1)
+	if s.prefix != "" {
+		res = append(res, s.prefix)
+	}
+	for _, p := range parts {
+		if p != "" {
+			res = append(res, statsdName(p))
+		}
+	}
+	return strings.Join(res, ".")
+}
+
+func (s *StatsDSink) write(lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range lines {
+		if s.buf.Len() > 0 && s.buf.Len()+1+len(line) > statsdMaxPacket {
+			s.flush()
+		}
+		if s.buf.Len() > 0 {
+			s.buf.WriteByte('\n')
+		}
+		s.buf.WriteString(line)
+	}
+}
+
+// flush sends buffered lines, must be called with mu locked
+func (s *StatsDSink) flush() {
+	if s.buf.Len() == 0 {
+		return
+	}
+	if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+		log.Errorf("failed to send metrics to statsd: %s", err)
+	}
+	s.buf.Reset()
+}
+
+func (s *StatsDSink) Result(step string, handle string, res DoResult, elapsed time.Duration) {
+	lines := []string{
+		fmt.Sprintf("%s:1|c", s.path(handle, res.RequestLabel, "requests")),
+		fmt.Sprintf("%s:%s|ms", s.path(handle, res.RequestLabel, "latency"), promFloat(latencyMs(elapsed))),
+	}
+	if category := ClassifyError(res); category != "" {
+		lines = append(lines, fmt.Sprintf("%s:1|c", s.path(handle, res.RequestLabel, "errors", category)))
+	}
+	if res.BytesIn > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|c", s.path(handle, res.RequestLabel, "bytes_in"), res.BytesIn))
+	}
+	if res.BytesOut > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|c", s.path(handle, res.RequestLabel, "bytes_out"), res.BytesOut))
+	}
+	s.write(lines...)
+}
+
+func (s *StatsDSink) Gauge(name string, tags map[string]string, value float64) {
+	s.write(fmt.Sprintf("%s:%s|g", s.path(tags["host"], tags["iface"], tags["runner"], tags["label"], name), promFloat(value)))
+}
+
+// Close sends buffered lines and closes connection
+func (s *StatsDSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		s.mu.Lock()
+		s.flush()
+		s.mu.Unlock()
+		err = s.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResultValidator can be implemented by an Attacker to check request results,
+// ex.: fail requests with 200 status and error in body, returned error marks request as failed.
+// It is called concurrently from every attacker.
+type ResultValidator interface {
+	ValidateResult(res DoResult) error
+}
+
+// SuccessConfig success criteria of handle requests
+type SuccessConfig struct {
+	// StatusCodes successful status codes, ranges and classes, ex.: [200-299, 404, 3xx], default is 200-399,
+	// requests without status code are successful if they have no error
+	StatusCodes []string `mapstructure:"status_codes,omitempty" yaml:"status_codes,omitempty"`
+}
+
+type statusRange struct {
+	from, to int
+}
+
+// successCriteria compiled success config
+type successCriteria struct {
+	statuses []statusRange
+}
+
+var defaultSuccessCriteria = &successCriteria{statuses: []statusRange{{200, 399}}}
+
+// parseStatusRange parses status code (404), range (200-299) or class (2xx)
+func parseStatusRange(v string) (statusRange, error) {
+	v = strings.TrimSpace(strings.ToLower(v))
+	if len(v) == 3 && strings.HasSuffix(v, "xx") && v[0] >= '1' && v[0] <= '5' {
+		from := int(v[0]-'0') * 100
+		return statusRange{from, from + 99}, nil
+	}
+	bounds := strings.SplitN(v, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("%q is not a status code, range or class, ex.: 404, 200-299, 2xx", v)
+	}
+	to := from
+	if len(bounds) == 2 {
+		if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+			return statusRange{}, fmt.Errorf("%q is not a status code, range or class, ex.: 404, 200-299, 2xx", v)
+		}
+	}
+	if from < 100 || to > 599 || from > to {
+		return statusRange{}, fmt.Errorf("%q is not a valid http status range", v)
+	}
+	return statusRange{from, to}, nil
+}
+
+// newSuccessCriteria compiles success config, default criteria is used if config is empty
+func newSuccessCriteria(c *SuccessConfig) (*successCriteria, error) {
+	if c == nil || len(c.StatusCodes) == 0 {
+		return defaultSuccessCriteria, nil
+	}
+	sc := &successCriteria{}
+	for _, v := range c.StatusCodes {
+		r, err := parseStatusRange(v)
+		if err != nil {
+			return nil, err
+		}
+		sc.statuses = append(sc.statuses, r)
+	}
+	return sc, nil
+}
+
+// successStatus checks status code, requests without status code are successful
+func (sc *successCriteria) successStatus(code int) bool {
+	if code == 0 {
+		return true
+	}
+	for _, r := range sc.statuses {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResult applies success criteria to request result once, failed requests always have an error after check,
+// so metrics, graphite, csv logs and checks count the same failures
+func (r *Runner) checkResult(res DoResult) DoResult {
+	if res.checked {
+		return res
+	}
+	res.checked = true
+	if res.Error != nil {
+		return res
+	}
+	sc := r.success
+	if sc == nil {
+		sc = defaultSuccessCriteria
+	}
+	if !sc.successStatus(res.StatusCode) {
+		res.Error = fmt.Errorf("unexpected status code %d", res.StatusCode)
+		return res
+	}
+	if r.validator != nil {
+		res.Error = r.validator.ValidateResult(res)
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	cases := map[string]statusRange{
+		"404":     {404, 404},
+		"200-299": {200, 299},
+		"4xx":     {400, 499},
+		" 2XX ":   {200, 299},
+	}
+	for v, expected := range cases {
+		r, err := parseStatusRange(v)
+		if err != nil || r != expected {
+			t.Errorf("%q parsed as %v, %v, expected %v", v, r, err, expected)
+		}
+	}
+	for _, v := range []string{"ok", "299-200", "6xx", "42", "200-"} {
+		if _, err := parseStatusRange(v); err == nil {
+			t.Errorf("%q is accepted", v)
+		}
+	}
+}
+
+type testValidator struct{}
+
+func (testValidator) ValidateResult(res DoResult) error {
+	if res.RequestLabel == "bad_body" {
+		return errors.New("error in body")
+	}
+	return nil
+}
+
+func TestCheckResult(t *testing.T) {
+	sc, err := newSuccessCriteria(&SuccessConfig{StatusCodes: []string{"2xx", "404", "409"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{success: sc, validator: testValidator{}}
+	m := &Metrics{}
+	results := []DoResult{
+		{RequestLabel: "first", StatusCode: 200},
+		{RequestLabel: "first", StatusCode: 404},
+		{RequestLabel: "first", StatusCode: 302},
+		{RequestLabel: "first", StatusCode: 503},
+		{RequestLabel: "bad_body", StatusCode: 200},
+	}
+	for _, res := range results {
+		m.add(result{doResult: r.checkResult(r.checkResult(res))})
+	}
+	m.updateLatencies()
+	if m.success != 2 || m.errorsCount != 3 {
+		t.Fatalf("expected 2 successful and 3 failed requests, got %d and %d", m.success, m.errorsCount)
+	}
+	if m.ErrorCategories[ErrCategoryHTTP4xx] != nil {
+		t.Error("successful 404 is counted as error")
+	}
+	if m.ErrorCategories[ErrCategoryHTTP5xx].Count != 1 || m.ErrorCategories[ErrCategoryApplication].Count != 2 {
+		t.Errorf("unexpected error categories: %v", m.ErrorCategories)
+	}
+	if m.ErrorCounts["error in body"] != 1 || m.ErrorCounts["unexpected status code <n>"] != 2 {
+		t.Errorf("unexpected errors: %v", m.ErrorCounts)
+	}
+	// default criteria
+	r = &Runner{}
+	if res := r.checkResult(DoResult{StatusCode: 404}); res.Error == nil {
+		t.Error("404 is successful by default")
+	}
+	if res := r.checkResult(DoResult{StatusCode: 301}); res.Error != nil {
+		t.Errorf("301 is failed by default: %s", res.Error)
+	}
+}
+
+func TestValidateSuccessConfig(t *testing.T) {
+	f := writeTestConfig(t, strings.Replace(validSuite, "    csv_write: first.csv", "    csv_write: first.csv\n    success:\n      status_codes: [2xx, 404, 500-503]", 1))
+	defer os.Remove(f)
+	if errs := ValidateSuiteConfigFile(f); len(errs) != 0 {
+		t.Fatalf("expected no errors, got:\n%s", errs)
+	}
+}
@@ -18,7 +18,9 @@ package loadgen
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 )
 
 var log *Logger
@@ -30,24 +32,61 @@ type attackerChecksFactory func(string) RuntimeCheckFunc
 type BeforeSuite func(config *GeneratorConfig) error
 type AfterSuite func(config *GeneratorConfig) error
 
+// Suite exit codes
+const (
+	// ExitOK all checks passed
+	ExitOK = 0
+	// ExitInfraError suite can't be run: hooks failed, handles failed to run, generator was saturated and saturation.fail_run is set or any other unrecoverable error
+	ExitInfraError = 1
+	// ExitConfigError suite or generator config is invalid
+	ExitConfigError = 2
+	// ExitPerformanceFailure results are not acceptable: stop checks, max rps validation, degradation or errors
+	ExitPerformanceFailure = 3
+	// ExitInterrupted suite was stopped by signal or control api, 128 + SIGINT
+	ExitInterrupted = 130
+)
+
 // Run default run mode for suite, with degradation checks
 func Run(factory attackerFactory, checksFactory attackerChecksFactory, beforeSuite BeforeSuite, afterSuite AfterSuite) {
 	cfgPath := flag.String("config", "", "loadtest attack profile config filepath")
 	genCfgPath := flag.String("gen_config", "generator.yaml", "generator config filepath")
+	resume := flag.Bool("resume", false, "run only steps not finished in previous run, previous reports are merged")
+	onlyFailed := flag.Bool("only-failed", false, "run only steps not completed in previous run: failed, interrupted or not started, previous reports are merged")
+	tui := flag.Bool("tui", false, "show live terminal dashboard of the current step, logs are written to "+dashboardLogPath)
+	ui := flag.String("ui", "", "serve live web ui on address, ex.: :8089")
+	uiWait := flag.Duration("ui_wait", time.Minute, "keep web ui running after the suite until html report is fetched, at most for duration")
 	flag.Parse()
+	// logger is configured from generator config, so problems are printed directly
 	if *cfgPath == "" {
-		log.Fatal("provide path to suite config, -config example.yaml")
+		fmt.Println("provide path to suite config, -config example.yaml")
+		os.Exit(ExitConfigError)
 	}
 	if *genCfgPath == "" {
-		log.Fatal("provide path to generator config, -gen_config example.yaml")
+		fmt.Println("provide path to generator config, -gen_config example.yaml")
+		os.Exit(ExitConfigError)
 	}
 	genConfig := LoadDefaultGeneratorConfig(*genCfgPath)
+	lm := SuiteFromSteps(factory, checksFactory, *cfgPath, genConfig)
 	if genConfig.Host.CollectMetrics {
 		log.Infof("starting host metrics monitor")
-		osMetrics := NewHostOSMetrics(genConfig.Host.Name, genConfig.Graphite.URL, 1, genConfig.Host.NetworkIface)
-		osMetrics.Watch(1)
+		lm.HostMetrics = NewHostOSMetrics(genConfig.Host.Name, genConfig.Host.NetworkIface, lm.sinks)
+		lm.HostMetrics.Watch(1)
+	}
+	switch {
+	case *resume && *onlyFailed:
+		log.Error("use either -resume or -only-failed")
+		os.Exit(ExitConfigError)
+	case *resume:
+		lm.RunMode = RunResume
+	case *onlyFailed:
+		lm.RunMode = RunOnlyFailed
+	}
+	if *ui != "" {
+		lm.StartWebUI(*ui)
+	}
+	if *tui {
+		lm.StartDashboard(os.Stdout)
 	}
-	lm := SuiteFromSteps(factory, checksFactory, *cfgPath, genConfig)
 	if beforeSuite != nil {
 		if err := beforeSuite(genConfig); err != nil {
 			log.Fatalf("before suite func failed: %s", err)
@@ -56,28 +95,31 @@ func Run(factory attackerFactory, checksFactory attackerChecksFactory, beforeSui
 	lm.RunSuite()
 	if afterSuite != nil {
 		if err := afterSuite(genConfig); err != nil {
-			log.Fatalf("before suite func failed: %s", err)
+			log.Fatalf("after suite func failed: %s", err)
 		}
 	}
-	if lm.ValidationFailed {
-		os.Exit(1)
+	if *ui != "" {
+		lm.WaitWebUI(*uiWait)
 	}
+	os.Exit(lm.ExitCode())
 }
 
 // SuiteFromSteps create runners for every step
 func SuiteFromSteps(factory attackerFactory, checksFactory attackerChecksFactory, cfgPath string, genCfg *GeneratorConfig) *LoadManager {
 	cfg := LoadSuiteConfig(cfgPath)
 	lm := NewLoadManager(cfg, genCfg)
+	lm.SuiteConfigPath = cfgPath
 	for _, step := range lm.SuiteConfig.Steps {
 		runners := make([]*Runner, 0)
 		for _, handle := range step.Handles {
-			runners = append(runners, NewRunner(
+			r := NewRunner(
 				handle.HandleName,
 				lm,
 				factory(handle.HandleName),
 				checksFactory(handle.HandleName),
-				handle),
-			)
+				handle)
+			r.step = step.Name
+			runners = append(runners, r)
 		}
 		lm.Steps = append(lm.Steps, RunStep{
 			Name:          step.Name,
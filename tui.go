@@ -0,0 +1,215 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dashboardLogPath logs are written only to file while dashboard is shown
+	dashboardLogPath = "/tmp/logs"
+	// sparklineWidth seconds shown in latency sparklines
+	sparklineWidth = 40
+
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// TerminalDashboard live terminal view of the current step, redrawn every second from runner snapshots
+type TerminalDashboard struct {
+	m       *LoadManager
+	out     io.Writer
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	once    *sync.Once
+}
+
+// NewTerminalDashboard creates dashboard writing frames to out
+func NewTerminalDashboard(m *LoadManager, out io.Writer) *TerminalDashboard {
+	return &TerminalDashboard{
+		m:    m,
+		out:  out,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		once: &sync.Once{},
+	}
+}
+
+// StartDashboard shows live dashboard on out until suite shutdown, logs are written to file only
+func (m *LoadManager) StartDashboard(out io.Writer) {
+	setupLoggerOutput(m.GeneratorConfig.Logging.Encoding, m.GeneratorConfig.Logging.Level, dashboardLogPath)
+	// runner loggers are built with the previous output
+	for _, step := range m.Steps {
+		for _, r := range step.Runners {
+			r.L = &Logger{log.With("runner", r.name)}
+		}
+	}
+	m.dashboard = NewTerminalDashboard(m, out)
+	m.dashboard.Start(1 * time.Second)
+}
+
+// Start redraws dashboard every interval
+func (d *TerminalDashboard) Start(interval time.Duration) {
+	d.started = timeNow()
+	io.WriteString(d.out, ansiHideCursor)
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop draws the last frame and restores cursor
+func (d *TerminalDashboard) Stop() {
+	d.once.Do(func() {
+		close(d.stop)
+		<-d.done
+		d.draw()
+		io.WriteString(d.out, ansiShowCursor)
+	})
+}
+
+func (d *TerminalDashboard) draw() {
+	var b bytes.Buffer
+	b.WriteString(ansiClear)
+	d.render(&b, timeNow())
+	d.out.Write(b.Bytes())
+}
+
+// render writes one frame: suite header and every handle of the current step
+func (d *TerminalDashboard) render(w io.Writer, now time.Time) {
+	fmt.Fprintf(w, "loadgen  suite: %s  run: %s  elapsed: %s\n", suiteName(d.m.SuiteConfigPath), d.m.RunID, formatSeconds(now.Sub(d.started)))
+	step := d.m.CurrentStep()
+	if step == nil {
+		fmt.Fprintf(w, "suite finished, exit code %d, logs: %s\n", d.m.ExitCode(), dashboardLogPath)
+		return
+	}
+	d.m.controlMu.RLock()
+	current := d.m.currentStep
+	d.m.controlMu.RUnlock()
+	fmt.Fprintf(w, "step: %s (%d/%d, %s)  logs: %s\n", step.Name, current+1, len(d.m.Steps), step.ExecutionMode, dashboardLogPath)
+	for _, r := range step.Runners {
+		fmt.Fprintln(w)
+		renderRunner(w, r, now)
+	}
+}
+
+// renderRunner handle rates, success, errors, check status, time remaining and latency sparklines
+func renderRunner(w io.Writer, r *Runner, now time.Time) {
+	snapshots := r.snapshots()
+	r.attackersMu.Lock()
+	attackers := len(r.attackers)
+	r.attackersMu.Unlock()
+	var requests, errors, achieved int
+	for _, s := range snapshots {
+		requests += s.Requests
+		errors += s.Errors
+	}
+	remaining := time.Duration(r.Config.AttackTimeSec) * time.Second
+	stage := "waiting"
+	var last Snapshot
+	if len(snapshots) > 0 {
+		last = snapshots[len(snapshots)-1]
+		achieved = last.Requests
+		stage = last.Stage
+		remaining -= now.Sub(snapshots[0].Time) + time.Second
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	success := 100.0
+	if requests > 0 {
+		success = float64(requests-errors) / float64(requests) * 100
+	}
+	fmt.Fprintf(w, "%s  [%s]  remaining: %s  check: %s\n", r.name, stage, formatSeconds(remaining), runnerCheckStatus(r, last, errors))
+	fmt.Fprintf(w, "  rps: %d/%d  attackers: %d  success: %.2f%%  errors: %d (%d/s)\n", achieved, r.targetRPS(), attackers, success, errors, last.Errors)
+	if len(snapshots) > sparklineWidth {
+		snapshots = snapshots[len(snapshots)-sparklineWidth:]
+	}
+	var max time.Duration
+	for _, s := range snapshots {
+		if s.P99 > max {
+			max = s.P99
+		}
+	}
+	for _, p := range []struct {
+		name string
+		get  func(s Snapshot) time.Duration
+	}{
+		{"p50", func(s Snapshot) time.Duration { return s.P50 }},
+		{"p95", func(s Snapshot) time.Duration { return s.P95 }},
+		{"p99", func(s Snapshot) time.Duration { return s.P99 }},
+	} {
+		values := make([]time.Duration, len(snapshots))
+		for i, s := range snapshots {
+			values[i] = p.get(s)
+		}
+		fmt.Fprintf(w, "  %s %-*s %8.2fms\n", p.name, sparklineWidth, sparkline(values, max), latencyMs(p.get(last)))
+	}
+}
+
+// runnerCheckStatus live verdict of handle checks
+func runnerCheckStatus(r *Runner, last Snapshot, errors int) string {
+	switch {
+	case r.failed.Get():
+		return "failed"
+	case r.interrupted.Get():
+		return "interrupted"
+	case r.Config.SLO != nil && last.Requests > 0 && last.SLOAttainment < r.Config.SLO.Objective:
+		return "slo violated"
+	case errors > 0:
+		return "errors"
+	}
+	return "ok"
+}
+
+// sparkline one block per value scaled to max, blocks are padded with spaces to sparklineWidth by caller
+func sparkline(values []time.Duration, max time.Duration) string {
+	var b strings.Builder
+	for _, v := range values {
+		idx := 0
+		if max > 0 {
+			idx = int(float64(v) / float64(max) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[idx])
+	}
+	return b.String()
+}
+
+// formatSeconds duration as 1m05s
+func formatSeconds(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,98 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	got := sparkline([]time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond}, 100*time.Millisecond)
+	if got != "▁▄█" {
+		t.Fatalf("unexpected sparkline %q", got)
+	}
+	if got := sparkline([]time.Duration{0, 0}, 0); got != "▁▁" {
+		t.Fatalf("unexpected empty sparkline %q", got)
+	}
+}
+
+func TestTerminalDashboardRender(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &Runner{
+		name:        "first_test",
+		Config:      RunnerConfig{RPS: 100, AttackTimeSec: 60},
+		attackersMu: &sync.Mutex{},
+		attackers:   make([]Attack, 3),
+		controlMu:   &sync.RWMutex{},
+		snapshotMu:  &sync.Mutex{},
+		Snapshots: []Snapshot{
+			{Time: start, Stage: "rampup", Requests: 50, P50: 10 * time.Millisecond, P95: 20 * time.Millisecond, P99: 40 * time.Millisecond},
+			{Time: start.Add(time.Second), Stage: "constant", Requests: 100, Errors: 2, P50: 10 * time.Millisecond, P95: 20 * time.Millisecond, P99: 80 * time.Millisecond},
+		},
+	}
+	m := &LoadManager{
+		SuiteConfigPath: "load/run_configs/first_test.yaml",
+		RunID:           "run-1",
+		controlMu:       &sync.RWMutex{},
+		Steps:           []RunStep{{Name: "load", ExecutionMode: "parallel", Runners: []*Runner{r}}},
+	}
+	d := NewTerminalDashboard(m, &bytes.Buffer{})
+	d.started = start
+	var out bytes.Buffer
+	d.render(&out, start.Add(2*time.Second))
+	for _, line := range []string{
+		"suite: first_test  run: run-1  elapsed: 0m02s",
+		"step: load (1/1, parallel)",
+		"first_test  [constant]  remaining: 0m57s  check: errors",
+		"rps: 100/100  attackers: 3  success: 98.67%  errors: 2 (2/s)",
+		"p99 ▄█",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("no %q in frame:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestDashboardReroutesRunnerLogs(t *testing.T) {
+	m, _, closeSrv := testControlManager("first")
+	defer closeSrv()
+	defer setupLogger("console", "error")
+	m.GeneratorConfig.Logging.Encoding = "console"
+	m.GeneratorConfig.Logging.Level = "info"
+	var out bytes.Buffer
+	m.StartDashboard(&out)
+	msg := fmt.Sprintf("dashboard log %d", time.Now().UnixNano())
+	m.Steps[0].Runners[0].L.Infof(msg)
+	m.dashboard.Stop()
+	m.Steps[0].Runners[0].L.Sync()
+	if strings.Contains(out.String(), msg) {
+		t.Fatal("runner logs must not be printed over dashboard")
+	}
+	b, err := ioutil.ReadFile(dashboardLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), msg) {
+		t.Fatalf("runner logs must be written to %s", dashboardLogPath)
+	}
+}
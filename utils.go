@@ -17,11 +17,8 @@
 package loadgen
 
 import (
-	graphite "github.com/cyberdelia/go-metrics-graphite"
-	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
 	"math/rand"
-	"net"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,19 +26,14 @@ import (
 
 var once sync.Once
 
+// StartGraphiteSender sends custom metrics of default registry to graphite, flush duration is in seconds,
+// suite runs send handle metrics to graphite configured in generator config, see NewGraphiteSink
 func StartGraphiteSender(prefix string, flushDuration time.Duration, url string) {
 	once.Do(func() {
 		log.Infof("[grafana-monitoring] setup graphite client with url: %s", url)
-		addr, err := net.ResolveTCPAddr("tcp", url)
-		if err != nil {
-			log.Fatalf("[grafana-monitoring] ResolveTCPAddr on [%s] failed error [%v] ", url, err)
+		if _, err := NewGraphiteSink(url, prefix, flushDuration*time.Second); err != nil {
+			log.Fatalf("[grafana-monitoring] %s", err)
 		}
-		go graphite.Graphite(
-			metrics.DefaultRegistry,
-			flushDuration*time.Second,
-			prefix,
-			addr,
-		)
 	})
 }
 
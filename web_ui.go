@@ -0,0 +1,313 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// webUIPlanStep step of the suite plan shown in web ui
+type webUIPlanStep struct {
+	Name          string            `json:"name"`
+	ExecutionMode string            `json:"execution_mode"`
+	Handles       []webUIPlanHandle `json:"handles"`
+}
+
+// webUIPlanHandle load profile of a handle
+type webUIPlanHandle struct {
+	Name          string `json:"name"`
+	RPS           int    `json:"rps"`
+	AttackTimeSec int    `json:"attack_time_sec"`
+	RampUpTimeSec int    `json:"ramp_up_sec"`
+}
+
+// webUIProgress current step of the suite, finished is set when all steps are done
+type webUIProgress struct {
+	Step     int  `json:"step"`
+	Finished bool `json:"finished"`
+}
+
+// StartWebUI starts embedded live web ui, it doesn't need any external assets:
+//
+// GET /         page with suite plan, progress and live charts of every handle
+// GET /events   server sent events: plan, progress, snapshots of current step handles and done
+// GET /report   html report of the run, available when suite is finished
+//
+// web ui is served until process exits, see WaitWebUI
+func (m *LoadManager) StartWebUI(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to start web ui on %s: %s", addr, err)
+	}
+	log.Infof("web ui is available at http://%s", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, m.webUIHandler(1*time.Second)); err != nil {
+			log.Errorf("web ui stopped: %s", err)
+		}
+	}()
+}
+
+func (m *LoadManager) webUIHandler(interval time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, webUIPage)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, req *http.Request) {
+		m.streamEvents(w, req, interval)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, req *http.Request) {
+		p := filepath.Join(m.RunDir(), HTMLReportFile)
+		if _, err := os.Stat(p); err != nil {
+			http.Error(w, "report is written when suite is finished", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, req, p)
+		m.reportFetched.Set(true)
+	})
+	return mux
+}
+
+// WaitWebUI keeps web ui running after the suite until html report is fetched, at most for timeout
+func (m *LoadManager) WaitWebUI(timeout time.Duration) {
+	if m.reportFetched.Get() || timeout <= 0 {
+		return
+	}
+	log.Infof("waiting for html report to be fetched from web ui, at most %s", timeout)
+	deadline := time.Now().Add(timeout)
+	for !m.reportFetched.Get() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// suitePlan steps and handles of the suite
+func (m *LoadManager) suitePlan() []webUIPlanStep {
+	plan := make([]webUIPlanStep, 0, len(m.Steps))
+	for _, step := range m.Steps {
+		ps := webUIPlanStep{Name: step.Name, ExecutionMode: step.ExecutionMode}
+		for _, r := range step.Runners {
+			ps.Handles = append(ps.Handles, webUIPlanHandle{
+				Name:          r.Config.HandleName,
+				RPS:           r.Config.RPS,
+				AttackTimeSec: r.Config.AttackTimeSec,
+				RampUpTimeSec: r.Config.RampUpTimeSec,
+			})
+		}
+		plan = append(plan, ps)
+	}
+	return plan
+}
+
+func (m *LoadManager) progress() webUIProgress {
+	m.controlMu.RLock()
+	defer m.controlMu.RUnlock()
+	return webUIProgress{Step: m.currentStep, Finished: m.currentStep >= len(m.Steps)}
+}
+
+// streamEvents sends plan once, then progress and new snapshots of current step handles every interval,
+// stream ends with done event when suite is finished and its reports are written
+func (m *LoadManager) streamEvents(w http.ResponseWriter, req *http.Request, interval time.Duration) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(event string, v interface{}) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Errorf("failed to encode web ui event: %s", err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	if !send("plan", m.suitePlan()) {
+		return
+	}
+	sent := make(map[*Runner]time.Time)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p := m.progress()
+		if !send("progress", p) {
+			return
+		}
+		if p.Finished && m.reported.Get() {
+			send("done", map[string]string{"report": "/report"})
+			return
+		}
+		if !p.Finished {
+			snapshots := make([]Snapshot, 0)
+			for _, r := range m.Steps[p.Step].Runners {
+				for _, s := range r.snapshots() {
+					if s.Time.After(sent[r]) {
+						snapshots = append(snapshots, s)
+						sent[r] = s.Time
+					}
+				}
+			}
+			if len(snapshots) > 0 && !send("snapshots", snapshots) {
+				return
+			}
+		}
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+const webUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>loadgen</title>
+<style>
+body { font-family: sans-serif; margin: 20px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.running { background: #e3f2fd; }
+.done { color: #888; }
+.handle { display: inline-block; margin: 0 16px 16px 0; vertical-align: top; }
+canvas { border: 1px solid #ddd; }
+#status { font-weight: bold; }
+</style>
+</head>
+<body>
+<h2>loadgen <span id="status">connecting</span></h2>
+<table id="plan"><tr><th>step</th><th>mode</th><th>handles</th></tr></table>
+<div id="handles"></div>
+<script>
+var maxPoints = 300;
+var colors = ["#1e88e5", "#fb8c00", "#e53935", "#43a047"];
+var plan = [], series = {};
+
+function el(tag, text) {
+	var e = document.createElement(tag);
+	if (text !== undefined) { e.textContent = text; }
+	return e;
+}
+
+function drawChart(canvas, title, lines) {
+	var ctx = canvas.getContext("2d"), w = canvas.width, h = canvas.height, max = 0, n = 0;
+	ctx.clearRect(0, 0, w, h);
+	lines.forEach(function (l) { n = Math.max(n, l.values.length); l.values.forEach(function (v) { max = Math.max(max, v); }); });
+	ctx.fillStyle = "#222";
+	ctx.fillText(title + " (max " + max.toFixed(1) + ")", 4, 12);
+	lines.forEach(function (l, i) {
+		ctx.strokeStyle = colors[i % colors.length];
+		ctx.fillStyle = colors[i % colors.length];
+		ctx.fillText(l.name, 4 + 60 * i, h - 4);
+		ctx.beginPath();
+		l.values.forEach(function (v, j) {
+			var x = n > 1 ? j / (n - 1) * w : 0, y = h - 16 - (max > 0 ? v / max : 0) * (h - 32);
+			if (j === 0) { ctx.moveTo(x, y); } else { ctx.lineTo(x, y); }
+		});
+		ctx.stroke();
+	});
+}
+
+function handleView(name) {
+	var s = series[name];
+	if (s) { return s; }
+	var div = el("div"), rps = el("canvas"), lat = el("canvas"), info = el("div");
+	div.className = "handle";
+	rps.width = lat.width = 480;
+	rps.height = lat.height = 160;
+	div.appendChild(el("h3", name));
+	div.appendChild(info);
+	div.appendChild(rps);
+	div.appendChild(el("br"));
+	div.appendChild(lat);
+	document.getElementById("handles").appendChild(div);
+	s = series[name] = {div: div, info: info, rps: rps, lat: lat, target: [], achieved: [], p50: [], p95: [], p99: []};
+	return s;
+}
+
+function push(arr, v) {
+	arr.push(v);
+	if (arr.length > maxPoints) { arr.shift(); }
+}
+
+var events = new EventSource("/events");
+events.addEventListener("plan", function (e) {
+	plan = JSON.parse(e.data);
+	var table = document.getElementById("plan");
+	plan.forEach(function (step, i) {
+		var tr = el("tr");
+		tr.id = "step-" + i;
+		tr.appendChild(el("td", step.name));
+		tr.appendChild(el("td", step.execution_mode));
+		tr.appendChild(el("td", (step.handles || []).map(function (h) {
+			return h.name + " (" + h.rps + " rps, " + h.attack_time_sec + "s)";
+		}).join(", ")));
+		table.appendChild(tr);
+	});
+});
+events.addEventListener("progress", function (e) {
+	var p = JSON.parse(e.data);
+	plan.forEach(function (step, i) {
+		document.getElementById("step-" + i).className = p.finished || i < p.step ? "done" : (i === p.step ? "running" : "");
+	});
+	document.getElementById("status").textContent = p.finished ? "finished" : "running step " + (p.step + 1) + "/" + plan.length;
+});
+events.addEventListener("snapshots", function (e) {
+	var updated = {};
+	JSON.parse(e.data).forEach(function (snap) {
+		var s = handleView(snap.handle);
+		push(s.target, snap.target_rps);
+		push(s.achieved, snap.requests);
+		push(s.p50, snap.p50 / 1e6);
+		push(s.p95, snap.p95 / 1e6);
+		push(s.p99, snap.p99 / 1e6);
+		s.info.textContent = snap.step + " / " + snap.stage + ", attackers: " + snap.attackers + ", errors/s: " + snap.errors;
+		updated[snap.handle] = s;
+	});
+	Object.keys(updated).forEach(function (name) {
+		var s = updated[name];
+		drawChart(s.rps, "rps", [{name: "target", values: s.target}, {name: "achieved", values: s.achieved}]);
+		drawChart(s.lat, "latency ms", [{name: "p50", values: s.p50}, {name: "p95", values: s.p95}, {name: "p99", values: s.p99}]);
+	});
+});
+events.addEventListener("done", function (e) {
+	events.close();
+	var a = el("a", "html report");
+	a.href = JSON.parse(e.data).report;
+	var status = document.getElementById("status");
+	status.textContent = "finished, ";
+	status.appendChild(a);
+});
+</script>
+</body>
+</html>
+`
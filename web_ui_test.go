@@ -0,0 +1,169 @@
+/*
+ *    Copyright [2020] Sergey Kudasov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testWebUIManager(current int) *LoadManager {
+	r := &Runner{
+		name:       "first_test",
+		Config:     RunnerConfig{HandleName: "first_test", RPS: 100, AttackTimeSec: 60},
+		snapshotMu: &sync.Mutex{},
+		Snapshots: []Snapshot{
+			{Time: time.Unix(1, 0), Handle: "first_test", Step: "load", Requests: 10},
+			{Time: time.Unix(2, 0), Handle: "first_test", Step: "load", Requests: 20},
+		},
+	}
+	return &LoadManager{
+		controlMu:   &sync.RWMutex{},
+		currentStep: current,
+		Steps:       []RunStep{{Name: "load", ExecutionMode: "parallel", Runners: []*Runner{r}}},
+	}
+}
+
+// readEvents reads server sent events until stop event
+func readEvents(t *testing.T, url string, stop string) map[string]string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	events := make(map[string]string)
+	var event string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			events[event] = strings.TrimPrefix(line, "data: ")
+			if event == stop {
+				return events
+			}
+		}
+	}
+	t.Fatalf("stream ended without %s event: %v", stop, events)
+	return nil
+}
+
+func TestWebUIEvents(t *testing.T) {
+	m := testWebUIManager(0)
+	srv := httptest.NewServer(m.webUIHandler(10 * time.Millisecond))
+	defer srv.Close()
+
+	events := readEvents(t, srv.URL+"/events", "snapshots")
+	if !strings.Contains(events["plan"], `"handles":[{"name":"first_test","rps":100,"attack_time_sec":60,"ramp_up_sec":0}]`) {
+		t.Fatalf("unexpected plan: %s", events["plan"])
+	}
+	if events["progress"] != `{"step":0,"finished":false}` {
+		t.Fatalf("unexpected progress: %s", events["progress"])
+	}
+	if strings.Count(events["snapshots"], `"handle":"first_test"`) != 2 {
+		t.Fatalf("unexpected snapshots: %s", events["snapshots"])
+	}
+
+	m.controlMu.Lock()
+	m.currentStep = 1
+	m.controlMu.Unlock()
+	events = readEvents(t, srv.URL+"/events", "progress")
+	if _, ok := events["done"]; ok || events["progress"] != `{"step":1,"finished":true}` {
+		t.Fatalf("done must be sent only after reports are written: %v", events)
+	}
+	m.reported.Set(true)
+	events = readEvents(t, srv.URL+"/events", "done")
+	if events["progress"] != `{"step":1,"finished":true}` || events["done"] != `{"report":"/report"}` {
+		t.Fatalf("unexpected finished events: %v", events)
+	}
+}
+
+func TestWebUIPage(t *testing.T) {
+	m := testWebUIManager(0)
+	m.ReportDir = "testdata-missing"
+	srv := httptest.NewServer(m.webUIHandler(time.Second))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `new EventSource("/events")`) {
+		t.Fatalf("unexpected page: %s", body)
+	}
+	resp, err = http.Get(srv.URL + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("report must not be found before suite is finished, got %s", resp.Status)
+	}
+}
+
+func TestWebUIWaitReportFetch(t *testing.T) {
+	setupLogger("console", "error")
+	dir, err := ioutil.TempDir("", "loadgen-ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testWebUIManager(1)
+	m.ReportDir = dir
+	m.RunID = "run"
+	if err := os.MkdirAll(m.RunDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(m.RunDir(), HTMLReportFile), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(m.webUIHandler(time.Second))
+	defer srv.Close()
+
+	start := time.Now()
+	m.WaitWebUI(50 * time.Millisecond)
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("web ui must be kept until report is fetched or timeout")
+	}
+	resp, err := http.Get(srv.URL + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected report status %s", resp.Status)
+	}
+	start = time.Now()
+	m.WaitWebUI(time.Minute)
+	if time.Since(start) > time.Second {
+		t.Fatal("wait must end when report is fetched")
+	}
+}